@@ -63,6 +63,7 @@ func newCommand(logger logr.Logger) *cobra.Command {
 
 	cmd.AddCommand(hub.NewManagerCommand("argoworkflow-status-sync-addon", logger.WithName("argoworkflow-status-manager")))
 	cmd.AddCommand(spoke.NewAgentCommand("argoworkflow-status-sync-addon", logger.WithName("argoworkflow-status-agent")))
+	cmd.AddCommand(spoke.NewCleanupCommand("argoworkflow-status-sync-addon", logger.WithName("argoworkflow-status-cleanup")))
 
 	return cmd
 }
@@ -209,6 +209,11 @@ func (o *override) getValueForAgentTemplate(cluster *clusterv1.ManagedCluster,
 		Image                   string
 		SpokeRolebindingName    string
 		AgentServiceAccountName string
+		SyncMode                string
+		SyncInterval            string
+		HubQPS                  string
+		HubBurst                string
+		ResyncInterval          string
 	}{
 		KubeConfigSecret:        fmt.Sprintf("%s-hub-kubeconfig", addon.Name),
 		AddonInstallNamespace:   "open-cluster-management-agent-addon",
@@ -217,6 +222,12 @@ func (o *override) getValueForAgentTemplate(cluster *clusterv1.ManagedCluster,
 		Image:                   addonImage,
 		SpokeRolebindingName:    addon.Name,
 		AgentServiceAccountName: fmt.Sprintf("%s-agent-sa", addon.Name),
+		// overridden per cluster by the ManagedClusterAddOn values annotation
+		SyncMode:       "immediate",
+		SyncInterval:   "5s",
+		HubQPS:         "5",
+		HubBurst:       "10",
+		ResyncInterval: "5m",
 	}
 
 	return addonfactory.StructToValues(manifestConfig), nil
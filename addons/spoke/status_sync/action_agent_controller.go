@@ -0,0 +1,126 @@
+package status_sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	workflowcontroller "open-cluster-management.io/argo-workflow-multicluster/controllers/workflow"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+type ArgoWorkflowActionController struct {
+	spokeClient client.Client
+	log         logr.Logger
+}
+
+var WorkflowActionPredicateFunctions = predicate.Funcs{
+	// only reconcile when the hub Workflow requested an action that was not applied yet
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		workflow := e.ObjectNew.(*argov1alpha1.Workflow)
+		_, pending := getPendingAction(*workflow)
+		return containsValidOCMAnnotations(*workflow) && pending
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		workflow := e.Object.(*argov1alpha1.Workflow)
+		_, pending := getPendingAction(*workflow)
+		return containsValidOCMAnnotations(*workflow) && pending
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
+func (c *ArgoWorkflowActionController) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("argoworkflow-action").
+		For(&argov1alpha1.Workflow{}, builder.WithPredicates(WorkflowActionPredicateFunctions)).
+		Complete(c)
+}
+
+// Reconcile applies the action requested by the hub Workflow annotations to the managed cluster Workflow.
+// Suspend, stop and terminate are part of the Workflow spec so they are already applied through the ManifestWork,
+// retry and resume need the Workflow status to change which the ManifestWork does not touch.
+// The applied action is recorded on the Workflow so it runs only once per action ID.
+func (c *ArgoWorkflowActionController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	c.log.Info(fmt.Sprintf("reconciling action... %s", req))
+	defer c.log.Info(fmt.Sprintf("done reconcile action %s", req))
+
+	workflow := argov1alpha1.Workflow{}
+	err := c.spokeClient.Get(ctx, req.NamespacedName, &workflow)
+	switch {
+	case errors.IsNotFound(err):
+		return ctrl.Result{}, nil
+	case err != nil:
+		c.log.Error(err, "unable to get Workflow")
+		return ctrl.Result{}, err
+	}
+
+	action, pending := getPendingAction(workflow)
+	if !pending || !workflow.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	annos := workflow.GetAnnotations()
+	nodeFieldSelector := annos[workflowcontroller.AnnotationKeyOCMActionNodeFieldSelector]
+	var removedNodes []string
+	switch action {
+	case workflowcontroller.ActionRetry:
+		restartSuccessful := strings.EqualFold(annos[workflowcontroller.AnnotationKeyOCMActionRestartSuccessful], "true")
+		removedNodes, err = retryWorkflow(&workflow, nodeFieldSelector, restartSuccessful)
+	case workflowcontroller.ActionResume:
+		err = resumeWorkflow(&workflow, nodeFieldSelector)
+	default:
+		err = fmt.Errorf("unknown action %q", action)
+	}
+	// an action that cannot be applied is still recorded so it is not attempted again
+	if err != nil {
+		c.log.Error(err, "unable to apply the "+action+" action")
+	}
+
+	workflow.Annotations[workflowcontroller.AnnotationKeyOCMAppliedAction] = generateAppliedAction(workflow)
+	if err := c.spokeClient.Update(ctx, &workflow); err != nil {
+		c.log.Error(err, "unable to update Workflow")
+		return ctrl.Result{}, err
+	}
+
+	if len(removedNodes) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	// the Argo controller creates new pods for the removed nodes
+	pods := &corev1.PodList{}
+	if err := c.spokeClient.List(ctx, pods, client.InNamespace(workflow.Namespace),
+		client.MatchingLabels{labelKeyWorkflow: workflow.Name}); err != nil {
+		c.log.Error(err, "unable to list Workflow pods")
+		return ctrl.Result{}, err
+	}
+	for i := range pods.Items {
+		if !containsNodeID(removedNodes, pods.Items[i].Annotations[annotationKeyNodeID]) {
+			continue
+		}
+		if err := c.spokeClient.Delete(ctx, &pods.Items[i]); client.IgnoreNotFound(err) != nil {
+			c.log.Error(err, "unable to delete Workflow pod "+pods.Items[i].Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func containsNodeID(nodeIDs []string, nodeID string) bool {
+	for _, id := range nodeIDs {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
@@ -4,21 +4,28 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	"open-cluster-management.io/addon-framework/pkg/lease"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
-	workflowv1alpha1 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 )
 
 var (
@@ -29,7 +36,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(addonv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(argov1alpha1.AddToScheme(scheme))
-	utilruntime.Must(workflowv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(workflowv1alpha2.AddToScheme(scheme))
 }
 
 func NewAgentCommand(addonName string, logger logr.Logger) *cobra.Command {
@@ -59,11 +66,29 @@ type AgentOptions struct {
 	SpokeClusterName  string
 	AddonName         string
 	AddonNamespace    string
+	ArgoNamespace     string
+	SyncMode          string
+	SyncInterval      time.Duration
+	HubQPS            float32
+	HubBurst          int
+	ResyncInterval    time.Duration
+	FinalizerTimeout  time.Duration
 }
 
 // NewWorkloadAgentOptions returns the flags with default value set
 func NewAgentOptions(addonName string, logger logr.Logger) *AgentOptions {
-	return &AgentOptions{AddonName: addonName, Log: logger}
+	return &AgentOptions{
+		AddonName:        addonName,
+		AddonNamespace:   "open-cluster-management-agent-addon",
+		ArgoNamespace:    "argo",
+		Log:              logger,
+		SyncMode:         SyncModeImmediate,
+		SyncInterval:     5 * time.Second,
+		HubQPS:           5,
+		HubBurst:         10,
+		ResyncInterval:   5 * time.Minute,
+		FinalizerTimeout: time.Hour,
+	}
 }
 
 func (o *AgentOptions) AddFlags(cmd *cobra.Command) {
@@ -71,6 +96,19 @@ func (o *AgentOptions) AddFlags(cmd *cobra.Command) {
 	// This command only supports reading from config
 	flags.StringVar(&o.HubKubeconfigFile, "hub-kubeconfig", o.HubKubeconfigFile, "Location of kubeconfig file to connect to hub cluster.")
 	flags.StringVar(&o.SpokeClusterName, "cluster-name", o.SpokeClusterName, "Name of spoke cluster.")
+	flags.StringVar(&o.SyncMode, "sync-mode", o.SyncMode,
+		"How the Workflow status changes are written to the hub cluster, either immediate or batched over the sync interval.")
+	flags.DurationVar(&o.SyncInterval, "sync-interval", o.SyncInterval,
+		"The window the Workflow status changes are coalesced over in the batched sync mode.")
+	flags.Float32Var(&o.HubQPS, "hub-qps", o.HubQPS, "The maximum queries per second to the hub cluster.")
+	flags.IntVar(&o.HubBurst, "hub-burst", o.HubBurst, "The maximum burst of queries to the hub cluster.")
+	flags.DurationVar(&o.ResyncInterval, "resync-interval", o.ResyncInterval,
+		"How often the hub WorkflowStatusResults are compared with the managed cluster Workflows, 0 disables the resync.")
+	flags.DurationVar(&o.FinalizerTimeout, "finalizer-timeout", o.FinalizerTimeout,
+		"How long a deleted Workflow waits for its final status sync before the finalizer is removed anyway, 0 waits forever.")
+	flags.StringVar(&o.AddonNamespace, "addon-namespace", o.AddonNamespace, "The namespace the add-on agent is installed in.")
+	flags.StringVar(&o.ArgoNamespace, "argo-namespace", o.ArgoNamespace,
+		"The namespace of the Argo controller configuration the default artifact repository is read from.")
 }
 
 func (o *AgentOptions) runControllerManager(ctx context.Context) error {
@@ -78,10 +116,19 @@ func (o *AgentOptions) runControllerManager(ctx context.Context) error {
 
 	flag.Parse()
 
+	if o.SyncMode != SyncModeImmediate && o.SyncMode != SyncModeBatched {
+		return fmt.Errorf("invalid sync mode %q, expected %s or %s", o.SyncMode, SyncModeImmediate, SyncModeBatched)
+	}
+
 	spokeConfig := ctrl.GetConfigOrDie()
 	mgr, err := ctrl.NewManager(spokeConfig, ctrl.Options{
 		Scheme:         scheme,
 		LeaderElection: false,
+		// only the Workflow Events are cached, a field selector can not select two kinds,
+		// the pod Events are cached by the pod Event cache
+		NewCache: cache.BuilderWithOptions(cache.Options{SelectorsByObject: cache.SelectorsByObject{
+			&corev1.Event{}: {Field: fields.OneTermEqualSelector("involvedObject.kind", "Workflow")},
+		}}),
 	})
 
 	if err != nil {
@@ -94,6 +141,8 @@ func (o *AgentOptions) runControllerManager(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to create hubConfig from flag, err: %w", err)
 	}
+	hubConfig.QPS = o.HubQPS
+	hubConfig.Burst = o.HubBurst
 
 	hubClient, err := client.New(hubConfig, client.Options{Scheme: scheme})
 	if err != nil {
@@ -114,7 +163,7 @@ func (o *AgentOptions) runControllerManager(ctx context.Context) error {
 	leaseUpdater := lease.NewLeaseUpdater(
 		leaseClient,
 		o.AddonName,
-		"open-cluster-management-agent-addon",
+		o.AddonNamespace,
 	)
 
 	go leaseUpdater.Start(ctx)
@@ -122,15 +171,110 @@ func (o *AgentOptions) runControllerManager(ctx context.Context) error {
 	log.Info("starting manager")
 
 	helloSpokeController := &ArgoWorkflowStatusController{
-		spokeClient: spokeKubeClient,
-		hubClient:   hubClient,
-		log:         o.Log,
-		clusterName: o.SpokeClusterName,
+		spokeClient:      spokeKubeClient,
+		hubClient:        hubClient,
+		log:              o.Log,
+		clusterName:      o.SpokeClusterName,
+		syncMode:         o.SyncMode,
+		syncInterval:     o.SyncInterval,
+		finalizerTimeout: o.FinalizerTimeout,
+		addonNamespace:   o.AddonNamespace,
+		argoNamespace:    o.ArgoNamespace,
+		startTime:        time.Now(),
+	}
+
+	if o.ResyncInterval > 0 {
+		resyncEvents := make(chan event.GenericEvent)
+		helloSpokeController.resyncEvents = resyncEvents
+		if err = mgr.Add(&WorkflowStatusResyncer{
+			spokeClient: spokeKubeClient,
+			hubClient:   hubClient,
+			log:         o.Log.WithName("resync"),
+			clusterName: o.SpokeClusterName,
+			interval:    o.ResyncInterval,
+			events:      resyncEvents,
+		}); err != nil {
+			return fmt.Errorf("unable to add the WorkflowStatusResult resync, err: %w", err)
+		}
 	}
 
 	if err = helloSpokeController.SetupWithManager(mgr); err != nil {
 		return fmt.Errorf("unable to create argoworkflow-status agent controller: %s, err: %w", "argoworkflow-status-agent", err)
 	}
 
+	actionController := &ArgoWorkflowActionController{
+		spokeClient: spokeKubeClient,
+		log:         o.Log,
+	}
+
+	if err = actionController.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create argoworkflow-action agent controller: %s, err: %w", "argoworkflow-action-agent", err)
+	}
+
+	hubKubeClient, err := kubernetes.NewForConfig(hubConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create hub kube client, err: %w", err)
+	}
+
+	// the Events are emitted in the managed cluster namespace of the hub, the only namespace the agent can access.
+	// The broadcaster aggregates the repeated Events and rate limits them per involved object.
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: hubKubeClient.CoreV1().Events(o.SpokeClusterName)})
+	defer eventBroadcaster.Shutdown()
+
+	// only the Warning pod Events are cached, the Normal ones are left out of the hub summary
+	podEventCache, err := cache.New(spokeConfig, cache.Options{Scheme: scheme, SelectorsByObject: cache.SelectorsByObject{
+		&corev1.Event{}: {Field: fields.AndSelectors(
+			fields.OneTermEqualSelector("involvedObject.kind", "Pod"),
+			fields.OneTermEqualSelector("type", corev1.EventTypeWarning),
+		)},
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to create pod Event cache, err: %w", err)
+	}
+	if err = mgr.Add(podEventCache); err != nil {
+		return fmt.Errorf("unable to add the pod Event cache, err: %w", err)
+	}
+
+	eventController := &WorkflowEventController{
+		spokeClient:   spokeKubeClient,
+		podEventCache: podEventCache,
+		hubRecorder:   eventBroadcaster.NewRecorder(scheme, corev1.EventSource{Component: o.AddonName, Host: o.SpokeClusterName}),
+		log:           o.Log,
+		clusterName:   o.SpokeClusterName,
+		startTime:     time.Now(),
+	}
+
+	if err = eventController.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create argoworkflow-event agent controller: %s, err: %w", "argoworkflow-event-agent", err)
+	}
+
+	// the WorkflowLogRequests are watched in the managed cluster namespace of the hub, the only namespace the agent can access
+	hubCache, err := cache.New(hubConfig, cache.Options{Scheme: scheme, Namespace: o.SpokeClusterName})
+	if err != nil {
+		return fmt.Errorf("failed to create hub cache, err: %w", err)
+	}
+	if err = mgr.Add(hubCache); err != nil {
+		return fmt.Errorf("unable to add the hub cache, err: %w", err)
+	}
+
+	// the pod logs are only served by the typed clientset
+	spokeClientset, err := kubernetes.NewForConfig(spokeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create spoke clientset, err: %w", err)
+	}
+
+	logController := &WorkflowLogRequestController{
+		spokeClient:     spokeKubeClient,
+		spokeKubeClient: spokeClientset,
+		hubClient:       hubClient,
+		hubCache:        hubCache,
+		log:             o.Log,
+	}
+
+	if err = logController.SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create argoworkflow-log agent controller: %s, err: %w", "argoworkflow-log-agent", err)
+	}
+
 	return mgr.Start(ctrl.SetupSignalHandler())
 }
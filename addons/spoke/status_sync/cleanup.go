@@ -0,0 +1,80 @@
+package status_sync
+
+import (
+	"context"
+	"fmt"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewCleanupCommand removes the status sync finalizer of the managed cluster Workflows, it runs as the add-on
+// pre-delete hook so the Workflows can still be deleted once the agent is gone
+func NewCleanupCommand(addonName string, logger logr.Logger) *cobra.Command {
+	addonNamespace := "open-cluster-management-agent-addon"
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: fmt.Sprintf("Remove the %s's Workflow finalizers before the add-on is removed", addonName),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCleanup(context.TODO(), logger, addonNamespace)
+		},
+	}
+
+	cmd.Flags().StringVar(&addonNamespace, "addon-namespace", addonNamespace, "The namespace the add-on agent is installed in.")
+
+	return cmd
+}
+
+// runCleanup stops the running agent from adding the status sync finalizer then removes it from every Workflow
+func runCleanup(ctx context.Context, log logr.Logger, addonNamespace string) error {
+	spokeClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create spoke client, err: %w", err)
+	}
+
+	// the uninstall ConfigMap is created again so it is newer than the running agent
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: addonNamespace, Name: uninstallConfigMapName}}
+	if err := spokeClient.Delete(ctx, configMap); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete the uninstall ConfigMap, err: %w", err)
+	}
+	if err := spokeClient.Create(ctx, configMap); err != nil {
+		return fmt.Errorf("failed to create the uninstall ConfigMap, err: %w", err)
+	}
+
+	workflows := &argov1alpha1.WorkflowList{}
+	if err := spokeClient.List(ctx, workflows); err != nil {
+		return fmt.Errorf("failed to list Workflows, err: %w", err)
+	}
+
+	c := &ArgoWorkflowStatusController{spokeClient: spokeClient, log: log}
+	for i := range workflows.Items {
+		key := client.ObjectKeyFromObject(&workflows.Items[i])
+		if !hasStatusSyncFinalizer(workflows.Items[i]) {
+			continue
+		}
+
+		log.Info(fmt.Sprintf("removing the status sync finalizer of Workflow %s", key))
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			workflow := argov1alpha1.Workflow{}
+			if err := spokeClient.Get(ctx, key, &workflow); err != nil {
+				return err
+			}
+			if !hasStatusSyncFinalizer(workflow) {
+				return nil
+			}
+			return c.updateStatusSyncFinalizer(ctx, &workflow, false)
+		})
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to remove the status sync finalizer, err: %w", err)
+		}
+	}
+
+	return nil
+}
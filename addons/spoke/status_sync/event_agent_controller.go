@@ -0,0 +1,146 @@
+package status_sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+	workflowcontroller "open-cluster-management.io/argo-workflow-multicluster/controllers/workflow"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// WorkflowEventController emits the Events of the managed cluster Workflows and their pods on the hub cluster
+// against the WorkflowStatusResult, the hub re-emits them against the hub Workflow
+type WorkflowEventController struct {
+	spokeClient client.Client
+	// podEventCache watches the pod Events, the manager cache only watches the Workflow Events
+	podEventCache cache.Cache
+	// hubRecorder emits the Events in the managed cluster namespace of the hub, it deduplicates and rate limits them
+	hubRecorder record.EventRecorder
+	log         logr.Logger
+	clusterName string
+	// startTime skips the Events that occurred before the agent started, they were emitted by the previous agent
+	startTime time.Time
+
+	// emittedCounts is the count of each Event when it was last emitted on the hub cluster
+	emittedCounts     map[types.NamespacedName]int32
+	emittedCountsLock sync.Mutex
+}
+
+var WorkflowEventPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isWorkflowEventCandidate(*e.ObjectNew.(*corev1.Event))
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return isWorkflowEventCandidate(*e.Object.(*corev1.Event))
+	},
+	// the emitted count of the deleted Event is forgotten
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return isWorkflowEventCandidate(*e.Object.(*corev1.Event))
+	},
+}
+
+func (c *WorkflowEventController) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("argoworkflow-event").
+		For(&corev1.Event{}, builder.WithPredicates(WorkflowEventPredicateFunctions)).
+		Watches(source.NewKindWithCache(&corev1.Event{}, c.podEventCache), &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(WorkflowEventPredicateFunctions)).
+		Complete(c)
+}
+
+// Reconcile emits the Event of an OCM Workflow, or of one of its pods, on the hub cluster
+// when it first occurs and every time it occurs again.
+func (c *WorkflowEventController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	c.log.Info(fmt.Sprintf("reconciling event... %s", req))
+	defer c.log.Info(fmt.Sprintf("done reconcile event %s", req))
+
+	ev := corev1.Event{}
+	err := c.spokeClient.Get(ctx, req.NamespacedName, &ev)
+	switch {
+	case errors.IsNotFound(err):
+		c.recordEmittedCount(req.NamespacedName, 0)
+		return ctrl.Result{}, nil
+	case err != nil:
+		c.log.Error(err, "unable to get Event")
+		return ctrl.Result{}, err
+	}
+
+	if getEventLastTime(ev).Before(c.startTime) || workflowcontroller.GetEventCount(ev) <= c.getEmittedCount(req.NamespacedName) {
+		return ctrl.Result{}, nil
+	}
+
+	workflowName := ev.InvolvedObject.Name
+	if ev.InvolvedObject.Kind == "Pod" {
+		pod := corev1.Pod{}
+		err := c.spokeClient.Get(ctx, types.NamespacedName{Namespace: ev.InvolvedObject.Namespace, Name: ev.InvolvedObject.Name}, &pod)
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		if err != nil {
+			c.log.Error(err, "unable to get Pod")
+			return ctrl.Result{}, err
+		}
+		workflowName = pod.Labels[labelKeyWorkflow]
+		if len(workflowName) == 0 {
+			return ctrl.Result{}, nil
+		}
+	}
+
+	workflow := argov1alpha1.Workflow{}
+	err = c.spokeClient.Get(ctx, types.NamespacedName{Namespace: ev.InvolvedObject.Namespace, Name: workflowName}, &workflow)
+	if errors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		c.log.Error(err, "unable to get Workflow")
+		return ctrl.Result{}, err
+	}
+	if !containsValidOCMAnnotations(workflow) {
+		return ctrl.Result{}, nil
+	}
+
+	result := &workflowv1alpha2.WorkflowStatusResult{}
+	result.Namespace = c.clusterName
+	result.Name = generateHubWorkflowStatusResultName(workflow)
+	c.hubRecorder.Event(result, ev.Type, ev.Reason, summarizeEventMessage(ev))
+	c.recordEmittedCount(req.NamespacedName, workflowcontroller.GetEventCount(ev))
+
+	return ctrl.Result{}, nil
+}
+
+// getEmittedCount returns the count of the Event when it was last emitted on the hub cluster, zero if never
+func (c *WorkflowEventController) getEmittedCount(key types.NamespacedName) int32 {
+	c.emittedCountsLock.Lock()
+	defer c.emittedCountsLock.Unlock()
+	return c.emittedCounts[key]
+}
+
+// recordEmittedCount records the count of the Event emitted on the hub cluster, zero forgets a deleted Event
+func (c *WorkflowEventController) recordEmittedCount(key types.NamespacedName, count int32) {
+	c.emittedCountsLock.Lock()
+	defer c.emittedCountsLock.Unlock()
+	if c.emittedCounts == nil {
+		c.emittedCounts = map[types.NamespacedName]int32{}
+	}
+	if count == 0 {
+		delete(c.emittedCounts, key)
+		return
+	}
+	c.emittedCounts[key] = count
+}
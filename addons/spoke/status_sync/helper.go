@@ -1,8 +1,54 @@
 package status_sync
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 	workflowcontroller "open-cluster-management.io/argo-workflow-multicluster/controllers/workflow"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Workflow label the Argo controller uses to skip the completed Workflows.
+	labelKeyCompleted = "workflows.argoproj.io/completed"
+	// Workflow label the Argo controller sets to the Workflow phase.
+	labelKeyPhase = "workflows.argoproj.io/phase"
+	// Pod label the Argo controller sets to the Workflow name.
+	labelKeyWorkflow = "workflows.argoproj.io/workflow"
+	// Pod annotation the Argo controller sets to the Workflow node ID.
+	annotationKeyNodeID = "workflows.argoproj.io/node-id"
+	// ConfigMap annotation that selects the default key of an artifact repository ConfigMap.
+	annotationKeyDefaultArtifactRepository = "workflows.argoproj.io/default-artifact-repository"
+	// defaultArtifactRepositoryConfigMap is the artifact repository ConfigMap a Workflow references when it does not name one.
+	defaultArtifactRepositoryConfigMap = "artifact-repositories"
+	// workflowControllerConfigMap is the Argo controller configuration that holds the default artifact repository.
+	workflowControllerConfigMap = "workflow-controller-configmap"
+	// Workflow finalizer that holds the Workflow deletion until its final status is synced to the hub cluster.
+	finalizerStatusSync = "workflows.argoproj.io/ocm-status-sync"
+	// remoteDeletionPollInterval is how often the hub is checked for the acknowledgement of a Workflow deletion.
+	remoteDeletionPollInterval = 5 * time.Second
+	// uninstallConfigMapName is the ConfigMap the add-on pre-delete cleanup creates in the add-on namespace,
+	// the agent stops adding the status sync finalizer once it was created after the agent started.
+	uninstallConfigMapName = "argoworkflow-status-sync-addon-uninstall"
+	// defaultLogContainer is the Workflow pod container the logs are fetched from when the request does not specify one.
+	defaultLogContainer = "main"
+	// defaultLogTailLines is the number of lines fetched per pod when the request limits neither the lines nor the bytes.
+	defaultLogTailLines = int64(500)
+	// maxLogRequestSize is the size of the logs of all the pods a request holds, same as the hub object size limit.
+	maxLogRequestSize = 1024 * 1024
+	// logFollowInterval is how often the logs of a followed request are fetched again.
+	logFollowInterval = 5 * time.Second
+	// maxEventMessageSize is the size the Event messages emitted on the hub cluster are truncated to.
+	maxEventMessageSize = 1024
 )
 
 func containsValidOCMAnnotations(workflow argov1alpha1.Workflow) bool {
@@ -20,7 +66,466 @@ func containsValidOCMAnnotations(workflow argov1alpha1.Workflow) bool {
 	return ok && len(namespace) > 0
 }
 
+// generateHubWorkflowStatusResultName returns the WorkflowStatusResult name for a given workflow.
+// It uses the Workflow name with the suffix of the first 5 characters of the hub Workflow UID,
+// which matches the ManifestWork name on the hub. Falls back to the managed cluster Workflow UID.
 func generateHubWorkflowStatusResultName(workflow argov1alpha1.Workflow) string {
-	uid := string(workflow.UID)
+	uid := workflow.GetAnnotations()[workflowcontroller.AnnotationKeyHubWorkflowUID]
+	if len(uid) < 5 {
+		uid = string(workflow.UID)
+	}
 	return workflow.Name + "-" + uid[0:5]
 }
+
+// populateWorkflowStatusResult sets the WorkflowStatusResult to the current managed cluster Workflow status,
+// the sequence increases with every sync so the hub can reject the results that arrive out of order
+func populateWorkflowStatusResult(result *workflowv1alpha2.WorkflowStatusResult, workflow argov1alpha1.Workflow, clusterName string) {
+	annos := workflow.GetAnnotations()
+	result.Spec = workflowv1alpha2.WorkflowStatusResultSpec{
+		HubWorkflowRef: workflowv1alpha2.HubWorkflowReference{
+			Namespace: annos[workflowcontroller.AnnotationKeyHubWorkflowNamespace],
+			Name:      annos[workflowcontroller.AnnotationKeyHubWorkflowName],
+			UID:       types.UID(annos[workflowcontroller.AnnotationKeyHubWorkflowUID]),
+		},
+		ClusterName:             clusterName,
+		WorkflowUID:             workflow.UID,
+		ObservedGeneration:      workflow.Generation,
+		ObservedResourceVersion: workflow.ResourceVersion,
+		SyncedAt:                metav1.Now(),
+		Sequence:                result.Spec.Sequence + 1,
+		Outputs:                 workflowcontroller.SummarizeWorkflowOutputs(workflow.Name, workflow.Status),
+	}
+	result.WorkflowStatus = workflow.Status
+
+	if !workflow.DeletionTimestamp.IsZero() {
+		result.Spec.RemoteDeletionTimestamp = workflow.DeletionTimestamp.DeepCopy()
+		// a Workflow deleted before it completed will never complete
+		if !workflow.Status.Fulfilled() {
+			result.WorkflowStatus.Phase = argov1alpha1.WorkflowError
+			result.WorkflowStatus.Message = "Workflow was deleted on the managed cluster before it completed"
+			result.WorkflowStatus.FinishedAt = *workflow.DeletionTimestamp
+		}
+	}
+}
+
+// isRemoteDeletionAcknowledged returns true if the hub copied the Workflow deletion of the result
+func isRemoteDeletionAcknowledged(result workflowv1alpha2.WorkflowStatusResult) bool {
+	return result.Spec.RemoteDeletionTimestamp != nil &&
+		meta.IsStatusConditionTrue(result.Status.Conditions, workflowv1alpha2.ConditionTypeRemoteDeleted)
+}
+
+// findWorkflowByHubReference returns the managed cluster Workflow propagated from the referenced hub Workflow, nil if none
+func findWorkflowByHubReference(workflows []argov1alpha1.Workflow, ref workflowv1alpha2.HubWorkflowReference) *argov1alpha1.Workflow {
+	for i := range workflows {
+		annos := workflows[i].GetAnnotations()
+		if annos[workflowcontroller.AnnotationKeyHubWorkflowNamespace] != ref.Namespace ||
+			annos[workflowcontroller.AnnotationKeyHubWorkflowName] != ref.Name {
+			continue
+		}
+		if len(ref.UID) > 0 && annos[workflowcontroller.AnnotationKeyHubWorkflowUID] != string(ref.UID) {
+			continue
+		}
+		return &workflows[i]
+	}
+	return nil
+}
+
+// selectWorkflowPods returns the Workflow pods of the node, or all of them without a node ID, sorted by name
+func selectWorkflowPods(pods []corev1.Pod, nodeID string) []corev1.Pod {
+	selected := []corev1.Pod{}
+	for _, pod := range pods {
+		if len(nodeID) == 0 || pod.Annotations[annotationKeyNodeID] == nodeID {
+			selected = append(selected, pod)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Name < selected[j].Name
+	})
+	return selected
+}
+
+// isPodContainerStarted returns true if the pod container started at least once, the container of a pending pod has no logs yet
+func isPodContainerStarted(pod corev1.Pod, container string) bool {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name == container {
+			return status.State.Running != nil || status.State.Terminated != nil || status.LastTerminationState.Terminated != nil
+		}
+	}
+	return false
+}
+
+// getPodLogOptions returns the pod log options of the request, the tail of the logs is fetched by default
+func getPodLogOptions(spec workflowv1alpha2.WorkflowLogRequestSpec) *corev1.PodLogOptions {
+	options := &corev1.PodLogOptions{
+		Container:    spec.Container,
+		TailLines:    spec.TailLines,
+		SinceSeconds: spec.SinceSeconds,
+		LimitBytes:   spec.LimitBytes,
+	}
+	if len(options.Container) == 0 {
+		options.Container = defaultLogContainer
+	}
+	if options.TailLines == nil && options.LimitBytes == nil {
+		tailLines := defaultLogTailLines
+		options.TailLines = &tailLines
+	}
+	return options
+}
+
+// isWorkflowLogRequestCompleted returns true if the request has its final logs or failed
+func isWorkflowLogRequestCompleted(logRequest workflowv1alpha2.WorkflowLogRequest) bool {
+	return logRequest.Status.Phase == workflowv1alpha2.WorkflowLogRequestSucceeded ||
+		logRequest.Status.Phase == workflowv1alpha2.WorkflowLogRequestFailed
+}
+
+// isWorkflowEventCandidate returns true if the Event is about a Workflow, or a Warning about a pod that might belong to one.
+// The Normal pod Events, e.g. image pulled and container started, are left out of the hub summary.
+func isWorkflowEventCandidate(ev corev1.Event) bool {
+	switch ev.InvolvedObject.Kind {
+	case "Workflow":
+		return strings.HasPrefix(ev.InvolvedObject.APIVersion, argov1alpha1.SchemeGroupVersion.Group+"/")
+	case "Pod":
+		return ev.Type == corev1.EventTypeWarning
+	}
+	return false
+}
+
+// getEventLastTime returns when the Event last occurred
+func getEventLastTime(ev corev1.Event) time.Time {
+	switch {
+	case ev.Series != nil && !ev.Series.LastObservedTime.IsZero():
+		return ev.Series.LastObservedTime.Time
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	}
+	return ev.CreationTimestamp.Time
+}
+
+// summarizeEventMessage returns the Event message prefixed with the pod it is about, truncated to fit the hub Event
+func summarizeEventMessage(ev corev1.Event) string {
+	message := ev.Message
+	if ev.InvolvedObject.Kind == "Pod" {
+		message = "Pod " + ev.InvolvedObject.Name + ": " + message
+	}
+	if len(message) > maxEventMessageSize {
+		message = message[:maxEventMessageSize-3] + "..."
+	}
+	return message
+}
+
+// truncateLogs keeps the end of the logs when they are larger than the given size
+func truncateLogs(content string, size int) string {
+	if len(content) <= size {
+		return content
+	}
+	return content[len(content)-size:]
+}
+
+// hasStatusSyncFinalizer returns true if the Workflow deletion waits for its final status to be synced
+func hasStatusSyncFinalizer(workflow argov1alpha1.Workflow) bool {
+	for _, finalizer := range workflow.Finalizers {
+		if finalizer == finalizerStatusSync {
+			return true
+		}
+	}
+	return false
+}
+
+// isFinalizerTimedOut returns true if the Workflow has been deleted for longer than the timeout,
+// its final status sync is given up on then. A zero timeout never times out.
+func isFinalizerTimedOut(workflow argov1alpha1.Workflow, timeout time.Duration, now time.Time) bool {
+	return timeout > 0 && !workflow.DeletionTimestamp.IsZero() && now.Sub(workflow.DeletionTimestamp.Time) > timeout
+}
+
+// getSyncDelay returns how long the Workflow status sync waits for more changes in the batched sync mode,
+// zero to sync right away. The first change after the sync interval and the completed Workflows are synced right away.
+func getSyncDelay(syncMode string, syncInterval time.Duration, lastSynced, now time.Time, workflow argov1alpha1.Workflow) time.Duration {
+	if syncMode != SyncModeBatched || lastSynced.IsZero() || workflow.Status.Fulfilled() {
+		return 0
+	}
+
+	if delay := lastSynced.Add(syncInterval).Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// getWorkflowStatusResultDrift returns the Workflows whose WorkflowStatusResult is missing or older than the Workflow,
+// and the WorkflowStatusResults whose Workflow no longer exists
+func getWorkflowStatusResultDrift(workflows []argov1alpha1.Workflow,
+	results []workflowv1alpha2.WorkflowStatusResult) ([]argov1alpha1.Workflow, []workflowv1alpha2.WorkflowStatusResult) {
+	resultsByName := map[string]workflowv1alpha2.WorkflowStatusResult{}
+	for _, result := range results {
+		resultsByName[result.Name] = result
+	}
+
+	expected := map[string]bool{}
+	outdated := []argov1alpha1.Workflow{}
+	for _, workflow := range workflows {
+		if !containsValidOCMAnnotations(workflow) {
+			continue
+		}
+
+		name := generateHubWorkflowStatusResultName(workflow)
+		expected[name] = true
+		result, ok := resultsByName[name]
+		if !ok || result.Spec.WorkflowUID != workflow.UID || result.Spec.ObservedResourceVersion != workflow.ResourceVersion {
+			outdated = append(outdated, workflow)
+		}
+	}
+
+	orphaned := []workflowv1alpha2.WorkflowStatusResult{}
+	for _, result := range results {
+		// the result of a Workflow deleted on the managed cluster is kept by the hub on purpose
+		if !expected[result.Name] && result.Spec.RemoteDeletionTimestamp == nil {
+			orphaned = append(orphaned, result)
+		}
+	}
+
+	return outdated, orphaned
+}
+
+// getDefaultArtifactRepository returns the default artifact repository of the Argo controller configuration,
+// either its artifactRepository key or the artifactRepository of its whole config key, nil if it has none
+func getDefaultArtifactRepository(configMap corev1.ConfigMap) (*argov1alpha1.ArtifactRepository, error) {
+	value, ok := configMap.Data["artifactRepository"]
+	if !ok {
+		config := struct {
+			ArtifactRepository *argov1alpha1.ArtifactRepository `json:"artifactRepository,omitempty"`
+		}{}
+		if err := yaml.Unmarshal([]byte(configMap.Data["config"]), &config); err != nil {
+			return nil, err
+		}
+		return config.ArtifactRepository, nil
+	}
+
+	repository := &argov1alpha1.ArtifactRepository{}
+	if err := yaml.Unmarshal([]byte(value), repository); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// qualifyArtifactLocations completes the key-only artifact locations of the Workflow status with the artifact repository
+// the managed cluster Argo controller stored them in, so the hub can download the artifacts with the full bucket and key
+func qualifyArtifactLocations(status *argov1alpha1.WorkflowStatus, repository *argov1alpha1.ArtifactRepository) error {
+	location := repository.ToArtifactLocation()
+	if location == nil {
+		return nil
+	}
+
+	if len(status.CompressedNodes) > 0 {
+		nodes, err := workflowcontroller.DecompressNodes(status.CompressedNodes)
+		if err != nil {
+			return err
+		}
+		status.Nodes = nodes
+		status.CompressedNodes = ""
+	}
+
+	for id, node := range status.Nodes {
+		if node.Inputs != nil {
+			if err := qualifyArtifactList(node.Inputs.Artifacts, location); err != nil {
+				return err
+			}
+		}
+		if node.Outputs != nil {
+			if err := qualifyArtifactList(node.Outputs.Artifacts, location); err != nil {
+				return err
+			}
+		}
+		status.Nodes[id] = node
+	}
+
+	if status.Outputs != nil {
+		return qualifyArtifactList(status.Outputs.Artifacts, location)
+	}
+	return nil
+}
+
+// qualifyArtifactList relocates the artifacts that only have a key to the repository location,
+// the artifacts with a full location or without a key (raw, git, http) are left as they are
+func qualifyArtifactList(artifacts argov1alpha1.Artifacts, location *argov1alpha1.ArtifactLocation) error {
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		if artifact.HasLocation() || !artifact.HasKey() {
+			continue
+		}
+		if err := artifact.Relocate(location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packWorkflowStatusResult compresses the node status of the WorkflowStatusResult when it is too large for a single object,
+// returns the chunks the compressed node status is split into when it is still too large
+func packWorkflowStatusResult(result *workflowv1alpha2.WorkflowStatusResult) ([]string, error) {
+	if _, err := workflowcontroller.CompressNodeStatusIfNeeded(&result.WorkflowStatus); err != nil {
+		return nil, err
+	}
+
+	compressedNodes := result.WorkflowStatus.CompressedNodes
+	if len(compressedNodes) <= workflowcontroller.NodeStatusChunkSize {
+		return nil, nil
+	}
+
+	chunks := []string{}
+	for len(compressedNodes) > 0 {
+		size := workflowcontroller.NodeStatusChunkSize
+		if len(compressedNodes) < size {
+			size = len(compressedNodes)
+		}
+		chunks = append(chunks, compressedNodes[:size])
+		compressedNodes = compressedNodes[size:]
+	}
+
+	result.WorkflowStatus.CompressedNodes = ""
+	result.Spec.NodeStatusChunks = int32(len(chunks))
+	return chunks, nil
+}
+
+// getPendingAction returns the action requested by the hub Workflow that was not applied yet,
+// the applied action is recorded as "<action>/<action ID>"
+func getPendingAction(workflow argov1alpha1.Workflow) (string, bool) {
+	annos := workflow.GetAnnotations()
+	action := annos[workflowcontroller.AnnotationKeyOCMAction]
+	if len(action) == 0 {
+		return "", false
+	}
+
+	return action, annos[workflowcontroller.AnnotationKeyOCMAppliedAction] != generateAppliedAction(workflow)
+}
+
+// generateAppliedAction returns the value that records the requested action as applied
+func generateAppliedAction(workflow argov1alpha1.Workflow) string {
+	annos := workflow.GetAnnotations()
+	return annos[workflowcontroller.AnnotationKeyOCMAction] + "/" + annos[workflowcontroller.AnnotationKeyOCMActionID]
+}
+
+// matchNode returns true if the node matches the node field selector
+func matchNode(selector fields.Selector, node argov1alpha1.NodeStatus) bool {
+	return selector.Matches(fields.Set{
+		"id":           node.ID,
+		"name":         node.Name,
+		"displayName":  node.DisplayName,
+		"templateName": node.TemplateName,
+		"phase":        string(node.Phase),
+		"type":         string(node.Type),
+	})
+}
+
+// isGroupNode returns true if the node only groups other nodes and does not run a pod itself
+func isGroupNode(node argov1alpha1.NodeStatus) bool {
+	switch node.Type {
+	case argov1alpha1.NodeTypeSteps, argov1alpha1.NodeTypeStepGroup, argov1alpha1.NodeTypeDAG,
+		argov1alpha1.NodeTypeTaskGroup, argov1alpha1.NodeTypeRetry:
+		return true
+	}
+	return false
+}
+
+// retryWorkflow resets the status of a Failed or Error Workflow so the Argo controller runs it again,
+// the same way `argo retry` does. The failed nodes are removed while their group nodes are set back to Running,
+// with restartSuccessful the succeeded nodes matching the node field selector, and their descendants, are removed as well.
+// It returns the IDs of the removed nodes so their pods can be deleted.
+func retryWorkflow(workflow *argov1alpha1.Workflow, nodeFieldSelector string, restartSuccessful bool) ([]string, error) {
+	switch workflow.Status.Phase {
+	case argov1alpha1.WorkflowFailed, argov1alpha1.WorkflowError:
+	default:
+		return nil, fmt.Errorf("workflow must be Failed/Error to retry, not %q", workflow.Status.Phase)
+	}
+
+	selector, err := fields.ParseSelector(nodeFieldSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	// the succeeded nodes to restart along with all their descendants
+	restart := map[string]bool{}
+	if restartSuccessful && len(nodeFieldSelector) > 0 {
+		queue := []string{}
+		for id, node := range workflow.Status.Nodes {
+			if node.Phase == argov1alpha1.NodeSucceeded && matchNode(selector, node) {
+				queue = append(queue, id)
+			}
+		}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if restart[id] {
+				continue
+			}
+			restart[id] = true
+			queue = append(queue, workflow.Status.Nodes[id].Children...)
+		}
+	}
+
+	now := metav1.Now()
+	nodes := argov1alpha1.Nodes{}
+	removed := []string{}
+	for id, node := range workflow.Status.Nodes {
+		switch {
+		case !restart[id] && (node.Phase == argov1alpha1.NodeSucceeded || node.Phase == argov1alpha1.NodeSkipped):
+			nodes[id] = node
+		case isGroupNode(node) && !strings.Contains(node.Name, ".onExit"):
+			node.Phase = argov1alpha1.NodeRunning
+			node.Message = ""
+			node.StartedAt = now
+			node.FinishedAt = metav1.Time{}
+			nodes[id] = node
+		default:
+			removed = append(removed, id)
+		}
+	}
+
+	// the kept nodes no longer reference the removed children
+	for id, node := range nodes {
+		children := []string{}
+		for _, child := range node.Children {
+			if _, ok := nodes[child]; ok {
+				children = append(children, child)
+			}
+		}
+		node.Children = children
+		nodes[id] = node
+	}
+
+	workflow.Status.Nodes = nodes
+	workflow.Status.Phase = argov1alpha1.WorkflowRunning
+	workflow.Status.Message = ""
+	workflow.Status.FinishedAt = metav1.Time{}
+	workflow.Status.Conditions.RemoveCondition(argov1alpha1.ConditionTypeCompleted)
+	if workflow.Labels == nil {
+		workflow.Labels = map[string]string{}
+	}
+	workflow.Labels[labelKeyCompleted] = "false"
+	workflow.Labels[labelKeyPhase] = string(argov1alpha1.WorkflowRunning)
+
+	return removed, nil
+}
+
+// resumeWorkflow marks the running suspend nodes matching the node field selector as Succeeded,
+// the same way `argo resume` does. A suspended Workflow is resumed by removing `spec.suspend` on the hub Workflow.
+func resumeWorkflow(workflow *argov1alpha1.Workflow, nodeFieldSelector string) error {
+	selector, err := fields.ParseSelector(nodeFieldSelector)
+	if err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	for id, node := range workflow.Status.Nodes {
+		if !node.IsActiveSuspendNode() || !matchNode(selector, node) {
+			continue
+		}
+		node.Phase = argov1alpha1.NodeSucceeded
+		node.Message = "Resumed from the hub cluster"
+		node.FinishedAt = now
+		workflow.Status.Nodes[id] = node
+	}
+
+	return nil
+}
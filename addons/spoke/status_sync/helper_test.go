@@ -17,10 +17,19 @@ limitations under the License.
 package status_sync
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 	workflowcontroller "open-cluster-management.io/argo-workflow-multicluster/controllers/workflow"
 )
 
@@ -112,6 +121,19 @@ func Test_generateHubWorkflowStatusResultName(t *testing.T) {
 			},
 			want: "workflow1-abcde",
 		},
+		{
+			name: "generate name from hub UID",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Name:        "workflow1",
+						UID:         "abcde",
+						Annotations: map[string]string{workflowcontroller.AnnotationKeyHubWorkflowUID: "fghijklmn"},
+					},
+				},
+			},
+			want: "workflow1-fghij",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -121,3 +143,787 @@ func Test_generateHubWorkflowStatusResultName(t *testing.T) {
 		})
 	}
 }
+
+func Test_populateWorkflowStatusResult(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "workflow1",
+			UID:             "remote",
+			Generation:      4,
+			ResourceVersion: "1234",
+			Annotations: map[string]string{
+				workflowcontroller.AnnotationKeyHubWorkflowNamespace: "default",
+				workflowcontroller.AnnotationKeyHubWorkflowName:      "hello",
+				workflowcontroller.AnnotationKeyHubWorkflowUID:       "hub",
+			},
+		},
+		Status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowRunning},
+	}
+
+	result := workflowv1alpha2.WorkflowStatusResult{}
+	populateWorkflowStatusResult(&result, workflow, "cluster1")
+	populateWorkflowStatusResult(&result, workflow, "cluster1")
+
+	want := workflowv1alpha2.WorkflowStatusResultSpec{
+		HubWorkflowRef:          workflowv1alpha2.HubWorkflowReference{Namespace: "default", Name: "hello", UID: "hub"},
+		ClusterName:             "cluster1",
+		WorkflowUID:             "remote",
+		ObservedGeneration:      4,
+		ObservedResourceVersion: "1234",
+		SyncedAt:                result.Spec.SyncedAt,
+		Sequence:                2,
+	}
+	if !reflect.DeepEqual(result.Spec, want) {
+		t.Errorf("populateWorkflowStatusResult() spec = %v, want %v", result.Spec, want)
+	}
+	if result.Spec.SyncedAt.IsZero() || result.WorkflowStatus.Phase != argov1alpha1.WorkflowRunning {
+		t.Errorf("populateWorkflowStatusResult() = %v", result)
+	}
+
+	deletionTimestamp := v1.Now()
+	workflow.DeletionTimestamp = &deletionTimestamp
+	populateWorkflowStatusResult(&result, workflow, "cluster1")
+	if result.Spec.RemoteDeletionTimestamp == nil || result.WorkflowStatus.Phase != argov1alpha1.WorkflowError ||
+		!result.WorkflowStatus.FinishedAt.Equal(&deletionTimestamp) {
+		t.Errorf("populateWorkflowStatusResult() of a deleted running Workflow = %v", result)
+	}
+
+	workflow.Status.Phase = argov1alpha1.WorkflowSucceeded
+	populateWorkflowStatusResult(&result, workflow, "cluster1")
+	if result.Spec.RemoteDeletionTimestamp == nil || result.WorkflowStatus.Phase != argov1alpha1.WorkflowSucceeded {
+		t.Errorf("populateWorkflowStatusResult() of a deleted completed Workflow = %v", result)
+	}
+}
+
+func Test_isRemoteDeletionAcknowledged(t *testing.T) {
+	deletionTimestamp := v1.Now()
+	remoteDeleted := []v1.Condition{{Type: workflowv1alpha2.ConditionTypeRemoteDeleted, Status: v1.ConditionTrue}}
+	tests := []struct {
+		name   string
+		result workflowv1alpha2.WorkflowStatusResult
+		want   bool
+	}{
+		{
+			name: "acknowledged",
+			result: workflowv1alpha2.WorkflowStatusResult{
+				Spec:   workflowv1alpha2.WorkflowStatusResultSpec{RemoteDeletionTimestamp: &deletionTimestamp},
+				Status: workflowv1alpha2.WorkflowStatusResultStatus{Conditions: remoteDeleted},
+			},
+			want: true,
+		},
+		{
+			name: "deletion not copied yet",
+			result: workflowv1alpha2.WorkflowStatusResult{
+				Spec: workflowv1alpha2.WorkflowStatusResultSpec{RemoteDeletionTimestamp: &deletionTimestamp},
+			},
+			want: false,
+		},
+		{
+			name: "deletion not synced",
+			result: workflowv1alpha2.WorkflowStatusResult{
+				Status: workflowv1alpha2.WorkflowStatusResultStatus{Conditions: remoteDeleted},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRemoteDeletionAcknowledged(tt.result); got != tt.want {
+				t.Errorf("isRemoteDeletionAcknowledged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isFinalizerTimedOut(t *testing.T) {
+	now := time.Date(2023, 1, 1, 1, 0, 0, 0, time.UTC)
+	deleted := func(ago time.Duration) argov1alpha1.Workflow {
+		deletionTimestamp := v1.NewTime(now.Add(-ago))
+		return argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{DeletionTimestamp: &deletionTimestamp}}
+	}
+	tests := []struct {
+		name     string
+		workflow argov1alpha1.Workflow
+		timeout  time.Duration
+		want     bool
+	}{
+		{"not deleted", argov1alpha1.Workflow{}, time.Hour, false},
+		{"deleted within the timeout", deleted(time.Minute), time.Hour, false},
+		{"deleted for longer than the timeout", deleted(2 * time.Hour), time.Hour, true},
+		{"no timeout", deleted(2 * time.Hour), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFinalizerTimedOut(tt.workflow, tt.timeout, now); got != tt.want {
+				t.Errorf("isFinalizerTimedOut() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getSyncDelay(t *testing.T) {
+	now := time.Now()
+	running := argov1alpha1.Workflow{Status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowRunning}}
+	succeeded := argov1alpha1.Workflow{Status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowSucceeded}}
+	tests := []struct {
+		name       string
+		syncMode   string
+		lastSynced time.Time
+		workflow   argov1alpha1.Workflow
+		want       time.Duration
+	}{
+		{
+			name:       "immediate sync mode",
+			syncMode:   SyncModeImmediate,
+			lastSynced: now.Add(-time.Second),
+			workflow:   running,
+			want:       0,
+		},
+		{
+			name:     "never synced",
+			syncMode: SyncModeBatched,
+			workflow: running,
+			want:     0,
+		},
+		{
+			name:       "synced within the interval",
+			syncMode:   SyncModeBatched,
+			lastSynced: now.Add(-time.Second),
+			workflow:   running,
+			want:       4 * time.Second,
+		},
+		{
+			name:       "synced before the interval",
+			syncMode:   SyncModeBatched,
+			lastSynced: now.Add(-time.Minute),
+			workflow:   running,
+			want:       0,
+		},
+		{
+			name:       "completed Workflow",
+			syncMode:   SyncModeBatched,
+			lastSynced: now.Add(-time.Second),
+			workflow:   succeeded,
+			want:       0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getSyncDelay(tt.syncMode, 5*time.Second, tt.lastSynced, now, tt.workflow); got != tt.want {
+				t.Errorf("getSyncDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getWorkflowStatusResultDrift(t *testing.T) {
+	newWorkflow := func(name, uid, resourceVersion string) argov1alpha1.Workflow {
+		return argov1alpha1.Workflow{
+			ObjectMeta: v1.ObjectMeta{
+				Name:            name,
+				UID:             types.UID(uid),
+				ResourceVersion: resourceVersion,
+				Annotations: map[string]string{
+					workflowcontroller.AnnotationKeyHubWorkflowName:      name,
+					workflowcontroller.AnnotationKeyHubWorkflowNamespace: "default",
+					workflowcontroller.AnnotationKeyHubWorkflowUID:       uid + "-hub",
+				},
+			},
+		}
+	}
+	newResult := func(name, uid, resourceVersion string) workflowv1alpha2.WorkflowStatusResult {
+		return workflowv1alpha2.WorkflowStatusResult{
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Spec:       workflowv1alpha2.WorkflowStatusResultSpec{WorkflowUID: types.UID(uid), ObservedResourceVersion: resourceVersion},
+		}
+	}
+
+	workflows := []argov1alpha1.Workflow{
+		newWorkflow("synced", "aaaaa", "1"),
+		newWorkflow("outdated", "bbbbb", "2"),
+		newWorkflow("missing", "ccccc", "1"),
+		newWorkflow("recreated", "ddddd", "1"),
+		{ObjectMeta: v1.ObjectMeta{Name: "not-ocm", UID: "eeeee"}},
+	}
+	results := []workflowv1alpha2.WorkflowStatusResult{
+		newResult("synced-aaaaa", "aaaaa", "1"),
+		newResult("outdated-bbbbb", "bbbbb", "1"),
+		newResult("recreated-ddddd", "zzzzz", "1"),
+		newResult("deleted-fffff", "fffff", "1"),
+		newResult("remote-deleted-ggggg", "ggggg", "1"),
+	}
+	deletionTimestamp := v1.Now()
+	results[4].Spec.RemoteDeletionTimestamp = &deletionTimestamp
+
+	outdated, orphaned := getWorkflowStatusResultDrift(workflows, results)
+	outdatedNames := []string{}
+	for _, workflow := range outdated {
+		outdatedNames = append(outdatedNames, workflow.Name)
+	}
+	if want := []string{"outdated", "missing", "recreated"}; !reflect.DeepEqual(outdatedNames, want) {
+		t.Errorf("getWorkflowStatusResultDrift() outdated = %v, want %v", outdatedNames, want)
+	}
+	if len(orphaned) != 1 || orphaned[0].Name != "deleted-fffff" {
+		t.Errorf("getWorkflowStatusResultDrift() orphaned = %v, want deleted-fffff", orphaned)
+	}
+}
+
+func Test_packWorkflowStatusResult(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	generateNodes := func(count, messageSize int) argov1alpha1.Nodes {
+		nodes := argov1alpha1.Nodes{}
+		for i := 0; i < count; i++ {
+			message := make([]byte, messageSize)
+			random.Read(message)
+			id := fmt.Sprintf("hello-%d", i)
+			nodes[id] = argov1alpha1.NodeStatus{ID: id, Message: fmt.Sprintf("%x", message)}
+		}
+		return nodes
+	}
+
+	tests := []struct {
+		name           string
+		nodes          argov1alpha1.Nodes
+		wantNodes      bool
+		wantCompressed bool
+		wantChunks     int
+	}{
+		{
+			name:      "small node status",
+			nodes:     generateNodes(10, 10),
+			wantNodes: true,
+		},
+		{
+			name:           "compressed node status",
+			nodes:          generateNodes(1000, 600),
+			wantCompressed: true,
+		},
+		{
+			name:       "chunked node status",
+			nodes:      generateNodes(1000, 1000),
+			wantChunks: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := workflowv1alpha2.WorkflowStatusResult{
+				WorkflowStatus: argov1alpha1.WorkflowStatus{Nodes: tt.nodes},
+			}
+			chunks, err := packWorkflowStatusResult(&result)
+			if err != nil {
+				t.Fatalf("packWorkflowStatusResult() error = %v", err)
+			}
+			if (len(result.WorkflowStatus.Nodes) > 0) != tt.wantNodes ||
+				(len(result.WorkflowStatus.CompressedNodes) > 0) != tt.wantCompressed {
+				t.Errorf("packWorkflowStatusResult() nodes = %v, compressed nodes = %v", len(result.WorkflowStatus.Nodes),
+					len(result.WorkflowStatus.CompressedNodes))
+			}
+			if len(chunks) != tt.wantChunks || result.Spec.NodeStatusChunks != int32(tt.wantChunks) {
+				t.Errorf("packWorkflowStatusResult() chunks = %v, want %v", len(chunks), tt.wantChunks)
+			}
+
+			if len(chunks) > 0 {
+				compressedNodes := ""
+				for _, chunk := range chunks {
+					compressedNodes += chunk
+				}
+				nodes, err := workflowcontroller.DecompressNodes(compressedNodes)
+				if err != nil || !reflect.DeepEqual(nodes, tt.nodes) {
+					t.Errorf("packWorkflowStatusResult() chunks do not restore the nodes, error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_getDefaultArtifactRepository(t *testing.T) {
+	repository := &argov1alpha1.ArtifactRepository{
+		S3: &argov1alpha1.S3ArtifactRepository{
+			S3Bucket: argov1alpha1.S3Bucket{Endpoint: "minio:9000", Bucket: "my-bucket"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		configMap corev1.ConfigMap
+		want      *argov1alpha1.ArtifactRepository
+		wantErr   bool
+	}{
+		{
+			name: "artifactRepository key",
+			configMap: corev1.ConfigMap{Data: map[string]string{
+				"artifactRepository": "s3:\n  endpoint: minio:9000\n  bucket: my-bucket\n",
+				"parallelism":        "10",
+			}},
+			want: repository,
+		},
+		{
+			name: "config key",
+			configMap: corev1.ConfigMap{Data: map[string]string{
+				"config": "parallelism: 10\nartifactRepository:\n  s3:\n    endpoint: minio:9000\n    bucket: my-bucket\n",
+			}},
+			want: repository,
+		},
+		{
+			name:      "no default repository",
+			configMap: corev1.ConfigMap{Data: map[string]string{"parallelism": "10"}},
+			want:      nil,
+		},
+		{
+			name:      "invalid repository",
+			configMap: corev1.ConfigMap{Data: map[string]string{"artifactRepository": "s3: ["}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getDefaultArtifactRepository(tt.configMap)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getDefaultArtifactRepository() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getDefaultArtifactRepository() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_qualifyArtifactLocations(t *testing.T) {
+	repository := &argov1alpha1.ArtifactRepository{
+		S3: &argov1alpha1.S3ArtifactRepository{
+			S3Bucket: argov1alpha1.S3Bucket{Endpoint: "minio:9000", Bucket: "my-bucket"},
+		},
+	}
+	keyOnly := func(name, key string) argov1alpha1.Artifact {
+		return argov1alpha1.Artifact{Name: name, ArtifactLocation: argov1alpha1.ArtifactLocation{
+			S3: &argov1alpha1.S3Artifact{Key: key},
+		}}
+	}
+	qualified := func(name, bucket, key string) argov1alpha1.Artifact {
+		return argov1alpha1.Artifact{Name: name, ArtifactLocation: argov1alpha1.ArtifactLocation{
+			S3: &argov1alpha1.S3Artifact{S3Bucket: argov1alpha1.S3Bucket{Endpoint: "minio:9000", Bucket: bucket}, Key: key},
+		}}
+	}
+	raw := argov1alpha1.Artifact{Name: "raw", ArtifactLocation: argov1alpha1.ArtifactLocation{
+		Raw: &argov1alpha1.RawArtifact{Data: "hello"},
+	}}
+	nodes := func(inputs, outputs argov1alpha1.Artifacts) argov1alpha1.Nodes {
+		return argov1alpha1.Nodes{"hello": argov1alpha1.NodeStatus{
+			ID:      "hello",
+			Inputs:  &argov1alpha1.Inputs{Artifacts: inputs},
+			Outputs: &argov1alpha1.Outputs{Artifacts: outputs},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		status     argov1alpha1.WorkflowStatus
+		compressed bool
+		want       argov1alpha1.WorkflowStatus
+	}{
+		{
+			name:   "key-only artifacts",
+			status: argov1alpha1.WorkflowStatus{Nodes: nodes(argov1alpha1.Artifacts{keyOnly("in", "hello/in.tgz")}, argov1alpha1.Artifacts{keyOnly("out", "hello/out.tgz")})},
+			want: argov1alpha1.WorkflowStatus{Nodes: nodes(argov1alpha1.Artifacts{qualified("in", "my-bucket", "hello/in.tgz")},
+				argov1alpha1.Artifacts{qualified("out", "my-bucket", "hello/out.tgz")})},
+		},
+		{
+			name:   "full location and raw artifacts",
+			status: argov1alpha1.WorkflowStatus{Nodes: nodes(argov1alpha1.Artifacts{raw}, argov1alpha1.Artifacts{qualified("out", "other-bucket", "hello/out.tgz")})},
+			want:   argov1alpha1.WorkflowStatus{Nodes: nodes(argov1alpha1.Artifacts{raw}, argov1alpha1.Artifacts{qualified("out", "other-bucket", "hello/out.tgz")})},
+		},
+		{
+			name:       "compressed node status",
+			status:     argov1alpha1.WorkflowStatus{Nodes: nodes(nil, argov1alpha1.Artifacts{keyOnly("out", "hello/out.tgz")})},
+			compressed: true,
+			want:       argov1alpha1.WorkflowStatus{Nodes: nodes(nil, argov1alpha1.Artifacts{qualified("out", "my-bucket", "hello/out.tgz")})},
+		},
+		{
+			name: "workflow outputs",
+			status: argov1alpha1.WorkflowStatus{
+				Outputs: &argov1alpha1.Outputs{Artifacts: argov1alpha1.Artifacts{keyOnly("out", "hello/out.tgz")}},
+			},
+			want: argov1alpha1.WorkflowStatus{
+				Outputs: &argov1alpha1.Outputs{Artifacts: argov1alpha1.Artifacts{qualified("out", "my-bucket", "hello/out.tgz")}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if tt.compressed {
+				compressedNodes, err := workflowcontroller.CompressNodes(status.Nodes)
+				if err != nil {
+					t.Fatalf("CompressNodes() error = %v", err)
+				}
+				status = argov1alpha1.WorkflowStatus{CompressedNodes: compressedNodes}
+			}
+			if err := qualifyArtifactLocations(&status, repository); err != nil {
+				t.Fatalf("qualifyArtifactLocations() error = %v", err)
+			}
+			if !reflect.DeepEqual(status, tt.want) {
+				t.Errorf("qualifyArtifactLocations() = %v, want %v", status, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isPodContainerStarted(t *testing.T) {
+	pod := func(statuses ...corev1.ContainerStatus) corev1.Pod {
+		return corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: statuses}}
+	}
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want bool
+	}{
+		{
+			name: "pending pod",
+			pod:  corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			want: false,
+		},
+		{
+			name: "container creating",
+			pod: pod(corev1.ContainerStatus{Name: "main", State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"},
+			}}),
+			want: false,
+		},
+		{
+			name: "running container",
+			pod:  pod(corev1.ContainerStatus{Name: "main", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}),
+			want: true,
+		},
+		{
+			name: "restarting container",
+			pod: pod(corev1.ContainerStatus{Name: "main",
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+			}),
+			want: true,
+		},
+		{
+			name: "another container started",
+			pod:  pod(corev1.ContainerStatus{Name: "wait", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPodContainerStarted(tt.pod, "main"); got != tt.want {
+				t.Errorf("isPodContainerStarted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findWorkflowByHubReference(t *testing.T) {
+	newWorkflow := func(name, hubName, hubUID string) argov1alpha1.Workflow {
+		return argov1alpha1.Workflow{
+			ObjectMeta: v1.ObjectMeta{
+				Name: name,
+				Annotations: map[string]string{
+					workflowcontroller.AnnotationKeyHubWorkflowNamespace: "default",
+					workflowcontroller.AnnotationKeyHubWorkflowName:      hubName,
+					workflowcontroller.AnnotationKeyHubWorkflowUID:       hubUID,
+				},
+			},
+		}
+	}
+	workflows := []argov1alpha1.Workflow{
+		newWorkflow("hello-old", "hello", "aaaaa"),
+		newWorkflow("hello-new", "hello", "bbbbb"),
+		{ObjectMeta: v1.ObjectMeta{Name: "not-ocm"}},
+	}
+	tests := []struct {
+		name string
+		ref  workflowv1alpha2.HubWorkflowReference
+		want string
+	}{
+		{
+			name: "match by name",
+			ref:  workflowv1alpha2.HubWorkflowReference{Namespace: "default", Name: "hello"},
+			want: "hello-old",
+		},
+		{
+			name: "match by UID",
+			ref:  workflowv1alpha2.HubWorkflowReference{Namespace: "default", Name: "hello", UID: "bbbbb"},
+			want: "hello-new",
+		},
+		{
+			name: "no match",
+			ref:  workflowv1alpha2.HubWorkflowReference{Namespace: "other", Name: "hello"},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if workflow := findWorkflowByHubReference(workflows, tt.ref); workflow != nil {
+				got = workflow.Name
+			}
+			if got != tt.want {
+				t.Errorf("findWorkflowByHubReference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectWorkflowPods(t *testing.T) {
+	newPod := func(name, nodeID string) corev1.Pod {
+		return corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: name, Annotations: map[string]string{annotationKeyNodeID: nodeID}}}
+	}
+	pods := []corev1.Pod{newPod("hello-step2", "node2"), newPod("hello-step1", "node1")}
+
+	names := func(pods []corev1.Pod) []string {
+		names := []string{}
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		return names
+	}
+	if got, want := names(selectWorkflowPods(pods, "")), []string{"hello-step1", "hello-step2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selectWorkflowPods() = %v, want %v", got, want)
+	}
+	if got, want := names(selectWorkflowPods(pods, "node2")), []string{"hello-step2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selectWorkflowPods() = %v, want %v", got, want)
+	}
+}
+
+func Test_getPodLogOptions(t *testing.T) {
+	defaultTailLines := defaultLogTailLines
+	tailLines := int64(10)
+	limitBytes := int64(1024)
+	tests := []struct {
+		name string
+		spec workflowv1alpha2.WorkflowLogRequestSpec
+		want *corev1.PodLogOptions
+	}{
+		{
+			name: "defaults",
+			spec: workflowv1alpha2.WorkflowLogRequestSpec{},
+			want: &corev1.PodLogOptions{Container: defaultLogContainer, TailLines: &defaultTailLines},
+		},
+		{
+			name: "tail lines",
+			spec: workflowv1alpha2.WorkflowLogRequestSpec{Container: "wait", TailLines: &tailLines},
+			want: &corev1.PodLogOptions{Container: "wait", TailLines: &tailLines},
+		},
+		{
+			name: "limit bytes",
+			spec: workflowv1alpha2.WorkflowLogRequestSpec{LimitBytes: &limitBytes},
+			want: &corev1.PodLogOptions{Container: defaultLogContainer, LimitBytes: &limitBytes},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getPodLogOptions(tt.spec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getPodLogOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_truncateLogs(t *testing.T) {
+	if got := truncateLogs("line1\nline2\n", 6); got != "line2\n" {
+		t.Errorf("truncateLogs() = %q, want %q", got, "line2\n")
+	}
+	if got := truncateLogs("line1\n", 10); got != "line1\n" {
+		t.Errorf("truncateLogs() = %q, want %q", got, "line1\n")
+	}
+}
+
+func Test_isWorkflowEventCandidate(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   corev1.Event
+		want bool
+	}{
+		{
+			name: "Workflow event",
+			ev: corev1.Event{
+				Type:           corev1.EventTypeNormal,
+				InvolvedObject: corev1.ObjectReference{Kind: "Workflow", APIVersion: "argoproj.io/v1alpha1"},
+			},
+			want: true,
+		},
+		{
+			name: "pod warning",
+			ev:   corev1.Event{Type: corev1.EventTypeWarning, InvolvedObject: corev1.ObjectReference{Kind: "Pod", APIVersion: "v1"}},
+			want: true,
+		},
+		{
+			name: "pod normal event",
+			ev:   corev1.Event{Type: corev1.EventTypeNormal, InvolvedObject: corev1.ObjectReference{Kind: "Pod", APIVersion: "v1"}},
+			want: false,
+		},
+		{
+			name: "other kind",
+			ev:   corev1.Event{Type: corev1.EventTypeWarning, InvolvedObject: corev1.ObjectReference{Kind: "Node", APIVersion: "v1"}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWorkflowEventCandidate(tt.ev); got != tt.want {
+				t.Errorf("isWorkflowEventCandidate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_summarizeEventMessage(t *testing.T) {
+	ev := corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "hello-step1"},
+		Message:        "Back-off pulling image",
+	}
+	if got, want := summarizeEventMessage(ev), "Pod hello-step1: Back-off pulling image"; got != want {
+		t.Errorf("summarizeEventMessage() = %v, want %v", got, want)
+	}
+
+	ev.Message = strings.Repeat("x", 2*maxEventMessageSize)
+	if got := summarizeEventMessage(ev); len(got) != maxEventMessageSize || !strings.HasSuffix(got, "...") {
+		t.Errorf("summarizeEventMessage() length = %v, want %v", len(got), maxEventMessageSize)
+	}
+}
+
+func Test_getPendingAction(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantAction  string
+		wantPending bool
+	}{
+		{
+			name:        "no action",
+			annotations: map[string]string{},
+			wantAction:  "",
+			wantPending: false,
+		},
+		{
+			name: "pending action",
+			annotations: map[string]string{
+				workflowcontroller.AnnotationKeyOCMAction:        workflowcontroller.ActionRetry,
+				workflowcontroller.AnnotationKeyOCMActionID:      "2",
+				workflowcontroller.AnnotationKeyOCMAppliedAction: "retry/1",
+			},
+			wantAction:  workflowcontroller.ActionRetry,
+			wantPending: true,
+		},
+		{
+			name: "applied action",
+			annotations: map[string]string{
+				workflowcontroller.AnnotationKeyOCMAction:        workflowcontroller.ActionRetry,
+				workflowcontroller.AnnotationKeyOCMActionID:      "2",
+				workflowcontroller.AnnotationKeyOCMAppliedAction: "retry/2",
+			},
+			wantAction:  workflowcontroller.ActionRetry,
+			wantPending: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Annotations: tt.annotations}}
+			gotAction, gotPending := getPendingAction(workflow)
+			if gotAction != tt.wantAction || gotPending != tt.wantPending {
+				t.Errorf("getPendingAction() = %v, %v, want %v, %v", gotAction, gotPending, tt.wantAction, tt.wantPending)
+			}
+		})
+	}
+}
+
+func newRetryWorkflow() argov1alpha1.Workflow {
+	return argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{Name: "workflow1"},
+		Status: argov1alpha1.WorkflowStatus{
+			Phase:   argov1alpha1.WorkflowFailed,
+			Message: "child 'workflow1-2' failed",
+			Nodes: argov1alpha1.Nodes{
+				"workflow1": {ID: "workflow1", Name: "workflow1", Type: argov1alpha1.NodeTypeSteps,
+					Phase: argov1alpha1.NodeFailed, Children: []string{"workflow1-1", "workflow1-2"}},
+				"workflow1-1": {ID: "workflow1-1", Name: "workflow1[0].step1", DisplayName: "step1", Type: argov1alpha1.NodeTypePod,
+					Phase: argov1alpha1.NodeSucceeded},
+				"workflow1-2": {ID: "workflow1-2", Name: "workflow1[1].step2", DisplayName: "step2", Type: argov1alpha1.NodeTypePod,
+					Phase: argov1alpha1.NodeFailed},
+			},
+		},
+	}
+}
+
+func Test_retryWorkflow(t *testing.T) {
+	tests := []struct {
+		name              string
+		phase             argov1alpha1.WorkflowPhase
+		nodeFieldSelector string
+		restartSuccessful bool
+		wantRemoved       []string
+		wantErr           bool
+	}{
+		{
+			name:        "failed nodes",
+			phase:       argov1alpha1.WorkflowFailed,
+			wantRemoved: []string{"workflow1-2"},
+		},
+		{
+			name:              "restart successful",
+			phase:             argov1alpha1.WorkflowFailed,
+			nodeFieldSelector: "displayName=step1",
+			restartSuccessful: true,
+			wantRemoved:       []string{"workflow1-1", "workflow1-2"},
+		},
+		{
+			name:    "running Workflow",
+			phase:   argov1alpha1.WorkflowRunning,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow := newRetryWorkflow()
+			workflow.Status.Phase = tt.phase
+			got, err := retryWorkflow(&workflow, tt.nodeFieldSelector, tt.restartSuccessful)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retryWorkflow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantRemoved) {
+				t.Errorf("retryWorkflow() = %v, want %v", got, tt.wantRemoved)
+			}
+			if workflow.Status.Phase != argov1alpha1.WorkflowRunning || workflow.Labels[labelKeyCompleted] != "false" {
+				t.Errorf("retryWorkflow() phase = %v, labels = %v", workflow.Status.Phase, workflow.Labels)
+			}
+			root := workflow.Status.Nodes["workflow1"]
+			if root.Phase != argov1alpha1.NodeRunning || len(root.Children) != 2-len(tt.wantRemoved) {
+				t.Errorf("retryWorkflow() root node = %v", root)
+			}
+		})
+	}
+}
+
+func Test_resumeWorkflow(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		Status: argov1alpha1.WorkflowStatus{
+			Phase: argov1alpha1.WorkflowRunning,
+			Nodes: argov1alpha1.Nodes{
+				"workflow1-1": {ID: "workflow1-1", DisplayName: "approve", Type: argov1alpha1.NodeTypeSuspend,
+					Phase: argov1alpha1.NodeRunning},
+				"workflow1-2": {ID: "workflow1-2", DisplayName: "wait", Type: argov1alpha1.NodeTypeSuspend,
+					Phase: argov1alpha1.NodeRunning},
+			},
+		},
+	}
+
+	if err := resumeWorkflow(&workflow, "displayName=approve"); err != nil {
+		t.Fatalf("resumeWorkflow() error = %v", err)
+	}
+	if workflow.Status.Nodes["workflow1-1"].Phase != argov1alpha1.NodeSucceeded {
+		t.Errorf("resumeWorkflow() selected node = %v", workflow.Status.Nodes["workflow1-1"])
+	}
+	if workflow.Status.Nodes["workflow1-2"].Phase != argov1alpha1.NodeRunning {
+		t.Errorf("resumeWorkflow() not selected node = %v", workflow.Status.Nodes["workflow1-2"])
+	}
+}
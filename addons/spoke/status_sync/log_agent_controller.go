@@ -0,0 +1,169 @@
+package status_sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// WorkflowLogRequestController fulfils the hub WorkflowLogRequests of the managed cluster
+// with the logs of the managed cluster Workflow pods
+type WorkflowLogRequestController struct {
+	spokeClient     client.Client
+	spokeKubeClient kubernetes.Interface
+	hubClient       client.Client
+	// hubCache watches the WorkflowLogRequests in the managed cluster namespace of the hub
+	hubCache cache.Cache
+	log      logr.Logger
+}
+
+// WorkflowLogRequestPredicateFunctions skips the requests that already have their final logs
+var WorkflowLogRequestPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return !isWorkflowLogRequestCompleted(*e.ObjectNew.(*workflowv1alpha2.WorkflowLogRequest))
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return !isWorkflowLogRequestCompleted(*e.Object.(*workflowv1alpha2.WorkflowLogRequest))
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
+func (c *WorkflowLogRequestController) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("argoworkflow-log").
+		Watches(source.NewKindWithCache(&workflowv1alpha2.WorkflowLogRequest{}, c.hubCache), &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(WorkflowLogRequestPredicateFunctions)).
+		Complete(c)
+}
+
+// Reconcile fetches the logs of the managed cluster Workflow pods selected by the hub WorkflowLogRequest
+// and writes them to the request status. A followed request is fetched again until the Workflow completes.
+func (c *WorkflowLogRequestController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	c.log.Info(fmt.Sprintf("reconciling log request... %s", req))
+	defer c.log.Info(fmt.Sprintf("done reconcile log request %s", req))
+
+	logRequest := workflowv1alpha2.WorkflowLogRequest{}
+	err := c.hubClient.Get(ctx, req.NamespacedName, &logRequest)
+	switch {
+	case errors.IsNotFound(err):
+		return ctrl.Result{}, nil
+	case err != nil:
+		c.log.Error(err, "unable to get hub WorkflowLogRequest")
+		return ctrl.Result{}, err
+	}
+
+	if isWorkflowLogRequestCompleted(logRequest) {
+		return ctrl.Result{}, nil
+	}
+
+	// the managed cluster Workflow has the name and namespace of the hub Workflow
+	ref := logRequest.Spec.HubWorkflowRef
+	workflows := []argov1alpha1.Workflow{{}}
+	err = c.spokeClient.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, &workflows[0])
+	if client.IgnoreNotFound(err) != nil {
+		c.log.Error(err, "unable to get Workflow")
+		return ctrl.Result{}, err
+	}
+	if errors.IsNotFound(err) {
+		workflows = nil
+	}
+
+	workflow := findWorkflowByHubReference(workflows, ref)
+	if workflow == nil {
+		return ctrl.Result{}, c.patchStatus(ctx, logRequest, workflowv1alpha2.WorkflowLogRequestStatus{
+			Phase:   workflowv1alpha2.WorkflowLogRequestFailed,
+			Message: "Workflow " + ref.Namespace + "/" + ref.Name + " not found on the managed cluster",
+		})
+	}
+
+	pods := corev1.PodList{}
+	if err := c.spokeClient.List(ctx, &pods, client.InNamespace(workflow.Namespace),
+		client.MatchingLabels{labelKeyWorkflow: workflow.Name}); err != nil {
+		c.log.Error(err, "unable to list Workflow pods")
+		return ctrl.Result{}, err
+	}
+
+	status := workflowv1alpha2.WorkflowLogRequestStatus{Phase: workflowv1alpha2.WorkflowLogRequestSucceeded}
+	selected := selectWorkflowPods(pods.Items, logRequest.Spec.NodeID)
+	options := getPodLogOptions(logRequest.Spec)
+	followable := logRequest.Spec.Follow && !workflow.Status.Fulfilled()
+	pending := []string{}
+	for _, pod := range selected {
+		// the pods that did not start yet, e.g. still pulling their image, are fetched by the next follow
+		if followable && !isPodContainerStarted(pod, options.Container) {
+			pending = append(pending, pod.Name)
+			continue
+		}
+
+		logs, err := c.spokeKubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).DoRaw(ctx)
+		if err != nil {
+			c.log.Error(err, "unable to get the logs of Workflow pod "+pod.Name)
+			status.Phase = workflowv1alpha2.WorkflowLogRequestFailed
+			status.Message = fmt.Sprintf("unable to get the logs of pod %s: %v", pod.Name, err)
+			break
+		}
+
+		status.Logs = append(status.Logs, workflowv1alpha2.PodLog{
+			NodeID:    pod.Annotations[annotationKeyNodeID],
+			PodName:   pod.Name,
+			Container: options.Container,
+			Content:   truncateLogs(string(logs), maxLogRequestSize/len(selected)),
+		})
+	}
+
+	if status.Phase == workflowv1alpha2.WorkflowLogRequestSucceeded && len(selected) == 0 && len(logRequest.Spec.NodeID) > 0 &&
+		workflow.Status.Fulfilled() {
+		status.Phase = workflowv1alpha2.WorkflowLogRequestFailed
+		status.Message = "no pod found for node " + logRequest.Spec.NodeID
+	}
+
+	// the pods of a running Workflow keep logging, and new pods are created for the following nodes
+	follow := followable && status.Phase != workflowv1alpha2.WorkflowLogRequestFailed
+	if follow {
+		status.Phase = workflowv1alpha2.WorkflowLogRequestRunning
+		if len(pending) > 0 {
+			status.Message = "waiting for pods to start: " + strings.Join(pending, ", ")
+		}
+	}
+
+	if err := c.patchStatus(ctx, logRequest, status); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if follow {
+		return ctrl.Result{RequeueAfter: logFollowInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// patchStatus replaces the WorkflowLogRequest status with the fetched logs
+func (c *WorkflowLogRequestController) patchStatus(ctx context.Context, logRequest workflowv1alpha2.WorkflowLogRequest,
+	status workflowv1alpha2.WorkflowLogRequestStatus) error {
+	original := logRequest.DeepCopy()
+	status.LastUpdated = metav1.Now()
+	logRequest.Status = status
+	if err := c.hubClient.Status().Patch(ctx, &logRequest, client.MergeFrom(original)); err != nil {
+		c.log.Error(err, "unable to patch hub WorkflowLogRequest status")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package status_sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// WorkflowStatusResyncer periodically compares the managed cluster Workflows with the hub WorkflowStatusResults
+// to repair the drift the event driven status sync missed, e.g. while the hub cluster was unreachable.
+type WorkflowStatusResyncer struct {
+	spokeClient client.Client
+	hubClient   client.Client
+	log         logr.Logger
+	clusterName string
+	interval    time.Duration
+	// events enqueues the Workflows with a missing or outdated result to the status sync controller
+	events chan event.GenericEvent
+}
+
+// Start runs the resync every interval until the context is done, it implements the manager Runnable.
+func (r *WorkflowStatusResyncer) Start(ctx context.Context) error {
+	wait.JitterUntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.resync(ctx); err != nil {
+			r.log.Error(err, "unable to resync WorkflowStatusResults")
+		}
+	}, r.interval, 0.1, true)
+	return nil
+}
+
+// resync enqueues the managed cluster Workflows whose result is missing or outdated
+// and deletes the results of the managed cluster Workflows that no longer exist.
+func (r *WorkflowStatusResyncer) resync(ctx context.Context) error {
+	r.log.Info("resyncing WorkflowStatusResults...")
+	defer r.log.Info("done resyncing WorkflowStatusResults")
+
+	// the results are listed first so a result is never newer than the listed Workflows
+	results := workflowv1alpha2.WorkflowStatusResultList{}
+	if err := r.hubClient.List(ctx, &results, client.InNamespace(r.clusterName)); err != nil {
+		return err
+	}
+
+	workflows := argov1alpha1.WorkflowList{}
+	if err := r.spokeClient.List(ctx, &workflows); err != nil {
+		return err
+	}
+
+	outdated, orphaned := getWorkflowStatusResultDrift(workflows.Items, results.Items)
+	for i := range outdated {
+		r.log.Info(fmt.Sprintf("resyncing outdated WorkflowStatusResult of Workflow %s/%s", outdated[i].Namespace, outdated[i].Name))
+		select {
+		case r.events <- event.GenericEvent{Object: &outdated[i]}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	for i := range orphaned {
+		r.log.Info("deleting WorkflowStatusResult " + orphaned[i].Name + " of a Workflow that no longer exists")
+		if err := r.hubClient.Delete(ctx, &orphaned[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	return nil
+}
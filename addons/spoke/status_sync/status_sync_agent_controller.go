@@ -4,24 +4,55 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	workflowv1alpha1 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha1"
+	"k8s.io/client-go/util/retry"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 	workflowcontroller "open-cluster-management.io/argo-workflow-multicluster/controllers/workflow"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SyncModeImmediate writes every Workflow status change to the hub cluster.
+	SyncModeImmediate = "immediate"
+	// SyncModeBatched coalesces the Workflow status changes over the sync interval, completed Workflows are written right away.
+	SyncModeBatched = "batched"
 )
 
 type ArgoWorkflowStatusController struct {
-	spokeClient client.Client
-	hubClient   client.Client
-	log         logr.Logger
-	clusterName string
+	spokeClient  client.Client
+	hubClient    client.Client
+	log          logr.Logger
+	clusterName  string
+	syncMode     string
+	syncInterval time.Duration
+	// finalizerTimeout is how long a deleted Workflow waits for its final status sync before the finalizer is removed anyway
+	finalizerTimeout time.Duration
+	// addonNamespace is where the add-on pre-delete cleanup creates the uninstall ConfigMap
+	addonNamespace string
+	// argoNamespace is where the Argo controller configuration with the default artifact repository is
+	argoNamespace string
+	// startTime tells the uninstall ConfigMap of the current uninstall apart from the one left by a previous uninstall
+	startTime time.Time
+	// resyncEvents enqueues the Workflows the periodic resync found out of sync
+	resyncEvents <-chan event.GenericEvent
+
+	// lastSynced is when the status of each running Workflow was last written to the hub cluster
+	lastSynced     map[types.NamespacedName]time.Time
+	lastSyncedLock sync.Mutex
 }
 
 var WorkflowPredicateFunctions = predicate.Funcs{
@@ -30,7 +61,9 @@ var WorkflowPredicateFunctions = predicate.Funcs{
 		newWf := e.ObjectNew.(*argov1alpha1.Workflow)
 		oldWf := e.ObjectOld.(*argov1alpha1.Workflow)
 
-		return containsValidOCMAnnotations(*newWf) && !reflect.DeepEqual(newWf.Status, oldWf.Status)
+		// the deletion and a dropped finalizer do not change the status
+		return containsValidOCMAnnotations(*newWf) && (!reflect.DeepEqual(newWf.Status, oldWf.Status) ||
+			!newWf.DeletionTimestamp.IsZero() || !hasStatusSyncFinalizer(*newWf))
 	},
 	CreateFunc: func(e event.CreateEvent) bool {
 		workflow := e.Object.(*argov1alpha1.Workflow)
@@ -43,10 +76,13 @@ var WorkflowPredicateFunctions = predicate.Funcs{
 }
 
 func (c *ArgoWorkflowStatusController) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&argov1alpha1.Workflow{}).
-		WithEventFilter(WorkflowPredicateFunctions).
-		Complete(c)
+		WithEventFilter(WorkflowPredicateFunctions)
+	if c.resyncEvents != nil {
+		b = b.Watches(&source.Channel{Source: c.resyncEvents}, &handler.EnqueueRequestForObject{})
+	}
+	return b.Complete(c)
 }
 
 // Reconcile Workflow status changes and create/update a WorkflowStatusResult CR in the hub cluster's managed cluster namespace.
@@ -60,42 +96,303 @@ func (c *ArgoWorkflowStatusController) Reconcile(ctx context.Context, req ctrl.R
 	err := c.spokeClient.Get(ctx, req.NamespacedName, &workflow)
 	switch {
 	case errors.IsNotFound(err):
+		c.recordSync(req.NamespacedName, time.Time{})
 		return ctrl.Result{}, nil
 	case err != nil:
 		c.log.Error(err, "unable to get Workflow")
 		return ctrl.Result{}, err
 	}
 
+	// the final status is synced before the Workflow is let go, e.g. by its TTL strategy
 	if !workflow.DeletionTimestamp.IsZero() {
-		return ctrl.Result{}, nil
-	}
+		if !hasStatusSyncFinalizer(workflow) {
+			return ctrl.Result{}, nil
+		}
+		// the hub might be unreachable for good, e.g. the managed cluster was detached
+		if isFinalizerTimedOut(workflow, c.finalizerTimeout, time.Now()) {
+			c.log.Info(fmt.Sprintf("giving up on the final status sync of the deleted Workflow %s after %s", req, c.finalizerTimeout))
+			return ctrl.Result{}, c.updateStatusSyncFinalizer(ctx, &workflow, false)
+		}
+		if err := c.syncWorkflowStatusResult(ctx, workflow); err != nil {
+			return ctrl.Result{}, err
+		}
+		c.recordSync(req.NamespacedName, time.Time{})
 
-	hubWorkflowStatusResult := workflowv1alpha1.WorkflowStatusResult{}
-	hubWorkflowStatusResult.Namespace = c.clusterName
-	hubWorkflowStatusResult.Name = generateHubWorkflowStatusResultName(workflow)
-	hubWorkflowStatusResult.WorkflowStatus = workflow.Status
-	hubWorkflowStatusResult.Annotations = map[string]string{
-		workflowcontroller.AnnotationKeyHubWorkflowName:      workflow.Annotations[workflowcontroller.AnnotationKeyHubWorkflowName],
-		workflowcontroller.AnnotationKeyHubWorkflowNamespace: workflow.Annotations[workflowcontroller.AnnotationKeyHubWorkflowNamespace],
+		// the hub deletes the ManifestWork first, otherwise the OCM work agent applies the Workflow again
+		acknowledged, err := c.isRemoteDeletionAcknowledged(ctx, workflow)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !acknowledged {
+			return ctrl.Result{RequeueAfter: remoteDeletionPollInterval}, nil
+		}
+		return ctrl.Result{}, c.updateStatusSyncFinalizer(ctx, &workflow, false)
 	}
-	err = c.hubClient.Get(ctx, types.NamespacedName{Namespace: hubWorkflowStatusResult.Namespace, Name: hubWorkflowStatusResult.Name}, &hubWorkflowStatusResult)
-	switch {
-	case errors.IsNotFound(err):
-		if err = c.hubClient.Create(ctx, &hubWorkflowStatusResult); err != nil {
-			c.log.Error(err, "unable to create hub WorkflowStatusResult")
+
+	if !hasStatusSyncFinalizer(workflow) {
+		uninstalling, err := c.isUninstalling(ctx)
+		if err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{Requeue: true}, nil
-	case err != nil:
-		c.log.Error(err, "unable to get hub WorkflowStatusResult")
+		// the pre-delete cleanup removes the finalizers, none are added back while the add-on is removed
+		if !uninstalling {
+			if err := c.updateStatusSyncFinalizer(ctx, &workflow, true); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// the status changes until the delay is over are coalesced into a single hub write
+	if delay := getSyncDelay(c.syncMode, c.syncInterval, c.getLastSynced(req.NamespacedName), time.Now(), workflow); delay > 0 {
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	if err := c.syncWorkflowStatusResult(ctx, workflow); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	hubWorkflowStatusResult.WorkflowStatus = workflow.Status
-	err = c.hubClient.Update(ctx, &hubWorkflowStatusResult)
+	if workflow.Status.Fulfilled() {
+		c.recordSync(req.NamespacedName, time.Time{})
+	} else {
+		c.recordSync(req.NamespacedName, time.Now())
+	}
+	return ctrl.Result{}, nil
+}
+
+// syncWorkflowStatusResult creates or patches the hub WorkflowStatusResult with the Workflow status
+func (c *ArgoWorkflowStatusController) syncWorkflowStatusResult(ctx context.Context, workflow argov1alpha1.Workflow) error {
+	// the sequence is read and incremented under an optimistic lock, a conflict reads the result again
+	var hubWorkflowStatusResult workflowv1alpha2.WorkflowStatusResult
+	var chunks []string
+	var previousChunks int32
+	synced := false
+	// an unresolved repository leaves the key-only artifact locations as they are, it does not hold the status sync
+	repository, err := c.getArtifactRepository(ctx, workflow)
+	if err != nil {
+		c.log.Error(err, "unable to resolve the artifact repository of Workflow")
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		synced = false
+		hubWorkflowStatusResult = workflowv1alpha2.WorkflowStatusResult{}
+		hubWorkflowStatusResult.Namespace = c.clusterName
+		hubWorkflowStatusResult.Name = generateHubWorkflowStatusResultName(workflow)
+		err := c.hubClient.Get(ctx, types.NamespacedName{Namespace: hubWorkflowStatusResult.Namespace, Name: hubWorkflowStatusResult.Name}, &hubWorkflowStatusResult)
+		if err != nil && !errors.IsNotFound(err) {
+			c.log.Error(err, "unable to get hub WorkflowStatusResult")
+			return err
+		}
+		create := errors.IsNotFound(err)
+		// the hub Workflow was deleted first and cleaned up the result, there is nothing to mark as deleted
+		if create && !workflow.DeletionTimestamp.IsZero() {
+			return nil
+		}
+		// the deletion is already synced, only waiting for the hub to acknowledge it
+		if !create && hubWorkflowStatusResult.Spec.RemoteDeletionTimestamp != nil &&
+			hubWorkflowStatusResult.Spec.ObservedResourceVersion == workflow.ResourceVersion {
+			return nil
+		}
+		original := hubWorkflowStatusResult.DeepCopy()
+		previousChunks = hubWorkflowStatusResult.Spec.NodeStatusChunks
+
+		populateWorkflowStatusResult(&hubWorkflowStatusResult, workflow, c.clusterName)
+		if repository != nil {
+			// the node status is shared with the Workflow, the artifacts are relocated on a copy
+			hubWorkflowStatusResult.WorkflowStatus = *hubWorkflowStatusResult.WorkflowStatus.DeepCopy()
+			if err := qualifyArtifactLocations(&hubWorkflowStatusResult.WorkflowStatus, repository); err != nil {
+				c.log.Error(err, "unable to qualify the artifact locations of Workflow")
+			}
+		}
+		chunks, err = packWorkflowStatusResult(&hubWorkflowStatusResult)
+		if err != nil {
+			c.log.Error(err, "unable to compress the Workflow node status")
+			return err
+		}
+
+		if create {
+			if err := c.hubClient.Create(ctx, &hubWorkflowStatusResult); err != nil {
+				c.log.Error(err, "unable to create hub WorkflowStatusResult")
+				return err
+			}
+			synced = true
+			return nil
+		}
+
+		// only the changed fields, e.g. the changed nodes, are sent to the hub
+		patch := client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})
+		if err := c.hubClient.Patch(ctx, &hubWorkflowStatusResult, patch); err != nil {
+			c.log.Error(err, "unable to patch hub WorkflowStatusResult")
+			return err
+		}
+		synced = true
+		return nil
+	})
+	if err != nil || !synced {
+		return err
+	}
+
+	return c.syncNodeStatusChunks(ctx, hubWorkflowStatusResult, chunks, previousChunks)
+}
+
+// getArtifactRepository returns the artifact repository the Argo controller resolved for the Workflow,
+// the repository of a Workflow synced before the controller recorded it is read from the referenced ConfigMap,
+// or from the Argo controller configuration for the default repository
+func (c *ArgoWorkflowStatusController) getArtifactRepository(ctx context.Context, workflow argov1alpha1.Workflow) (*argov1alpha1.ArtifactRepository, error) {
+	ref := workflow.Status.ArtifactRepositoryRef
+	if ref == nil {
+		return nil, nil
+	}
+	if ref.ArtifactRepository != nil {
+		return ref.ArtifactRepository, nil
+	}
+	// the default repository is set in the Argo controller configuration
+	if ref.Default {
+		configMap := corev1.ConfigMap{}
+		err := c.spokeClient.Get(ctx, types.NamespacedName{Namespace: c.argoNamespace, Name: workflowControllerConfigMap}, &configMap)
+		if err != nil {
+			return nil, err
+		}
+		return getDefaultArtifactRepository(configMap)
+	}
+
+	namespace := ref.Namespace
+	if len(namespace) == 0 {
+		namespace = workflow.Namespace
+	}
+	configMap := corev1.ConfigMap{}
+	err := c.spokeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.GetConfigMapOr(defaultArtifactRepositoryConfigMap)}, &configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ref.GetKeyOr(configMap.Annotations[annotationKeyDefaultArtifactRepository])
+	value, ok := configMap.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("artifact repository %s not found", ref)
+	}
+	repository := &argov1alpha1.ArtifactRepository{}
+	if err := yaml.Unmarshal([]byte(value), repository); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// isRemoteDeletionAcknowledged returns true if the hub marked the result of the deleted Workflow as remote deleted or deleted it
+func (c *ArgoWorkflowStatusController) isRemoteDeletionAcknowledged(ctx context.Context, workflow argov1alpha1.Workflow) (bool, error) {
+	result := workflowv1alpha2.WorkflowStatusResult{}
+	err := c.hubClient.Get(ctx, types.NamespacedName{Namespace: c.clusterName, Name: generateHubWorkflowStatusResultName(workflow)}, &result)
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
 	if err != nil {
-		c.log.Error(err, "unable to update hub WorkflowStatusResult")
+		c.log.Error(err, "unable to get hub WorkflowStatusResult")
+		return false, err
+	}
+	return isRemoteDeletionAcknowledged(result), nil
+}
+
+// isUninstalling returns true if the add-on pre-delete cleanup created the uninstall ConfigMap since the agent started
+func (c *ArgoWorkflowStatusController) isUninstalling(ctx context.Context) (bool, error) {
+	configMap := corev1.ConfigMap{}
+	err := c.spokeClient.Get(ctx, types.NamespacedName{Namespace: c.addonNamespace, Name: uninstallConfigMapName}, &configMap)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		c.log.Error(err, "unable to get the uninstall ConfigMap")
+		return false, err
+	}
+	return !configMap.CreationTimestamp.Time.Before(c.startTime), nil
+}
+
+// updateStatusSyncFinalizer adds or removes the finalizer that holds the Workflow deletion until its final status is synced
+func (c *ArgoWorkflowStatusController) updateStatusSyncFinalizer(ctx context.Context, workflow *argov1alpha1.Workflow, add bool) error {
+	original := workflow.DeepCopy()
+	finalizers := []string{}
+	for _, finalizer := range workflow.Finalizers {
+		if finalizer != finalizerStatusSync {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	if add {
+		finalizers = append(finalizers, finalizerStatusSync)
+	}
+	workflow.Finalizers = finalizers
+
+	patch := client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})
+	if err := c.spokeClient.Patch(ctx, workflow, patch); err != nil {
+		c.log.Error(err, "unable to update the status sync finalizer of Workflow")
+		return err
+	}
+	return nil
+}
+
+// getLastSynced returns when the Workflow status was last written to the hub cluster, zero if never
+func (c *ArgoWorkflowStatusController) getLastSynced(key types.NamespacedName) time.Time {
+	c.lastSyncedLock.Lock()
+	defer c.lastSyncedLock.Unlock()
+	return c.lastSynced[key]
+}
+
+// recordSync records when the Workflow status was written to the hub cluster, a zero time forgets the Workflow
+func (c *ArgoWorkflowStatusController) recordSync(key types.NamespacedName, syncedAt time.Time) {
+	c.lastSyncedLock.Lock()
+	defer c.lastSyncedLock.Unlock()
+	if c.lastSynced == nil {
+		c.lastSynced = map[types.NamespacedName]time.Time{}
+	}
+	if syncedAt.IsZero() {
+		delete(c.lastSynced, key)
+		return
+	}
+	c.lastSynced[key] = syncedAt
+}
+
+// syncNodeStatusChunks writes the node status offloaded from the WorkflowStatusResult to WorkflowStatusResultChunks
+// owned by the result, and deletes the chunks the previous sync wrote beyond the current ones.
+func (c *ArgoWorkflowStatusController) syncNodeStatusChunks(ctx context.Context, result workflowv1alpha2.WorkflowStatusResult,
+	chunks []string, previousChunks int32) error {
+	for i, data := range chunks {
+		chunk := workflowv1alpha2.WorkflowStatusResultChunk{}
+		chunk.Namespace = result.Namespace
+		chunk.Name = workflowcontroller.GenerateWorkflowStatusResultChunkName(result.Name, int32(i))
+		err := c.hubClient.Get(ctx, types.NamespacedName{Namespace: chunk.Namespace, Name: chunk.Name}, &chunk)
+		if err != nil && !errors.IsNotFound(err) {
+			c.log.Error(err, "unable to get hub WorkflowStatusResultChunk")
+			return err
+		}
+		create := errors.IsNotFound(err)
+		original := chunk.DeepCopy()
+
+		chunk.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(&result, workflowv1alpha2.GroupVersion.WithKind("WorkflowStatusResult")),
+		}
+		chunk.Spec = workflowv1alpha2.WorkflowStatusResultChunkSpec{
+			ResultName: result.Name,
+			Sequence:   result.Spec.Sequence,
+			Index:      int32(i),
+			Data:       data,
+		}
+
+		if create {
+			err = c.hubClient.Create(ctx, &chunk)
+		} else {
+			err = c.hubClient.Patch(ctx, &chunk, client.MergeFrom(original))
+		}
+		if err != nil {
+			c.log.Error(err, "unable to write hub WorkflowStatusResultChunk")
+			return err
+		}
+	}
+
+	for i := int32(len(chunks)); i < previousChunks; i++ {
+		chunk := workflowv1alpha2.WorkflowStatusResultChunk{}
+		chunk.Namespace = result.Namespace
+		chunk.Name = workflowcontroller.GenerateWorkflowStatusResultChunkName(result.Name, i)
+		if err := c.hubClient.Delete(ctx, &chunk); client.IgnoreNotFound(err) != nil {
+			c.log.Error(err, "unable to delete hub WorkflowStatusResultChunk")
+			return err
+		}
 	}
 
-	return ctrl.Result{}, err
+	return nil
 }
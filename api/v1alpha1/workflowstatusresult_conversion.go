@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+)
+
+const (
+	// the v1alpha1 annotations that identify the hub Workflow
+	annotationKeyHubWorkflowNamespace = "workflows.argoproj.io/ocm-hub-workflow-namespace"
+	annotationKeyHubWorkflowName      = "workflows.argoproj.io/ocm-hub-workflow-name"
+	annotationKeyHubWorkflowUID       = "workflows.argoproj.io/ocm-hub-workflow-uid"
+	// annotationKeyConversionData keeps the v1alpha2 spec and status so the round trip through v1alpha1 is lossless
+	annotationKeyConversionData = "workflowstatusresults.argoproj.io/v1alpha2-conversion-data"
+)
+
+// conversionData is the v1alpha2 data that has no v1alpha1 field
+type conversionData struct {
+	Spec   v1alpha2.WorkflowStatusResultSpec   `json:"spec"`
+	Status v1alpha2.WorkflowStatusResultStatus `json:"status,omitempty"`
+}
+
+// ConvertTo converts this WorkflowStatusResult to the hub version (v1alpha2)
+func (src *WorkflowStatusResult) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.WorkflowStatusResult)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	src.WorkflowStatus.DeepCopyInto(&dst.WorkflowStatus)
+
+	annos := dst.GetAnnotations()
+	if data, ok := annos[annotationKeyConversionData]; ok {
+		delete(annos, annotationKeyConversionData)
+		dst.SetAnnotations(annos)
+
+		var cd conversionData
+		if err := json.Unmarshal([]byte(data), &cd); err != nil {
+			return err
+		}
+		dst.Spec = cd.Spec
+		dst.Status = cd.Status
+		return nil
+	}
+
+	dst.Spec = v1alpha2.WorkflowStatusResultSpec{
+		HubWorkflowRef: v1alpha2.HubWorkflowReference{
+			Namespace: annos[annotationKeyHubWorkflowNamespace],
+			Name:      annos[annotationKeyHubWorkflowName],
+			UID:       types.UID(annos[annotationKeyHubWorkflowUID]),
+		},
+		// the agent creates the result in its managed cluster namespace
+		ClusterName: src.Namespace,
+	}
+	dst.Status = v1alpha2.WorkflowStatusResultStatus{}
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1alpha2) to this version
+func (dst *WorkflowStatusResult) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.WorkflowStatusResult)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	src.WorkflowStatus.DeepCopyInto(&dst.WorkflowStatus)
+
+	data, err := json.Marshal(conversionData{Spec: src.Spec, Status: src.Status})
+	if err != nil {
+		return err
+	}
+
+	annos := dst.GetAnnotations()
+	if annos == nil {
+		annos = map[string]string{}
+	}
+	annos[annotationKeyHubWorkflowNamespace] = src.Spec.HubWorkflowRef.Namespace
+	annos[annotationKeyHubWorkflowName] = src.Spec.HubWorkflowRef.Name
+	if len(src.Spec.HubWorkflowRef.UID) > 0 {
+		annos[annotationKeyHubWorkflowUID] = string(src.Spec.HubWorkflowRef.UID)
+	}
+	annos[annotationKeyConversionData] = string(data)
+	dst.SetAnnotations(annos)
+
+	return nil
+}
@@ -21,28 +21,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
-
-// WorkflowStatusResultSpec defines the desired state of WorkflowStatusResult
-type WorkflowStatusResultSpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
-
-	// Foo is an example field of WorkflowStatusResult. Edit workflowstatusresult_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
-}
-
-// WorkflowStatusResultStatus defines the observed state of WorkflowStatusResult
-type WorkflowStatusResultStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
-}
-
 //+kubebuilder:object:root=true
-//+kubebuilder:subresource:status
 
-// WorkflowStatusResult is the Schema for the workflowstatusresults API
+// WorkflowStatusResult is the Schema for the workflowstatusresults API.
+// Deprecated: use v1alpha2, which identifies the hub Workflow in its spec instead of annotations.
 type WorkflowStatusResult struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
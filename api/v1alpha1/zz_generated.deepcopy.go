@@ -82,33 +82,3 @@ func (in *WorkflowStatusResultList) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *WorkflowStatusResultSpec) DeepCopyInto(out *WorkflowStatusResultSpec) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkflowStatusResultSpec.
-func (in *WorkflowStatusResultSpec) DeepCopy() *WorkflowStatusResultSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(WorkflowStatusResultSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *WorkflowStatusResultStatus) DeepCopyInto(out *WorkflowStatusResultStatus) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkflowStatusResultStatus.
-func (in *WorkflowStatusResultStatus) DeepCopy() *WorkflowStatusResultStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(WorkflowStatusResultStatus)
-	in.DeepCopyInto(out)
-	return out
-}
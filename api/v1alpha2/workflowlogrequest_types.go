@@ -0,0 +1,105 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkflowLogRequestPhase is the progress of a WorkflowLogRequest
+type WorkflowLogRequestPhase string
+
+const (
+	// WorkflowLogRequestPending is a request the status sync agent did not fulfil yet.
+	WorkflowLogRequestPending WorkflowLogRequestPhase = "Pending"
+	// WorkflowLogRequestRunning is a followed request whose logs are refreshed until the Workflow completes.
+	WorkflowLogRequestRunning WorkflowLogRequestPhase = "Running"
+	// WorkflowLogRequestSucceeded is a request with its final logs.
+	WorkflowLogRequestSucceeded WorkflowLogRequestPhase = "Succeeded"
+	// WorkflowLogRequestFailed is a request the status sync agent could not fulfil, see the message.
+	WorkflowLogRequestFailed WorkflowLogRequestPhase = "Failed"
+)
+
+// WorkflowLogRequestSpec selects the managed cluster Workflow pod logs to fetch
+type WorkflowLogRequestSpec struct {
+	// HubWorkflowRef references the hub Workflow whose managed cluster pods the logs are fetched from.
+	HubWorkflowRef HubWorkflowReference `json:"hubWorkflowRef"`
+	// NodeID limits the logs to the pod of the Workflow node, the logs of every pod are fetched when empty.
+	NodeID string `json:"nodeID,omitempty"`
+	// Container is the pod container to fetch the logs of, defaults to main.
+	Container string `json:"container,omitempty"`
+	// TailLines is the number of lines from the end of the logs to fetch, defaults to 500 without a LimitBytes.
+	TailLines *int64 `json:"tailLines,omitempty"`
+	// SinceSeconds only fetches the logs newer than the relative time in seconds.
+	SinceSeconds *int64 `json:"sinceSeconds,omitempty"`
+	// LimitBytes is the number of bytes from the start of the logs to fetch.
+	LimitBytes *int64 `json:"limitBytes,omitempty"`
+	// Follow refreshes the logs until the managed cluster Workflow completes.
+	Follow bool `json:"follow,omitempty"`
+}
+
+// PodLog holds the logs of a single managed cluster Workflow pod
+type PodLog struct {
+	// NodeID is the Workflow node the pod runs.
+	NodeID string `json:"nodeID,omitempty"`
+	// PodName is the name of the pod on the managed cluster.
+	PodName string `json:"podName"`
+	// Container is the container the logs were fetched from.
+	Container string `json:"container"`
+	// Content is the fetched logs, truncated from the start when the logs of all the pods are too large.
+	Content string `json:"content,omitempty"`
+}
+
+// WorkflowLogRequestStatus holds the logs fetched by the status sync agent
+type WorkflowLogRequestStatus struct {
+	// Phase is the progress of the request.
+	Phase WorkflowLogRequestPhase `json:"phase,omitempty"`
+	// Message explains why the request failed.
+	Message string `json:"message,omitempty"`
+	// Logs are the fetched logs, one per pod.
+	Logs []PodLog `json:"logs,omitempty"`
+	// LastUpdated is when the logs were last fetched.
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// WorkflowLogRequest is the Schema for the workflowlogrequests API, it is created in the managed cluster namespace
+// of the hub and fulfilled by the status sync agent with the logs of the managed cluster Workflow pods
+type WorkflowLogRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WorkflowLogRequestSpec   `json:"spec"`
+	Status WorkflowLogRequestStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// WorkflowLogRequestList contains a list of WorkflowLogRequest
+type WorkflowLogRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkflowLogRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WorkflowLogRequest{}, &WorkflowLogRequestList{})
+}
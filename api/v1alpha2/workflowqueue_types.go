@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkflowQueueOrdering is the order the queued Workflows of the same priority are admitted in
+type WorkflowQueueOrdering string
+
+const (
+	// WorkflowQueueOrderingFIFO admits the Workflows in creation order, this is the default.
+	WorkflowQueueOrderingFIFO WorkflowQueueOrdering = "FIFO"
+	// WorkflowQueueOrderingFairShare admits first the Workflows of the namespace with the fewest running Workflows,
+	// then in creation order.
+	WorkflowQueueOrderingFairShare WorkflowQueueOrdering = "FairShare"
+)
+
+// WorkflowQueuePriorityClass names a priority the queued Workflows can refer to
+type WorkflowQueuePriorityClass struct {
+	// Name of the priority class.
+	Name string `json:"name"`
+	// Value is the priority, the Workflows with a higher value are admitted first.
+	Value int32 `json:"value"`
+	// Namespaces are the namespaces whose Workflows can use the priority class, every namespace of the queue when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// WorkflowQueueSpec limits the Workflows of the queue running on the managed clusters at the same time
+type WorkflowQueueSpec struct {
+	// Namespaces are the namespaces bound to the queue, every placed OCM Workflow created in them waits for the queue admission.
+	// A namespace is bound to a single queue, the first one by name when several list it.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// MaxRunning is the number of Workflows of the queue running at the same time across every namespace
+	// and managed cluster, unlimited when zero.
+	MaxRunning int32 `json:"maxRunning,omitempty"`
+	// MaxRunningPerCluster is the number of Workflows of the queue running at the same time on a managed cluster, unlimited when zero.
+	MaxRunningPerCluster int32 `json:"maxRunningPerCluster,omitempty"`
+	// MaxRunningPerNamespace is the number of Workflows of the queue running at the same time from a namespace, unlimited when zero.
+	MaxRunningPerNamespace int32 `json:"maxRunningPerNamespace,omitempty"`
+	// Ordering is the order the Workflows of the same priority are admitted in, either FIFO (default) or FairShare.
+	Ordering WorkflowQueueOrdering `json:"ordering,omitempty"`
+	// PriorityClasses are the priorities the Workflows of the queue can refer to.
+	PriorityClasses []WorkflowQueuePriorityClass `json:"priorityClasses,omitempty"`
+	// DefaultPriorityClass is the priority class of the Workflows that do not refer to one, the priority is zero when empty.
+	DefaultPriorityClass string `json:"defaultPriorityClass,omitempty"`
+}
+
+// WorkflowQueueStatus shows the usage of the queue
+type WorkflowQueueStatus struct {
+	// Running is the number of admitted Workflows that are not completed yet.
+	Running int32 `json:"running"`
+	// Queued is the number of placed Workflows waiting for admission.
+	Queued int32 `json:"queued"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Running",type=integer,JSONPath=`.status.running`
+//+kubebuilder:printcolumn:name="Queued",type=integer,JSONPath=`.status.queued`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// WorkflowQueue is the Schema for the workflowqueues API, the hub holds the placed Workflows of the namespaces bound
+// to the queue until they can run on their managed cluster(s) within the queue limits
+type WorkflowQueue struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WorkflowQueueSpec   `json:"spec,omitempty"`
+	Status WorkflowQueueStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// WorkflowQueueList contains a list of WorkflowQueue
+type WorkflowQueueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkflowQueue `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WorkflowQueue{}, &WorkflowQueueList{})
+}
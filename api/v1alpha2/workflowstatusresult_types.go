@@ -0,0 +1,121 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ConditionTypeAccepted shows whether the hub Workflow status was updated from the result.
+	ConditionTypeAccepted = "Accepted"
+	// ReasonSynced is the Accepted condition reason of a result copied to the hub Workflow status.
+	ReasonSynced = "Synced"
+	// ReasonStale is the Accepted condition reason of a result older than the last accepted one.
+	ReasonStale = "Stale"
+	// ReasonOrphaned is the Accepted condition reason of a result whose hub Workflow no longer exists.
+	ReasonOrphaned = "Orphaned"
+	// ConditionTypeRemoteDeleted shows the managed cluster Workflow was deleted, e.g. by its TTL strategy.
+	ConditionTypeRemoteDeleted = "RemoteDeleted"
+)
+
+// HubWorkflowReference identifies the hub Workflow a WorkflowStatusResult belongs to
+type HubWorkflowReference struct {
+	// Namespace of the hub Workflow.
+	Namespace string `json:"namespace"`
+	// Name of the hub Workflow.
+	Name string `json:"name"`
+	// UID of the hub Workflow, a result with a different UID belongs to a deleted hub Workflow of the same name.
+	UID types.UID `json:"uid,omitempty"`
+}
+
+// WorkflowOutputsSummary is the compact form of the managed cluster Workflow outputs, readable without the node status
+type WorkflowOutputsSummary struct {
+	// Parameters are the global output parameters of the Workflow by name.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// EntrypointParameters are the output parameters of the Workflow entrypoint by name.
+	EntrypointParameters map[string]string `json:"entrypointParameters,omitempty"`
+	// ExitCode is the exit code of the Workflow entrypoint, empty for an entrypoint that does not run a container, e.g. steps or a DAG.
+	ExitCode string `json:"exitCode,omitempty"`
+}
+
+// WorkflowStatusResultSpec identifies the managed cluster Workflow the status was synced from
+type WorkflowStatusResultSpec struct {
+	// HubWorkflowRef references the hub Workflow the status belongs to.
+	HubWorkflowRef HubWorkflowReference `json:"hubWorkflowRef"`
+	// ClusterName is the managed cluster the Workflow runs on.
+	ClusterName string `json:"clusterName"`
+	// WorkflowUID is the UID of the managed cluster Workflow.
+	WorkflowUID types.UID `json:"workflowUID,omitempty"`
+	// ObservedGeneration is the generation of the managed cluster Workflow the status was read from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ObservedResourceVersion is the resourceVersion of the managed cluster Workflow the status was read from.
+	ObservedResourceVersion string `json:"observedResourceVersion,omitempty"`
+	// SyncedAt is when the status was synced from the managed cluster.
+	SyncedAt metav1.Time `json:"syncedAt,omitempty"`
+	// Sequence increases with every sync of the managed cluster Workflow status.
+	Sequence int64 `json:"sequence,omitempty"`
+	// RemoteDeletionTimestamp is when the managed cluster Workflow was deleted, the WorkflowStatus is its final status.
+	RemoteDeletionTimestamp *metav1.Time `json:"remoteDeletionTimestamp,omitempty"`
+	// Outputs summarizes the Workflow outputs, it is synced even when the node status is offloaded to chunks.
+	Outputs *WorkflowOutputsSummary `json:"outputs,omitempty"`
+	// NodeStatusChunks is the number of WorkflowStatusResultChunks the compressed node status is offloaded to,
+	// the node status is in the WorkflowStatus when zero.
+	NodeStatusChunks int32 `json:"nodeStatusChunks,omitempty"`
+}
+
+// WorkflowStatusResultStatus defines the observed state of WorkflowStatusResult
+type WorkflowStatusResultStatus struct {
+	// AcceptedSequence is the sequence of the last result copied to the hub Workflow status.
+	AcceptedSequence int64 `json:"acceptedSequence,omitempty"`
+	// AcceptedGeneration is the managed cluster Workflow generation of the last result copied to the hub Workflow status.
+	AcceptedGeneration int64 `json:"acceptedGeneration,omitempty"`
+	// AcceptedWorkflowUID is the managed cluster Workflow UID of the last result copied to the hub Workflow status.
+	AcceptedWorkflowUID types.UID `json:"acceptedWorkflowUID,omitempty"`
+	// Conditions of the WorkflowStatusResult.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// WorkflowStatusResult is the Schema for the workflowstatusresults API
+type WorkflowStatusResult struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec WorkflowStatusResultSpec `json:"spec"`
+	// WorkflowStatus is the status of the managed cluster Workflow.
+	WorkflowStatus argov1alpha1.WorkflowStatus `json:"workflowStatus"`
+	Status         WorkflowStatusResultStatus  `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// WorkflowStatusResultList contains a list of WorkflowStatusResult
+type WorkflowStatusResultList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkflowStatusResult `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WorkflowStatusResult{}, &WorkflowStatusResultList{})
+}
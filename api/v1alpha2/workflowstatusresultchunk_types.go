@@ -0,0 +1,57 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkflowStatusResultChunkSpec holds a part of the compressed node status of a WorkflowStatusResult
+type WorkflowStatusResultChunkSpec struct {
+	// ResultName is the name of the WorkflowStatusResult the chunk belongs to.
+	ResultName string `json:"resultName"`
+	// Sequence is the WorkflowStatusResult sequence the chunk was written for.
+	Sequence int64 `json:"sequence"`
+	// Index is the position of the chunk in the compressed node status.
+	Index int32 `json:"index"`
+	// Data is the part of the gzipped and base64 encoded node status.
+	Data string `json:"data"`
+}
+
+//+kubebuilder:object:root=true
+
+// WorkflowStatusResultChunk is the Schema for the workflowstatusresultchunks API,
+// it offloads the node status of a WorkflowStatusResult too large for a single object
+type WorkflowStatusResultChunk struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec WorkflowStatusResultChunkSpec `json:"spec"`
+}
+
+//+kubebuilder:object:root=true
+
+// WorkflowStatusResultChunkList contains a list of WorkflowStatusResultChunk
+type WorkflowStatusResultChunkList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkflowStatusResultChunk `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WorkflowStatusResultChunk{}, &WorkflowStatusResultChunkList{})
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// AnnotationKeyPrefixOCM is the prefix of the OCM annotations a CronWorkflow passes on to the Workflows it creates.
+	AnnotationKeyPrefixOCM = "workflows.argoproj.io/ocm-"
+	// Workflow label that references the CronWorkflow that created the Workflow, same as the Argo Workflows controller.
+	LabelKeyCronWorkflow = "workflows.argoproj.io/cron-workflow"
+	// Workflow annotation that records the schedule time of the CronWorkflow run, same as the Argo Workflows controller.
+	AnnotationKeyCronWorkflowScheduledTime = "workflows.argoproj.io/scheduled-time"
+	// defaultSuccessfulJobsHistoryLimit is the number of succeeded Workflows kept when the CronWorkflow does not specify one.
+	defaultSuccessfulJobsHistoryLimit = 3
+	// defaultFailedJobsHistoryLimit is the number of failed Workflows kept when the CronWorkflow does not specify one.
+	defaultFailedJobsHistoryLimit = 1
+	// maxMissedSchedules is the number of missed schedules looked at before skipping ahead to the most recent one.
+	maxMissedSchedules = 100
+)
+
+// CronWorkflowReconciler reconciles a CronWorkflow object
+type CronWorkflowReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// HubInstanceID is the controller instance ID the hub CronWorkflow and its Workflows are labeled with.
+	HubInstanceID string
+	// Recorder emits the CronWorkflow Events, e.g. the too many missed schedules warning.
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=argoproj.io,resources=cronworkflows,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// CronWorkflowPredicateFunctions defines which CronWorkflow this controller should schedule
+var CronWorkflowPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isOCMMulticlusterEnabled(e.ObjectNew.GetLabels())
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return isOCMMulticlusterEnabled(e.Object.GetLabels())
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
+// CronWorkflowRunPredicateFunctions only reconciles the CronWorkflow when one of its Workflows completed or was deleted,
+// i.e. when its active Workflows or its Workflow history changed
+var CronWorkflowRunPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		newWorkflow := e.ObjectNew.(*argov1alpha1.Workflow)
+		oldWorkflow := e.ObjectOld.(*argov1alpha1.Workflow)
+		return newWorkflow.Status.Fulfilled() && !oldWorkflow.Status.Fulfilled()
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return false
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return true
+	},
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CronWorkflowReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&argov1alpha1.CronWorkflow{}, builder.WithPredicates(CronWorkflowPredicateFunctions)).
+		Owns(&argov1alpha1.Workflow{}, builder.WithPredicates(CronWorkflowRunPredicateFunctions)).
+		Complete(r)
+}
+
+// Reconcile creates a hub Workflow on every schedule tick of an OCM enabled CronWorkflow.
+// The created Workflow carries the OCM label and annotations so the placement and ManifestWork
+// controllers propagate it to the managed cluster(s).
+func (r *CronWorkflowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("reconciling CronWorkflow...")
+	defer log.Info("done reconciling CronWorkflow")
+
+	var cronWorkflow argov1alpha1.CronWorkflow
+	if err := r.Get(ctx, req.NamespacedName, &cronWorkflow); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// the created Workflows are garbage collected through their owner references
+	if cronWorkflow.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	// the hub Argo cron controller ignores it as well, the label is persisted along with the status
+	ensureHubOnlyLabel(&cronWorkflow, r.HubInstanceID)
+
+	workflows := &argov1alpha1.WorkflowList{}
+	if err := r.List(ctx, workflows, client.InNamespace(cronWorkflow.Namespace),
+		client.MatchingLabels{LabelKeyCronWorkflow: cronWorkflow.Name}); err != nil {
+		log.Error(err, "unable to list Workflows")
+		return ctrl.Result{}, err
+	}
+
+	active, err := r.cleanupWorkflowHistory(ctx, cronWorkflow, workflows.Items)
+	if err != nil {
+		log.Error(err, "unable to clean up Workflow history")
+		return ctrl.Result{}, err
+	}
+
+	schedule, location, err := parseCronWorkflowSchedule(cronWorkflow)
+	if err != nil {
+		log.Error(err, "unable to parse the CronWorkflow schedule")
+		cronWorkflow.Status.Conditions.UpsertCondition(argov1alpha1.Condition{
+			Type:    argov1alpha1.ConditionTypeSpecError,
+			Status:  metav1.ConditionTrue,
+			Message: err.Error(),
+		})
+		return ctrl.Result{}, r.updateStatus(ctx, &cronWorkflow, active)
+	}
+	cronWorkflow.Status.Conditions.RemoveCondition(argov1alpha1.ConditionTypeSpecError)
+
+	if cronWorkflow.Spec.Suspend {
+		return ctrl.Result{}, r.updateStatus(ctx, &cronWorkflow, active)
+	}
+
+	lastScheduleTime := cronWorkflow.CreationTimestamp.Time
+	if cronWorkflow.Status.LastScheduledTime != nil {
+		lastScheduleTime = cronWorkflow.Status.LastScheduledTime.Time
+	}
+
+	now := time.Now().In(location)
+	deadline := cronWorkflow.Spec.StartingDeadlineSeconds
+	scheduleTime, nextScheduleTime, tooManyMissed := getMostRecentScheduleTime(schedule, lastScheduleTime.In(location), now, deadline)
+	if tooManyMissed {
+		message := fmt.Sprintf("too many missed schedules, skipped ahead to %s. Set or decrease .spec.startingDeadlineSeconds or check the clock skew",
+			scheduleTime.Format(time.RFC3339))
+		log.Info(message)
+		r.Recorder.Event(&cronWorkflow, corev1.EventTypeWarning, "TooManyMissedTimes", message)
+	}
+	if scheduleTime == nil {
+		if err := r.updateStatus(ctx, &cronWorkflow, active); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: nextScheduleTime.Sub(now)}, nil
+	}
+
+	// the schedule time is recorded even when the run is skipped so the same tick is not evaluated again
+	cronWorkflow.Status.LastScheduledTime = &metav1.Time{Time: *scheduleTime}
+
+	switch {
+	case deadline != nil && now.Sub(*scheduleTime) > time.Duration(*deadline)*time.Second:
+		log.Info("skipping the CronWorkflow run, missed the starting deadline for " + scheduleTime.String())
+	case len(active) > 0 && cronWorkflow.Spec.ConcurrencyPolicy == argov1alpha1.ForbidConcurrent:
+		log.Info("skipping the CronWorkflow run, concurrency policy forbids concurrent Workflows")
+	default:
+		if cronWorkflow.Spec.ConcurrencyPolicy == argov1alpha1.ReplaceConcurrent {
+			for i := range active {
+				log.Info("replacing Workflow " + active[i].Namespace + "/" + active[i].Name)
+				if err := r.Delete(ctx, &active[i]); client.IgnoreNotFound(err) != nil {
+					log.Error(err, "unable to delete Workflow")
+					return ctrl.Result{}, err
+				}
+			}
+			active = nil
+		}
+
+		workflow := generateCronWorkflowRun(cronWorkflow, *scheduleTime)
+		log.Info("creating Workflow " + workflow.Namespace + "/" + workflow.Name)
+		if err := r.Create(ctx, workflow); err != nil && !errors.IsAlreadyExists(err) {
+			log.Error(err, "unable to create Workflow")
+			cronWorkflow.Status.Conditions.UpsertCondition(argov1alpha1.Condition{
+				Type:    argov1alpha1.ConditionTypeSubmissionError,
+				Status:  metav1.ConditionTrue,
+				Message: err.Error(),
+			})
+			if err := r.updateStatus(ctx, &cronWorkflow, active); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, err
+		}
+		cronWorkflow.Status.Conditions.RemoveCondition(argov1alpha1.ConditionTypeSubmissionError)
+		active = append(active, *workflow)
+	}
+
+	if err := r.updateStatus(ctx, &cronWorkflow, active); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: nextScheduleTime.Sub(now)}, nil
+}
+
+// cleanupWorkflowHistory deletes the completed Workflows beyond the CronWorkflow history limits
+// and returns the Workflows that are still active.
+func (r *CronWorkflowReconciler) cleanupWorkflowHistory(ctx context.Context, cronWorkflow argov1alpha1.CronWorkflow,
+	workflows []argov1alpha1.Workflow) ([]argov1alpha1.Workflow, error) {
+	successfulLimit := int32(defaultSuccessfulJobsHistoryLimit)
+	if cronWorkflow.Spec.SuccessfulJobsHistoryLimit != nil {
+		successfulLimit = *cronWorkflow.Spec.SuccessfulJobsHistoryLimit
+	}
+	failedLimit := int32(defaultFailedJobsHistoryLimit)
+	if cronWorkflow.Spec.FailedJobsHistoryLimit != nil {
+		failedLimit = *cronWorkflow.Spec.FailedJobsHistoryLimit
+	}
+
+	// newest first so the oldest Workflows are the ones beyond the limits
+	sort.Slice(workflows, func(i, j int) bool {
+		return workflows[j].CreationTimestamp.Before(&workflows[i].CreationTimestamp)
+	})
+
+	var active []argov1alpha1.Workflow
+	var successful, failed int32
+	for i := range workflows {
+		workflow := workflows[i]
+		if workflow.DeletionTimestamp != nil {
+			continue
+		}
+
+		switch {
+		case !workflow.Status.Fulfilled():
+			active = append(active, workflow)
+			continue
+		case workflow.Status.Phase == argov1alpha1.WorkflowSucceeded:
+			successful++
+			if successful <= successfulLimit {
+				continue
+			}
+		default:
+			failed++
+			if failed <= failedLimit {
+				continue
+			}
+		}
+
+		if err := r.Delete(ctx, &workflow); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	return active, nil
+}
+
+// updateStatus records the active Workflows on the CronWorkflow status and updates the CronWorkflow
+func (r *CronWorkflowReconciler) updateStatus(ctx context.Context, cronWorkflow *argov1alpha1.CronWorkflow,
+	active []argov1alpha1.Workflow) error {
+	cronWorkflow.Status.Active = nil
+	for _, workflow := range active {
+		cronWorkflow.Status.Active = append(cronWorkflow.Status.Active, getWorkflowObjectReference(workflow))
+	}
+
+	if err := r.Update(ctx, cronWorkflow); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update CronWorkflow")
+		return err
+	}
+	return nil
+}
+
+// parseCronWorkflowSchedule parses the CronWorkflow schedule and the time zone it should be evaluated in
+func parseCronWorkflowSchedule(cronWorkflow argov1alpha1.CronWorkflow) (cron.Schedule, *time.Location, error) {
+	location, err := time.LoadLocation(cronWorkflow.Spec.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schedule, err := cron.ParseStandard(cronWorkflow.Spec.Schedule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return schedule, location, nil
+}
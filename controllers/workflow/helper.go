@@ -17,17 +17,49 @@ limitations under the License.
 package workflow
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 
+	"github.com/argoproj/argo-workflows/v3/pkg/apis/workflow"
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/robfig/cron/v3"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
 	workv1 "open-cluster-management.io/api/work/v1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 )
 
 func containsValidOCMLabel(workflow argov1alpha1.Workflow) bool {
-	labels := workflow.GetLabels()
+	return isOCMMulticlusterEnabled(workflow.GetLabels())
+}
+
+// isOCMMulticlusterEnabled returns true if the labels contain the enable OCM multicluster label with a true value
+func isOCMMulticlusterEnabled(labels map[string]string) bool {
 	if len(labels) == 0 {
 		return false
 	}
@@ -49,18 +81,728 @@ func containsValidOCMAnnotation(workflow argov1alpha1.Workflow) bool {
 		return false
 	}
 
-	managedClusterName, ok := annos[AnnotationKeyOCMManagedCluster]
-	return ok && len(managedClusterName) > 0
+	return len(getManagedClusterNames(workflow)) > 0
 }
 
-func containsValidOCMPlacementAnnotation(workflow argov1alpha1.Workflow) bool {
+// isFanOutWorkflow returns true if the Workflow should be propagated to every decided managed cluster
+func isFanOutWorkflow(workflow argov1alpha1.Workflow) bool {
+	return workflow.GetAnnotations()[AnnotationKeyOCMPlacementMode] == PlacementModeFanOut
+}
+
+// getManagedClusterNames returns the managed clusters the Workflow is propagated to.
+// The fan-out managed clusters annotation takes priority over the single managed cluster annotation.
+func getManagedClusterNames(workflow argov1alpha1.Workflow) []string {
 	annos := workflow.GetAnnotations()
 	if len(annos) == 0 {
+		return nil
+	}
+
+	if names := splitNames(annos[AnnotationKeyOCMManagedClusters]); len(names) > 0 {
+		return names
+	}
+
+	if name := annos[AnnotationKeyOCMManagedCluster]; len(name) > 0 {
+		return []string{name}
+	}
+
+	return nil
+}
+
+// splitNames returns the non empty names of a comma separated list
+func splitNames(value string) []string {
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// containsString returns true if the value is in the list
+func containsString(list []string, value string) bool {
+	for _, e := range list {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeClusterNames returns the managed cluster names that are not in the Workflow's excluded clusters annotation
+func excludeClusterNames(workflow argov1alpha1.Workflow, names []string) []string {
+	return excludeNames(names, splitNames(workflow.GetAnnotations()[AnnotationKeyOCMExcludedClusters]))
+}
+
+// excludeNames returns the names that are not in the excluded names, in order
+func excludeNames(names, excluded []string) []string {
+	filtered := []string{}
+	for _, name := range names {
+		if !containsString(excluded, name) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// getWorkflowResourceDemand returns the peak concurrent resource requests of the Workflow from its entrypoint,
+// given the specs of the WorkflowTemplates and ClusterWorkflowTemplates it references:
+// - a pod template requests the resources of its pod
+// - the steps of a step group and the DAG tasks of the same depth run side by side, a step or task expanded by withItems
+// or withSequence counts once per item, one expanded by withParam only counts once since its items are known at runtime
+// - a steps or DAG template needs its largest step group or DAG depth, capped by the template parallelism
+// The demand is at least the largest pod of the templates, and at most the largest pod times the Workflow parallelism when set.
+func getWorkflowResourceDemand(spec argov1alpha1.WorkflowSpec, templateSpecs map[templateReference]argov1alpha1.WorkflowSpec) corev1.ResourceList {
+	calculator := resourceDemandCalculator{
+		specs:        map[templateReference]argov1alpha1.WorkflowSpec{{}: spec},
+		podSpecPatch: spec.PodSpecPatch,
+		visiting:     map[scopedTemplateName]bool{},
+	}
+	for ref, templateSpec := range templateSpecs {
+		calculator.specs[ref] = templateSpec
+	}
+
+	entrypoint := spec.Entrypoint
+	if spec.WorkflowTemplateRef != nil {
+		ref := templateReference{Name: spec.WorkflowTemplateRef.Name, ClusterScope: spec.WorkflowTemplateRef.ClusterScope}
+		calculator.workflowTemplateRef = &ref
+		if len(entrypoint) == 0 {
+			entrypoint = templateSpecs[ref].Entrypoint
+		}
+	}
+
+	largestPod := corev1.ResourceList{}
+	for _, templateSpec := range calculator.specs {
+		for _, template := range templateSpec.Templates {
+			maxResourceList(largestPod, getTemplatePodRequests(template, spec.PodSpecPatch))
+		}
+	}
+
+	demand := corev1.ResourceList{}
+	maxResourceList(demand, largestPod)
+	maxResourceList(demand, calculator.getNamedTemplateDemand(templateReference{}, entrypoint))
+	if spec.Parallelism != nil && *spec.Parallelism > 0 {
+		for name, quantity := range largestPod {
+			if limit := multiplyQuantity(quantity, *spec.Parallelism); limit.Cmp(demand[name]) < 0 {
+				demand[name] = limit
+			}
+		}
+	}
+	return demand
+}
+
+// scopedTemplateName identifies a template by its name in the Workflow, i.e. the empty scope,
+// or in a referenced WorkflowTemplate or ClusterWorkflowTemplate
+type scopedTemplateName struct {
+	scope templateReference
+	name  string
+}
+
+// resourceDemandCalculator computes the peak concurrent resource requests of the templates of a Workflow
+type resourceDemandCalculator struct {
+	// specs are the Workflow spec, under the empty reference, and the specs of the templates it references
+	specs map[templateReference]argov1alpha1.WorkflowSpec
+	// workflowTemplateRef is the WorkflowTemplate the Workflow runs, its templates are looked up after the Workflow ones
+	workflowTemplateRef *templateReference
+	podSpecPatch        string
+	// visiting are the templates being computed, a recursive template only counts once
+	visiting map[scopedTemplateName]bool
+}
+
+// concurrentDemand is the resource demand of a step or DAG task, run count times side by side
+type concurrentDemand struct {
+	demand corev1.ResourceList
+	count  int64
+}
+
+// getNamedTemplateDemand returns the resource demand of the named template of the scope, nil if it does not exist
+func (c *resourceDemandCalculator) getNamedTemplateDemand(scope templateReference, name string) corev1.ResourceList {
+	scopes := []templateReference{scope}
+	if scope == (templateReference{}) && c.workflowTemplateRef != nil {
+		scopes = append(scopes, *c.workflowTemplateRef)
+	}
+	for _, templateScope := range scopes {
+		for _, template := range c.specs[templateScope].Templates {
+			key := scopedTemplateName{scope: templateScope, name: name}
+			if template.Name != name || c.visiting[key] {
+				continue
+			}
+			c.visiting[key] = true
+			defer delete(c.visiting, key)
+			return c.getTemplateDemand(templateScope, template)
+		}
+	}
+	return nil
+}
+
+// getTemplateDemand returns the resource demand of the template, the steps and DAG tasks are looked up in the scope
+// of the template unless they reference another WorkflowTemplate or ClusterWorkflowTemplate
+func (c *resourceDemandCalculator) getTemplateDemand(scope templateReference, template argov1alpha1.Template) corev1.ResourceList {
+	groups := [][]concurrentDemand{}
+	switch {
+	case template.Steps != nil:
+		for _, parallelSteps := range template.Steps {
+			group := []concurrentDemand{}
+			for _, step := range parallelSteps.Steps {
+				group = append(group, concurrentDemand{
+					demand: c.getInvocationDemand(scope, step.Template, step.TemplateRef, step.Inline),
+					count:  getExpansionCount(step.WithItems, step.WithSequence),
+				})
+			}
+			groups = append(groups, group)
+		}
+	case template.DAG != nil:
+		depths := getDAGTaskDepths(template.DAG.Tasks)
+		for i, task := range template.DAG.Tasks {
+			for len(groups) <= depths[i] {
+				groups = append(groups, []concurrentDemand{})
+			}
+			groups[depths[i]] = append(groups[depths[i]], concurrentDemand{
+				demand: c.getInvocationDemand(scope, task.Template, task.TemplateRef, task.Inline),
+				count:  getExpansionCount(task.WithItems, task.WithSequence),
+			})
+		}
+	default:
+		return getTemplatePodRequests(template, c.podSpecPatch)
+	}
+
+	demand := corev1.ResourceList{}
+	for _, group := range groups {
+		total, largest := corev1.ResourceList{}, corev1.ResourceList{}
+		for _, child := range group {
+			for name, quantity := range child.demand {
+				addResourceList(total, corev1.ResourceList{name: multiplyQuantity(quantity, child.count)})
+			}
+			maxResourceList(largest, child.demand)
+		}
+		if template.Parallelism != nil && *template.Parallelism > 0 {
+			for name, quantity := range largest {
+				if limit := multiplyQuantity(quantity, *template.Parallelism); limit.Cmp(total[name]) < 0 {
+					total[name] = limit
+				}
+			}
+		}
+		maxResourceList(demand, total)
+	}
+	return demand
+}
+
+// getInvocationDemand returns the resource demand of the template a step or DAG task runs
+func (c *resourceDemandCalculator) getInvocationDemand(scope templateReference, name string, templateRef *argov1alpha1.TemplateRef,
+	inline *argov1alpha1.Template) corev1.ResourceList {
+	switch {
+	case inline != nil:
+		return c.getTemplateDemand(scope, *inline)
+	case templateRef != nil:
+		return c.getNamedTemplateDemand(templateReference{Name: templateRef.Name, ClusterScope: templateRef.ClusterScope}, templateRef.Template)
+	default:
+		return c.getNamedTemplateDemand(scope, name)
+	}
+}
+
+// getExpansionCount returns the number of steps or DAG tasks a step or DAG task expands into,
+// at least one since a withParam expansion or a sequence with expressions is only known at runtime
+func getExpansionCount(withItems []argov1alpha1.Item, withSequence *argov1alpha1.Sequence) int64 {
+	if len(withItems) > 0 {
+		return int64(len(withItems))
+	}
+	if withSequence == nil {
+		return 1
+	}
+
+	parse := func(value *intstr.IntOrString) (int64, bool) {
+		if value == nil {
+			return 0, true
+		}
+		number, err := strconv.ParseInt(value.String(), 10, 64)
+		return number, err == nil
+	}
+	var count int64
+	if withSequence.Count != nil {
+		number, ok := parse(withSequence.Count)
+		if !ok {
+			return 1
+		}
+		count = number
+	} else {
+		start, okStart := parse(withSequence.Start)
+		end, okEnd := parse(withSequence.End)
+		if !okStart || !okEnd {
+			return 1
+		}
+		if count = end - start + 1; end < start {
+			count = start - end + 1
+		}
+	}
+	if count < 1 {
+		return 1
+	}
+	return count
+}
+
+// dependsSeparator splits a DAG task depends expression, e.g. "(a || b.Failed) && !c.Errored", around the task names
+var dependsSeparator = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// getDAGTaskDepths returns the depth of every DAG task, i.e. the length of its longest chain of dependencies,
+// from the task dependencies or the task names in its depends expression. The tasks of the same depth do not
+// depend on each other, a dependency cycle is cut where it is found.
+func getDAGTaskDepths(tasks []argov1alpha1.DAGTask) []int {
+	indexes := map[string]int{}
+	for i, task := range tasks {
+		indexes[task.Name] = i
+	}
+	dependencies := make([][]int, len(tasks))
+	for i, task := range tasks {
+		names := append([]string{}, task.Dependencies...)
+		names = append(names, dependsSeparator.Split(task.Depends, -1)...)
+		for _, name := range names {
+			if index, ok := indexes[name]; ok && index != i {
+				dependencies[i] = append(dependencies[i], index)
+			}
+		}
+	}
+
+	depths := make([]int, len(tasks))
+	visited := make([]bool, len(tasks))
+	var getDepth func(i int) int
+	getDepth = func(i int) int {
+		if visited[i] {
+			return depths[i]
+		}
+		visited[i] = true
+		for _, dependency := range dependencies[i] {
+			if depth := getDepth(dependency) + 1; depth > depths[i] {
+				depths[i] = depth
+			}
+		}
+		return depths[i]
+	}
+	for i := range tasks {
+		getDepth(i)
+	}
+	return depths
+}
+
+// addResourceList adds the quantities of the other resource list to the resource list
+func addResourceList(list, other corev1.ResourceList) {
+	for name, quantity := range other {
+		current := list[name].DeepCopy()
+		current.Add(quantity)
+		list[name] = current
+	}
+}
+
+// maxResourceList raises the quantities of the resource list to the larger quantities of the other resource list
+func maxResourceList(list, other corev1.ResourceList) {
+	for name, quantity := range other {
+		if current, ok := list[name]; !ok || quantity.Cmp(current) > 0 {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// multiplyQuantity returns the quantity times the factor, the largest quantity when the product overflows
+func multiplyQuantity(quantity resource.Quantity, factor int64) resource.Quantity {
+	milliValue := quantity.MilliValue()
+	if milliValue > 0 && milliValue > math.MaxInt64/factor {
+		return *resource.NewMilliQuantity(math.MaxInt64, quantity.Format)
+	}
+	return *resource.NewMilliQuantity(milliValue*factor, quantity.Format)
+}
+
+// getTemplatePodRequests returns the resource requests of the pod the template runs, nil for a template without a pod,
+// e.g. steps or a DAG. The containers run side by side while the init containers run one at a time before them.
+// The Workflow pod spec patch then the template one override the container resources, a patch with expressions is ignored.
+func getTemplatePodRequests(template argov1alpha1.Template, workflowPodSpecPatch string) corev1.ResourceList {
+	containers := []corev1.Container{}
+	switch {
+	case template.Container != nil:
+		containers = append(containers, *template.Container)
+	case template.Script != nil:
+		containers = append(containers, template.Script.Container)
+	case template.ContainerSet != nil:
+		for _, container := range template.ContainerSet.Containers {
+			containers = append(containers, container.Container)
+		}
+	default:
+		return nil
+	}
+	for _, sidecar := range template.Sidecars {
+		containers = append(containers, sidecar.Container)
+	}
+	initContainers := []corev1.Container{}
+	for _, initContainer := range template.InitContainers {
+		initContainers = append(initContainers, initContainer.Container)
+	}
+
+	for _, podSpecPatch := range []string{workflowPodSpecPatch, template.PodSpecPatch} {
+		patch := corev1.PodSpec{}
+		if len(podSpecPatch) == 0 || yaml.Unmarshal([]byte(podSpecPatch), &patch) != nil {
+			continue
+		}
+		patchContainerResources(containers, patch.Containers)
+		patchContainerResources(initContainers, patch.InitContainers)
+	}
+
+	requests := corev1.ResourceList{}
+	for _, container := range containers {
+		for name, quantity := range getContainerRequests(container) {
+			current := requests[name]
+			current.Add(quantity)
+			requests[name] = current
+		}
+	}
+	for _, initContainer := range initContainers {
+		for name, quantity := range getContainerRequests(initContainer) {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity
+			}
+		}
+	}
+	return requests
+}
+
+// patchContainerResources overrides the resources of the containers with the resources of the patch containers of the same name,
+// a template's single container is named main
+func patchContainerResources(containers []corev1.Container, patches []corev1.Container) {
+	for i := range containers {
+		name := containers[i].Name
+		if len(name) == 0 {
+			name = "main"
+		}
+		for _, patch := range patches {
+			if patch.Name != name {
+				continue
+			}
+			// the resource lists are shared with the template
+			containers[i].Resources = *containers[i].Resources.DeepCopy()
+			for resourceName, quantity := range patch.Resources.Requests {
+				if containers[i].Resources.Requests == nil {
+					containers[i].Resources.Requests = corev1.ResourceList{}
+				}
+				containers[i].Resources.Requests[resourceName] = quantity
+			}
+			for resourceName, quantity := range patch.Resources.Limits {
+				if containers[i].Resources.Limits == nil {
+					containers[i].Resources.Limits = corev1.ResourceList{}
+				}
+				containers[i].Resources.Limits[resourceName] = quantity
+			}
+		}
+	}
+}
+
+// getContainerRequests returns the container resource requests, the requests default to the limits like Kubernetes does
+func getContainerRequests(container corev1.Container) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for name, quantity := range container.Resources.Limits {
+		requests[name] = quantity
+	}
+	for name, quantity := range container.Resources.Requests {
+		requests[name] = quantity
+	}
+	return requests
+}
+
+// fitsResourceDemand returns true if the ManagedCluster free resources fit the Workflow resource demand,
+// the resources the ManagedCluster does not report are not checked
+func fitsResourceDemand(managedCluster clusterv1.ManagedCluster, demand corev1.ResourceList) bool {
+	free := getManagedClusterFreeResources(managedCluster)
+	for name, quantity := range demand {
+		if available, ok := free[name]; ok && available.Cmp(quantity) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// getManagedClusterFreeResources returns the allocatable resources of the ManagedCluster minus the resources in use,
+// as reported by its resource usage claim. Without a valid claim the ManagedCluster is considered idle.
+func getManagedClusterFreeResources(managedCluster clusterv1.ManagedCluster) corev1.ResourceList {
+	free := corev1.ResourceList{}
+	for name, quantity := range managedCluster.Status.Allocatable {
+		free[corev1.ResourceName(name)] = quantity.DeepCopy()
+	}
+
+	used := corev1.ResourceList{}
+	for _, claim := range managedCluster.Status.ClusterClaims {
+		if claim.Name == ClusterClaimResourceUsage && json.Unmarshal([]byte(claim.Value), &used) != nil {
+			used = corev1.ResourceList{}
+		}
+	}
+	for name, quantity := range used {
+		if available, ok := free[name]; ok {
+			available.Sub(quantity)
+			free[name] = available
+		}
+	}
+	return free
+}
+
+// getPlacementScoreReference returns the AddOnPlacementScore name and the score name the Workflow ranks the decided
+// managed clusters by, false if the Workflow does not rank them
+func getPlacementScoreReference(workflow argov1alpha1.Workflow) (string, string, bool) {
+	parts := strings.Split(workflow.GetAnnotations()[AnnotationKeyOCMPlacementScore], "/")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// getPlacementScore returns the value of the named score, false if the AddOnPlacementScore does not have it or its scores expired
+func getPlacementScore(score clusterv1alpha1.AddOnPlacementScore, scoreName string, now time.Time) (int32, bool) {
+	if score.Status.ValidUntil != nil && score.Status.ValidUntil.Time.Before(now) {
+		return 0, false
+	}
+	for _, item := range score.Status.Scores {
+		if item.Name == scoreName {
+			return item.Value, true
+		}
+	}
+	return 0, false
+}
+
+// rankClusterNamesByScore orders the managed cluster names by descending score, the clusters without a score come last
+// and the clusters with the same score keep the decision order
+func rankClusterNamesByScore(names []string, scores map[string]int32) []string {
+	ranked := append([]string{}, names...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		scoreI, okI := scores[ranked[i]]
+		scoreJ, okJ := scores[ranked[j]]
+		if okI != okJ {
+			return okI
+		}
+		return scoreI > scoreJ
+	})
+	return ranked
+}
+
+// prepareWorkflowForReschedule modifies the Workflow so it is placed again by its last Placement:
+// - add the managed cluster to the excluded clusters
+// - restore the Placement annotation
+// - remove the managed cluster(s) annotations, a fan-out Workflow only loses the given managed cluster
+// and keeps running on the other ones
+// Returns false if the Workflow has no Placement to be placed again with.
+func prepareWorkflowForReschedule(workflow *argov1alpha1.Workflow, managedClusterName string) bool {
+	annos := workflow.GetAnnotations()
+	lastPlacement := annos[AnnotationKeyOCMLastPlacement]
+	if len(lastPlacement) == 0 {
+		return false
+	}
+
+	excluded := splitNames(annos[AnnotationKeyOCMExcludedClusters])
+	if !containsString(excluded, managedClusterName) {
+		excluded = append(excluded, managedClusterName)
+	}
+
+	remaining := []string{}
+	for _, name := range getManagedClusterNames(*workflow) {
+		if name != managedClusterName {
+			remaining = append(remaining, name)
+		}
+	}
+
+	annos[AnnotationKeyOCMExcludedClusters] = strings.Join(excluded, ",")
+	annos[AnnotationKeyOCMPlacement] = lastPlacement
+	if isFanOutWorkflow(*workflow) && len(remaining) > 0 {
+		annos[AnnotationKeyOCMManagedClusters] = strings.Join(remaining, ",")
+	} else {
+		delete(annos, AnnotationKeyOCMManagedCluster)
+		delete(annos, AnnotationKeyOCMManagedClusters)
+		delete(annos, AnnotationKeyOCMRemoteDeletedClusters)
+		delete(annos, AnnotationKeyOCMLostClusters)
+		delete(annos, AnnotationKeyOCMOutputs)
+		delete(annos, AnnotationKeyOCMQueueAdmitted)
+	}
+	workflow.SetAnnotations(annos)
+
+	// the next managed cluster results start over
+	accepted := getAcceptedStatusResults(*workflow)
+	delete(accepted, managedClusterName)
+	setAcceptedStatusResults(workflow, accepted)
+
+	return true
+}
+
+// getDecidedClusterNames returns the unique managed cluster names across every PlacementDecision page, in decision order
+func getDecidedClusterNames(placementDecisions []clusterv1beta1.PlacementDecision) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, pd := range placementDecisions {
+		for _, decision := range pd.Status.Decisions {
+			if len(decision.ClusterName) == 0 || seen[decision.ClusterName] {
+				continue
+			}
+			seen[decision.ClusterName] = true
+			names = append(names, decision.ClusterName)
+		}
+	}
+	return names
+}
+
+// getPlacementDecisionNames returns the names of the PlacementDecisions that decided the given managed clusters, in list order
+func getPlacementDecisionNames(placementDecisions []clusterv1beta1.PlacementDecision, clusterNames []string) []string {
+	names := []string{}
+	for _, pd := range placementDecisions {
+		for _, decision := range pd.Status.Decisions {
+			if containsString(clusterNames, decision.ClusterName) {
+				names = append(names, pd.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// GetPlacementDecisionRecord returns the result of the last Placement evaluation of the Workflow,
+// false if the Workflow was not placed through a Placement or the records are invalid
+func GetPlacementDecisionRecord(workflow argov1alpha1.Workflow) (PlacementDecisionRecord, bool) {
+	records := GetPlacementDecisionRecords(workflow)
+	if len(records) == 0 {
+		return PlacementDecisionRecord{}, false
+	}
+	return records[len(records)-1], true
+}
+
+// GetPlacementDecisionRecords returns the results of the Placement evaluations of the Workflow, oldest first,
+// nil if the Workflow was not placed through a Placement or the records are invalid.
+// The Workflows placed before the records were kept have a single record.
+func GetPlacementDecisionRecords(workflow argov1alpha1.Workflow) []PlacementDecisionRecord {
+	value := workflow.GetAnnotations()[AnnotationKeyOCMPlacementDecision]
+	if len(value) == 0 {
+		return nil
+	}
+
+	records := []PlacementDecisionRecord{}
+	if err := json.Unmarshal([]byte(value), &records); err == nil {
+		return records
+	}
+	record := PlacementDecisionRecord{}
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return nil
+	}
+	return []PlacementDecisionRecord{record}
+}
+
+// appendPlacementDecisionRecord appends the result of a Placement evaluation to the records of the Workflow,
+// only the last maxPlacementDecisionRecords records are kept
+func appendPlacementDecisionRecord(workflow *argov1alpha1.Workflow, record PlacementDecisionRecord) error {
+	records := append(GetPlacementDecisionRecords(*workflow), record)
+	if len(records) > maxPlacementDecisionRecords {
+		records = records[len(records)-maxPlacementDecisionRecords:]
+	}
+	value, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	annos := workflow.GetAnnotations()
+	if annos == nil {
+		annos = map[string]string{}
+	}
+	annos[AnnotationKeyOCMPlacementDecision] = string(value)
+	workflow.SetAnnotations(annos)
+	return nil
+}
+
+// containsValidOCMPlacementAnnotation returns true if the Workflow waits to be placed by its Placement, pre-created or inline.
+// The Placement annotation is kept once the Workflow is placed, the Workflow is placed again when its last placement decision
+// record is for another Placement or its managed cluster(s) changed, e.g. when it is rescheduled.
+func containsValidOCMPlacementAnnotation(workflow argov1alpha1.Workflow) bool {
+	if hasPendingInlinePlacement(workflow) {
+		return true
+	}
+	placementName := workflow.GetAnnotations()[AnnotationKeyOCMPlacement]
+	if len(placementName) == 0 {
+		return false
+	}
+
+	record, ok := GetPlacementDecisionRecord(workflow)
+	if !ok || record.Placement != placementName {
+		return true
+	}
+	managedClusterNames := getManagedClusterNames(workflow)
+	return len(excludeNames(record.Clusters, managedClusterNames)) > 0 || len(excludeNames(managedClusterNames, record.Clusters)) > 0
+}
+
+// hasPendingInlinePlacement returns true if the Workflow has an inline Placement spec that was not evaluated yet,
+// once evaluated the Workflow is placed again through the last Placement annotation like with a pre-created Placement
+func hasPendingInlinePlacement(workflow argov1alpha1.Workflow) bool {
+	annos := workflow.GetAnnotations()
+	return len(annos[AnnotationKeyOCMPlacementSpec]) > 0 && len(annos[AnnotationKeyOCMLastPlacement]) == 0 &&
+		len(annos[AnnotationKeyOCMManagedCluster]) == 0 && len(annos[AnnotationKeyOCMManagedClusters]) == 0
+}
+
+// getAwaitedPlacementName returns the name of the Placement the Workflow waits for a decision of, empty if none
+func getAwaitedPlacementName(workflow argov1alpha1.Workflow) string {
+	if !containsValidOCMPlacementAnnotation(workflow) {
+		return ""
+	}
+	if placementName := workflow.GetAnnotations()[AnnotationKeyOCMPlacement]; len(placementName) > 0 {
+		return placementName
+	}
+	if len(workflow.UID) >= 5 {
+		return generateInlinePlacementName(workflow)
+	}
+	return ""
+}
+
+// setAwaitingPlacementDecisionStatus sets the Workflow status to Pending with the AwaitingPlacementDecision condition,
+// the status is replaced once the Placement is evaluated
+func setAwaitingPlacementDecisionStatus(workflow *argov1alpha1.Workflow, message string) {
+	workflow.Status = argov1alpha1.WorkflowStatus{
+		Phase:   argov1alpha1.WorkflowPending,
+		Message: message,
+	}
+	workflow.Status.Conditions.UpsertCondition(argov1alpha1.Condition{
+		Type:    ConditionTypeAwaitingPlacementDecision,
+		Status:  metav1.ConditionTrue,
+		Message: message,
+	})
+}
+
+// isAwaitingPlacementDecision returns true if the Workflow is Pending with the AwaitingPlacementDecision condition
+func isAwaitingPlacementDecision(workflow argov1alpha1.Workflow) bool {
+	if workflow.Status.Phase != argov1alpha1.WorkflowPending {
 		return false
 	}
+	for _, condition := range workflow.Status.Conditions {
+		if condition.Type == ConditionTypeAwaitingPlacementDecision && condition.Status == metav1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// generateInlinePlacementName returns the name of the Placement generated from the Workflow inline Placement spec,
+// the suffix of the Workflow UID tells apart the Placements of the deleted Workflows of the same name.
+// The name is the PlacementDecisions label value, it is shortened to the label value length.
+func generateInlinePlacementName(workflow argov1alpha1.Workflow) string {
+	return shortenName(workflow.Name+"-"+string(workflow.UID)[0:5], maxLabelValueLength)
+}
+
+// generateInlinePlacement returns the Placement of the Workflow inline Placement spec, owned by the Workflow
+func generateInlinePlacement(workflow argov1alpha1.Workflow) (*clusterv1beta1.Placement, error) {
+	spec := clusterv1beta1.PlacementSpec{}
+	if err := yaml.UnmarshalStrict([]byte(workflow.GetAnnotations()[AnnotationKeyOCMPlacementSpec]), &spec); err != nil {
+		return nil, err
+	}
 
-	placementName, ok := annos[AnnotationKeyOCMPlacement]
-	return ok && len(placementName) > 0
+	controller := true
+	return &clusterv1beta1.Placement{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateInlinePlacementName(workflow),
+			Namespace: workflow.Namespace,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: argov1alpha1.SchemeGroupVersion.String(),
+				Kind:       argov1alpha1.WorkflowSchemaGroupVersionKind.Kind,
+				Name:       workflow.Name,
+				UID:        workflow.UID,
+				Controller: &controller,
+			}},
+		},
+		Spec: spec,
+	}, nil
 }
 
 // generateWorkflowNamespace returns the intended namespace for the Workflow in the following priority
@@ -82,12 +824,94 @@ func generateWorkflowNamespace(workflow argov1alpha1.Workflow) string {
 	return "argo" // TODO find the constant value from the argo API for this field
 }
 
+// ensureHubOnlyLabel labels the Workflow or CronWorkflow with the hub controller instance ID so the hub Argo controller
+// ignores it. Another instance ID is the one of the managed cluster Argo controller, it is moved to an annotation.
+// Returns true if the label was set.
+func ensureHubOnlyLabel(obj metav1.Object, instanceID string) bool {
+	labels := obj.GetLabels()
+	current := labels[LabelKeyControllerInstanceID]
+	if len(instanceID) == 0 || current == instanceID {
+		return false
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	if len(current) > 0 {
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[AnnotationKeyOCMControllerInstanceID] = current
+		obj.SetAnnotations(annotations)
+	}
+	labels[LabelKeyControllerInstanceID] = instanceID
+	obj.SetLabels(labels)
+	return true
+}
+
+// setHubOnlyCondition shows on the hub Workflow status that it is not executed on the hub cluster,
+// the condition is set again whenever the status is replaced by the managed cluster status
+func setHubOnlyCondition(workflow *argov1alpha1.Workflow) {
+	instanceID := workflow.Labels[LabelKeyControllerInstanceID]
+	if len(instanceID) == 0 {
+		return
+	}
+	workflow.Status.Conditions.UpsertCondition(argov1alpha1.Condition{
+		Type:   ConditionTypeHubOnly,
+		Status: metav1.ConditionTrue,
+		Message: "the Workflow is executed on the managed cluster(s), the hub Argo controller ignores it with the controller instance ID " +
+			instanceID,
+	})
+}
+
+// isHubOnlyAnnotation returns true if the annotation is only used to track the Workflow on the hub cluster
+func isHubOnlyAnnotation(key string) bool {
+	return key == AnnotationKeyOCMManagedClusterStatuses || key == AnnotationKeyOCMClusterAttempts ||
+		key == AnnotationKeyOCMRemoteDeletedClusters || key == AnnotationKeyOCMOutputs || key == AnnotationKeyOCMPlacementDecision ||
+		key == AnnotationKeyOCMQueueAdmitted || key == AnnotationKeyOCMAcceptedResults || key == AnnotationKeyOCMLostClusters ||
+		key == AnnotationKeyOCMControllerInstanceID
+}
+
+// hasWorkPayloadChanged returns true if the Workflow changed in a way that affects its ManifestWork,
+// i.e. the spec, the labels, the annotations that are propagated or the finalizers
+func hasWorkPayloadChanged(oldWorkflow, newWorkflow argov1alpha1.Workflow) bool {
+	if !equality.Semantic.DeepEqual(oldWorkflow.Spec, newWorkflow.Spec) ||
+		!reflect.DeepEqual(oldWorkflow.Labels, newWorkflow.Labels) ||
+		!reflect.DeepEqual(oldWorkflow.Finalizers, newWorkflow.Finalizers) {
+		return true
+	}
+
+	oldAnnotations, newAnnotations := map[string]string{}, map[string]string{}
+	for k, v := range oldWorkflow.Annotations {
+		if !isHubOnlyAnnotation(k) {
+			oldAnnotations[k] = v
+		}
+	}
+	for k, v := range newWorkflow.Annotations {
+		if !isHubOnlyAnnotation(k) {
+			newAnnotations[k] = v
+		}
+	}
+	return !reflect.DeepEqual(oldAnnotations, newAnnotations)
+}
+
 // generateManifestWorkName returns the ManifestWork name for a given workflow.
 // It uses the Workflow name with the suffix of the first 5 characters of the UID
 func generateManifestWorkName(workflow argov1alpha1.Workflow) string {
 	return workflow.Name + "-" + string(workflow.UID)[0:5]
 }
 
+// shortenName returns the name cut to the maximum length, the cut name ends with a hash of the whole name
+// so the long names with the same beginning stay apart
+func shortenName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[0:8]
+	return strings.TrimRight(name[0:maxLength-len(hash)-1], "-.") + "-" + hash
+}
+
 // prepareWorkflowForWorkPayload modifies the Workflow:
 // - reste the type and object meta
 // - set the namespace value
@@ -98,18 +922,33 @@ func prepareWorkflowForWorkPayload(workflow argov1alpha1.Workflow) argov1alpha1.
 		Kind:       argov1alpha1.WorkflowSchemaGroupVersionKind.Kind,
 	}
 
-	if workflow.Labels == nil {
-		workflow.Labels = make(map[string]string)
+	// the managed cluster Argo controller executes the Workflow with the instance ID the user set, if any,
+	// instead of the hub controller instance ID
+	labels := make(map[string]string, len(workflow.Labels))
+	for k, v := range workflow.Labels {
+		if k != LabelKeyControllerInstanceID {
+			labels[k] = v
+		}
 	}
+	if instanceID := workflow.Annotations[AnnotationKeyOCMControllerInstanceID]; len(instanceID) > 0 {
+		labels[LabelKeyControllerInstanceID] = instanceID
+	}
+	workflow.Labels = labels
 
-	if workflow.Annotations == nil {
-		workflow.Annotations = make(map[string]string)
+	// the hub bookkeeping annotations are not needed on the managed cluster
+	annotations := make(map[string]string, len(workflow.Annotations))
+	for k, v := range workflow.Annotations {
+		if !isHubOnlyAnnotation(k) {
+			annotations[k] = v
+		}
 	}
+	workflow.Annotations = annotations
 
 	// TODO better handling of the managed cluster Workflow labels and annotations
 	workflow.Labels[LabelKeyEnableOCMMulticluster] = "false"
 	workflow.Annotations[AnnotationKeyHubWorkflowNamespace] = workflow.Namespace
 	workflow.Annotations[AnnotationKeyHubWorkflowName] = workflow.Name
+	workflow.Annotations[AnnotationKeyHubWorkflowUID] = string(workflow.UID)
 
 	workflow.ObjectMeta = metav1.ObjectMeta{
 		Name:        workflow.Name,
@@ -124,33 +963,1514 @@ func prepareWorkflowForWorkPayload(workflow argov1alpha1.Workflow) argov1alpha1.
 	return workflow
 }
 
-// generateManifestWork creates the ManifestWork that wraps the Workflow as payload
-// With the status sync feedback of Workflow's phase
-func generateManifestWork(name, namespace string, workflow argov1alpha1.Workflow) *workv1.ManifestWork {
-	return &workv1.ManifestWork{ // TODO use OCM API helper to generate manifest work.
-		TypeMeta: metav1.TypeMeta{},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-		},
-		Spec: workv1.ManifestWorkSpec{
-			Workload: workv1.ManifestsTemplate{
-				Manifests: []workv1.Manifest{{RawExtension: runtime.RawExtension{Object: &workflow}}},
-			},
-			// TODO always assume the status sync addon is installed
-			// ManifestConfigs: []workv1.ManifestConfigOption{
-			// 	{
-			// 		ResourceIdentifier: workv1.ResourceIdentifier{
-			// 			Group:     argov1alpha1.SchemeGroupVersion.Group,
-			// 			Resource:  "workflows", // TODO find the constant value from the argo API for this field
-			// 			Namespace: workflow.Namespace,
-			// 			Name:      workflow.Name,
-			// 		},
-			// 		FeedbackRules: []workv1.FeedbackRule{
-			// 			{Type: workv1.JSONPathsType, JsonPaths: []workv1.JsonPath{{Name: "phase", Path: ".status.phase"}}},
-			// 		},
-			// 	},
-			// },
-		},
+// templateReference identifies a WorkflowTemplate, or a ClusterWorkflowTemplate when cluster scoped
+type templateReference struct {
+	Name         string
+	ClusterScope bool
+}
+
+// getTemplateReferences returns the unique WorkflowTemplate and ClusterWorkflowTemplate references of a Workflow spec
+// from its workflowTemplateRef and the templateRef of every step, DAG task and lifecycle hook.
+func getTemplateReferences(spec argov1alpha1.WorkflowSpec) []templateReference {
+	refs := []templateReference{}
+	seen := map[templateReference]bool{}
+	add := func(name string, clusterScope bool) {
+		ref := templateReference{Name: name, ClusterScope: clusterScope}
+		if len(name) == 0 || seen[ref] {
+			return
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+	addHooks := func(hooks argov1alpha1.LifecycleHooks) {
+		for _, hook := range hooks {
+			if hook.TemplateRef != nil {
+				add(hook.TemplateRef.Name, hook.TemplateRef.ClusterScope)
+			}
+		}
 	}
+
+	if spec.WorkflowTemplateRef != nil {
+		add(spec.WorkflowTemplateRef.Name, spec.WorkflowTemplateRef.ClusterScope)
+	}
+	addHooks(spec.Hooks)
+
+	for _, template := range spec.Templates {
+		for _, parallelSteps := range template.Steps {
+			for _, step := range parallelSteps.Steps {
+				if step.TemplateRef != nil {
+					add(step.TemplateRef.Name, step.TemplateRef.ClusterScope)
+				}
+				addHooks(step.Hooks)
+			}
+		}
+
+		if template.DAG != nil {
+			for _, task := range template.DAG.Tasks {
+				if task.TemplateRef != nil {
+					add(task.TemplateRef.Name, task.TemplateRef.ClusterScope)
+				}
+				addHooks(task.Hooks)
+			}
+		}
+	}
+
+	return refs
+}
+
+// getTemplateReferenceIndexValue returns the template reference index value of the WorkflowTemplate or ClusterWorkflowTemplate
+func getTemplateReferenceIndexValue(ref templateReference) string {
+	if ref.ClusterScope {
+		return workflow.ClusterWorkflowTemplateKind + "/" + ref.Name
+	}
+	return workflow.WorkflowTemplateKind + "/" + ref.Name
+}
+
+// getTemplateReferenceIndexValues returns the template reference index values of the templates the Workflow spec references
+func getTemplateReferenceIndexValues(spec argov1alpha1.WorkflowSpec) []string {
+	values := []string{}
+	for _, ref := range getTemplateReferences(spec) {
+		values = append(values, getTemplateReferenceIndexValue(ref))
+	}
+	return values
+}
+
+// prepareWorkflowTemplateForWorkPayload resets the type and object meta of the WorkflowTemplate
+// and sets the namespace value to the managed cluster Workflow namespace
+func prepareWorkflowTemplateForWorkPayload(workflowTemplate argov1alpha1.WorkflowTemplate, namespace string) *argov1alpha1.WorkflowTemplate {
+	workflowTemplate.TypeMeta = metav1.TypeMeta{
+		APIVersion: argov1alpha1.SchemeGroupVersion.String(),
+		Kind:       workflow.WorkflowTemplateKind,
+	}
+
+	workflowTemplate.ObjectMeta = metav1.ObjectMeta{
+		Name:        workflowTemplate.Name,
+		Namespace:   namespace,
+		Labels:      workflowTemplate.Labels,
+		Annotations: workflowTemplate.Annotations,
+	}
+
+	return &workflowTemplate
+}
+
+// prepareClusterWorkflowTemplateForWorkPayload resets the type and object meta of the ClusterWorkflowTemplate
+func prepareClusterWorkflowTemplateForWorkPayload(clusterWorkflowTemplate argov1alpha1.ClusterWorkflowTemplate) *argov1alpha1.ClusterWorkflowTemplate {
+	clusterWorkflowTemplate.TypeMeta = metav1.TypeMeta{
+		APIVersion: argov1alpha1.SchemeGroupVersion.String(),
+		Kind:       workflow.ClusterWorkflowTemplateKind,
+	}
+
+	clusterWorkflowTemplate.ObjectMeta = metav1.ObjectMeta{
+		Name:        clusterWorkflowTemplate.Name,
+		Labels:      clusterWorkflowTemplate.Labels,
+		Annotations: clusterWorkflowTemplate.Annotations,
+	}
+
+	return &clusterWorkflowTemplate
+}
+
+const (
+	dependencyKindConfigMap      = "ConfigMap"
+	dependencyKindSecret         = "Secret"
+	dependencyKindServiceAccount = "ServiceAccount"
+	// defaultArtifactRepositoryConfigMap is the ConfigMap Argo reads when the artifact repository ref omits it
+	defaultArtifactRepositoryConfigMap = "artifact-repositories"
+	// defaultServiceAccountName exists in every namespace so it is never shipped to the managed cluster
+	defaultServiceAccountName = "default"
+	// executorRoleName is the name of the Role created for the Argo executor, its RoleBindings are named after it
+	executorRoleName = "argo-workflow-multicluster-executor"
+	// maxObjectNameLength is the maximum length of the names that are not DNS labels, e.g. a RoleBinding name
+	maxObjectNameLength = 253
+	// maxLabelValueLength is the maximum length of a label value, e.g. the Placement name of the PlacementDecisions
+	maxLabelValueLength = 63
+)
+
+// dependencyReference identifies a ConfigMap, Secret or ServiceAccount the Workflow needs on the managed cluster
+type dependencyReference struct {
+	Kind string
+	Name string
+}
+
+// dependencyReferences collects the dependency references in order, without duplicates
+type dependencyReferences struct {
+	refs []dependencyReference
+	seen map[dependencyReference]bool
+}
+
+func (d *dependencyReferences) add(kind, name string) {
+	ref := dependencyReference{Kind: kind, Name: name}
+	if len(name) == 0 || d.seen[ref] {
+		return
+	}
+	if kind == dependencyKindServiceAccount && name == defaultServiceAccountName {
+		return
+	}
+	if d.seen == nil {
+		d.seen = map[dependencyReference]bool{}
+	}
+	d.seen[ref] = true
+	d.refs = append(d.refs, ref)
+}
+
+func (d *dependencyReferences) addSecretKeySelectors(selectors ...*corev1.SecretKeySelector) {
+	for _, selector := range selectors {
+		if selector != nil {
+			d.add(dependencyKindSecret, selector.Name)
+		}
+	}
+}
+
+func (d *dependencyReferences) addContainer(container corev1.Container) {
+	for _, env := range container.Env {
+		if env.ValueFrom == nil {
+			continue
+		}
+		if env.ValueFrom.ConfigMapKeyRef != nil {
+			d.add(dependencyKindConfigMap, env.ValueFrom.ConfigMapKeyRef.Name)
+		}
+		d.addSecretKeySelectors(env.ValueFrom.SecretKeyRef)
+	}
+
+	for _, envFrom := range container.EnvFrom {
+		if envFrom.ConfigMapRef != nil {
+			d.add(dependencyKindConfigMap, envFrom.ConfigMapRef.Name)
+		}
+		if envFrom.SecretRef != nil {
+			d.add(dependencyKindSecret, envFrom.SecretRef.Name)
+		}
+	}
+}
+
+func (d *dependencyReferences) addVolumes(volumes []corev1.Volume) {
+	for _, volume := range volumes {
+		if volume.ConfigMap != nil {
+			d.add(dependencyKindConfigMap, volume.ConfigMap.Name)
+		}
+		if volume.Secret != nil {
+			d.add(dependencyKindSecret, volume.Secret.SecretName)
+		}
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.ConfigMap != nil {
+				d.add(dependencyKindConfigMap, source.ConfigMap.Name)
+			}
+			if source.Secret != nil {
+				d.add(dependencyKindSecret, source.Secret.Name)
+			}
+		}
+	}
+}
+
+func (d *dependencyReferences) addArtifactLocation(location *argov1alpha1.ArtifactLocation) {
+	if location == nil {
+		return
+	}
+
+	if location.S3 != nil {
+		d.addSecretKeySelectors(location.S3.AccessKeySecret, location.S3.SecretKeySecret)
+		if location.S3.EncryptionOptions != nil {
+			d.addSecretKeySelectors(location.S3.EncryptionOptions.ServerSideCustomerKeySecret)
+		}
+	}
+	if location.Git != nil {
+		d.addSecretKeySelectors(location.Git.UsernameSecret, location.Git.PasswordSecret, location.Git.SSHPrivateKeySecret)
+	}
+	if location.HTTP != nil && location.HTTP.Auth != nil {
+		auth := location.HTTP.Auth
+		d.addSecretKeySelectors(auth.BasicAuth.UsernameSecret, auth.BasicAuth.PasswordSecret,
+			auth.ClientCert.ClientCertSecret, auth.ClientCert.ClientKeySecret,
+			auth.OAuth2.ClientIDSecret, auth.OAuth2.ClientSecretSecret, auth.OAuth2.TokenURLSecret)
+	}
+	if location.Artifactory != nil {
+		d.addSecretKeySelectors(location.Artifactory.UsernameSecret, location.Artifactory.PasswordSecret)
+	}
+	if location.HDFS != nil {
+		d.addSecretKeySelectors(location.HDFS.KrbCCacheSecret, location.HDFS.KrbKeytabSecret)
+		if location.HDFS.KrbConfigConfigMap != nil {
+			d.add(dependencyKindConfigMap, location.HDFS.KrbConfigConfigMap.Name)
+		}
+	}
+	if location.OSS != nil {
+		d.addSecretKeySelectors(location.OSS.AccessKeySecret, location.OSS.SecretKeySecret)
+	}
+	if location.GCS != nil {
+		d.addSecretKeySelectors(location.GCS.ServiceAccountKeySecret)
+	}
+	if location.Azure != nil {
+		d.addSecretKeySelectors(location.Azure.AccountKeySecret)
+	}
+}
+
+func (d *dependencyReferences) addArguments(arguments argov1alpha1.Arguments) {
+	for _, parameter := range arguments.Parameters {
+		if parameter.ValueFrom != nil && parameter.ValueFrom.ConfigMapKeyRef != nil {
+			d.add(dependencyKindConfigMap, parameter.ValueFrom.ConfigMapKeyRef.Name)
+		}
+	}
+	for i := range arguments.Artifacts {
+		d.addArtifactLocation(&arguments.Artifacts[i].ArtifactLocation)
+	}
+}
+
+func (d *dependencyReferences) addTemplate(template argov1alpha1.Template) {
+	if template.Executor != nil {
+		d.add(dependencyKindServiceAccount, template.Executor.ServiceAccountName)
+	}
+	d.add(dependencyKindServiceAccount, template.ServiceAccountName)
+
+	for _, parameter := range template.Inputs.Parameters {
+		if parameter.ValueFrom != nil && parameter.ValueFrom.ConfigMapKeyRef != nil {
+			d.add(dependencyKindConfigMap, parameter.ValueFrom.ConfigMapKeyRef.Name)
+		}
+	}
+	for i := range template.Inputs.Artifacts {
+		d.addArtifactLocation(&template.Inputs.Artifacts[i].ArtifactLocation)
+	}
+	for i := range template.Outputs.Artifacts {
+		d.addArtifactLocation(&template.Outputs.Artifacts[i].ArtifactLocation)
+	}
+	d.addArtifactLocation(template.ArchiveLocation)
+
+	if template.Container != nil {
+		d.addContainer(*template.Container)
+	}
+	if template.Script != nil {
+		d.addContainer(template.Script.Container)
+	}
+	if template.ContainerSet != nil {
+		for _, container := range template.ContainerSet.Containers {
+			d.addContainer(container.Container)
+		}
+	}
+	for _, container := range template.InitContainers {
+		d.addContainer(container.Container)
+	}
+	for _, container := range template.Sidecars {
+		d.addContainer(container.Container)
+	}
+	d.addVolumes(template.Volumes)
+}
+
+// getDependencyReferences returns the ConfigMaps, Secrets and ServiceAccounts referenced by the Workflow spec,
+// in the order they are found and without duplicates. The default ServiceAccount is never returned.
+func getDependencyReferences(spec argov1alpha1.WorkflowSpec) []dependencyReference {
+	d := &dependencyReferences{}
+
+	d.add(dependencyKindServiceAccount, spec.ServiceAccountName)
+	if spec.Executor != nil {
+		d.add(dependencyKindServiceAccount, spec.Executor.ServiceAccountName)
+	}
+	for _, secret := range spec.ImagePullSecrets {
+		d.add(dependencyKindSecret, secret.Name)
+	}
+	if spec.ArtifactRepositoryRef != nil {
+		d.add(dependencyKindConfigMap, spec.ArtifactRepositoryRef.GetConfigMapOr(defaultArtifactRepositoryConfigMap))
+	}
+	d.addArguments(spec.Arguments)
+	d.addVolumes(spec.Volumes)
+	for _, template := range spec.Templates {
+		d.addTemplate(template)
+	}
+
+	return d.refs
+}
+
+// getArtifactRepositorySecretReferences returns the Secrets referenced by the artifact repositories of the ConfigMap
+func getArtifactRepositorySecretReferences(configMap corev1.ConfigMap) []dependencyReference {
+	d := &dependencyReferences{}
+
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var repository argov1alpha1.ArtifactRepository
+		if err := yaml.Unmarshal([]byte(configMap.Data[key]), &repository); err != nil {
+			continue
+		}
+		d.addArtifactLocation(repository.ToArtifactLocation())
+	}
+
+	return d.refs
+}
+
+// getServiceAccountSecretReferences returns the image pull Secrets of the ServiceAccount
+func getServiceAccountSecretReferences(serviceAccount corev1.ServiceAccount) []dependencyReference {
+	d := &dependencyReferences{}
+	for _, secret := range serviceAccount.ImagePullSecrets {
+		d.add(dependencyKindSecret, secret.Name)
+	}
+	return d.refs
+}
+
+// isDependencySkipped returns true if the Workflow opted out of shipping its dependencies
+func isDependencySkipped(workflow argov1alpha1.Workflow) bool {
+	return strings.EqualFold(workflow.GetAnnotations()[AnnotationKeyOCMSkipDependencies], "true")
+}
+
+// isSecretAllowed returns true if the Secret is labeled to allow its propagation to the managed clusters
+func isSecretAllowed(secret corev1.Secret) bool {
+	return strings.EqualFold(secret.GetLabels()[LabelKeyOCMAllowPropagation], "true")
+}
+
+// prepareConfigMapForWorkPayload resets the type and object meta of the ConfigMap
+// and sets the namespace value to the managed cluster Workflow namespace
+func prepareConfigMapForWorkPayload(configMap corev1.ConfigMap, namespace string) *corev1.ConfigMap {
+	configMap.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: dependencyKindConfigMap}
+	configMap.ObjectMeta = metav1.ObjectMeta{
+		Name:        configMap.Name,
+		Namespace:   namespace,
+		Labels:      configMap.Labels,
+		Annotations: configMap.Annotations,
+	}
+	return &configMap
+}
+
+// prepareSecretForWorkPayload resets the type and object meta of the Secret
+// and sets the namespace value to the managed cluster Workflow namespace
+func prepareSecretForWorkPayload(secret corev1.Secret, namespace string) *corev1.Secret {
+	secret.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: dependencyKindSecret}
+	secret.ObjectMeta = metav1.ObjectMeta{
+		Name:        secret.Name,
+		Namespace:   namespace,
+		Labels:      secret.Labels,
+		Annotations: secret.Annotations,
+	}
+	return &secret
+}
+
+// prepareServiceAccountForWorkPayload resets the type and object meta of the ServiceAccount,
+// sets the namespace value to the managed cluster Workflow namespace
+// and drops the token Secrets which are generated by the managed cluster
+func prepareServiceAccountForWorkPayload(serviceAccount corev1.ServiceAccount, namespace string) *corev1.ServiceAccount {
+	serviceAccount.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: dependencyKindServiceAccount}
+	serviceAccount.ObjectMeta = metav1.ObjectMeta{
+		Name:        serviceAccount.Name,
+		Namespace:   namespace,
+		Labels:      serviceAccount.Labels,
+		Annotations: serviceAccount.Annotations,
+	}
+	serviceAccount.Secrets = nil
+	return &serviceAccount
+}
+
+// shouldCreateNamespace returns true if the Workflow asks for its namespace to be created on the managed cluster
+func shouldCreateNamespace(workflow argov1alpha1.Workflow) bool {
+	return strings.EqualFold(workflow.GetAnnotations()[AnnotationKeyOCMCreateNamespace], "true")
+}
+
+// generateNamespaceManifests creates the managed cluster Workflow namespace along with the Role the Argo executor needs
+// to report the Workflow's progress, and a RoleBinding per ServiceAccount the Workflow runs as. The Workflows of the namespace
+// apply the same Role and RoleBinding of a ServiceAccount, they are deleted with the ManifestWork of the last one.
+func generateNamespaceManifests(workflow argov1alpha1.Workflow) []runtime.Object {
+	namespace := generateWorkflowNamespace(workflow)
+	labels := map[string]string{LabelKeyManagedBy: LabelValueManagedBy}
+
+	serviceAccountNames := []string{}
+	if len(workflow.Spec.ServiceAccountName) == 0 {
+		serviceAccountNames = append(serviceAccountNames, defaultServiceAccountName)
+	}
+	for _, ref := range getDependencyReferences(workflow.Spec) {
+		if ref.Kind == dependencyKindServiceAccount {
+			serviceAccountNames = append(serviceAccountNames, ref.Name)
+		}
+	}
+
+	manifests := []runtime.Object{
+		&corev1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: labels},
+		},
+		&rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Name: executorRoleName, Namespace: namespace, Labels: labels},
+			Rules: []rbacv1.PolicyRule{
+				{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"get", "watch", "patch"},
+				},
+				{
+					APIGroups: []string{""},
+					Resources: []string{"pods/log"},
+					Verbs:     []string{"get", "watch"},
+				},
+				{
+					APIGroups: []string{argov1alpha1.SchemeGroupVersion.Group},
+					Resources: []string{"workflowtaskresults"},
+					Verbs:     []string{"create", "patch"},
+				},
+			},
+		},
+	}
+	for _, serviceAccountName := range serviceAccountNames {
+		manifests = append(manifests, &rbacv1.RoleBinding{
+			TypeMeta: metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      shortenName(executorRoleName+"-"+serviceAccountName, maxObjectNameLength),
+				Namespace: namespace,
+				Labels:    labels,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     executorRoleName,
+			},
+			Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccountName, Namespace: namespace}},
+		})
+	}
+	return manifests
+}
+
+// generateOrphaningRules returns the ManifestWork orphaning rules of the namespace manifests
+func generateOrphaningRules(dependencies []runtime.Object) []workv1.OrphaningRule {
+	rules := []workv1.OrphaningRule{}
+	for _, dependency := range dependencies {
+		switch d := dependency.(type) {
+		case *corev1.Namespace:
+			if d.Labels[LabelKeyManagedBy] == LabelValueManagedBy {
+				rules = append(rules, workv1.OrphaningRule{Resource: "namespaces", Name: d.Name})
+			}
+		}
+	}
+	return rules
+}
+
+// generateManifestWork creates the ManifestWork that wraps the Workflow as payload
+// along with the dependencies the Workflow needs on the managed cluster.
+// With the status sync feedback of Workflow's phase
+func generateManifestWork(name, namespace string, workflow argov1alpha1.Workflow, dependencies ...runtime.Object) *workv1.ManifestWork {
+	manifests := []workv1.Manifest{{RawExtension: runtime.RawExtension{Object: &workflow}}}
+	for _, dependency := range dependencies {
+		manifests = append(manifests, workv1.Manifest{RawExtension: runtime.RawExtension{Object: dependency}})
+	}
+
+	// the namespace might hold other Workflows so it is left on the managed cluster, the Role and RoleBindings are
+	// owned by every ManifestWork that applies them and the work agent only deletes them with the last one
+	var deleteOption *workv1.DeleteOption
+	if orphaningRules := generateOrphaningRules(dependencies); len(orphaningRules) > 0 {
+		deleteOption = &workv1.DeleteOption{
+			PropagationPolicy: workv1.DeletePropagationPolicyTypeSelectivelyOrphan,
+			SelectivelyOrphan: &workv1.SelectivelyOrphan{OrphaningRules: orphaningRules},
+		}
+	}
+
+	return &workv1.ManifestWork{ // TODO use OCM API helper to generate manifest work.
+		TypeMeta: metav1.TypeMeta{},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: workv1.ManifestWorkSpec{
+			Workload: workv1.ManifestsTemplate{
+				Manifests: manifests,
+			},
+			DeleteOption: deleteOption,
+		},
+	}
+}
+
+// statusFeedbackPaths are the Workflow status fields reported as ManifestWork status feedback
+var statusFeedbackPaths = []string{"phase", "message", "startedAt", "finishedAt", "progress"}
+
+// generateStatusFeedbackConfigs asks the OCM work agent to report the basic Workflow status as ManifestWork status feedback,
+// the status of a managed cluster without the status sync addon is read from it
+func generateStatusFeedbackConfigs(wf argov1alpha1.Workflow) []workv1.ManifestConfigOption {
+	jsonPaths := make([]workv1.JsonPath, 0, len(statusFeedbackPaths))
+	for _, name := range statusFeedbackPaths {
+		jsonPaths = append(jsonPaths, workv1.JsonPath{Name: name, Path: ".status." + name})
+	}
+
+	return []workv1.ManifestConfigOption{
+		{
+			ResourceIdentifier: workv1.ResourceIdentifier{
+				Group:     argov1alpha1.SchemeGroupVersion.Group,
+				Resource:  workflow.WorkflowPlural,
+				Namespace: wf.Namespace,
+				Name:      wf.Name,
+			},
+			FeedbackRules: []workv1.FeedbackRule{{Type: workv1.JSONPathsType, JsonPaths: jsonPaths}},
+		},
+	}
+}
+
+// getStatusFeedbackValues returns the status feedback the OCM work agent reported for the ManifestWork Workflow
+func getStatusFeedbackValues(mw workv1.ManifestWork) []workv1.FeedbackValue {
+	for _, manifest := range mw.Status.ResourceStatus.Manifests {
+		if manifest.ResourceMeta.Group == argov1alpha1.SchemeGroupVersion.Group && manifest.ResourceMeta.Resource == workflow.WorkflowPlural {
+			return manifest.StatusFeedbacks.Values
+		}
+	}
+	return nil
+}
+
+// getStatusFeedbackWorkflowStatus returns the Workflow status reported as ManifestWork status feedback,
+// false if the OCM work agent did not report any yet. Invalid times are left out.
+func getStatusFeedbackWorkflowStatus(mw workv1.ManifestWork) (argov1alpha1.WorkflowStatus, bool) {
+	status := argov1alpha1.WorkflowStatus{}
+	values := getStatusFeedbackValues(mw)
+	for _, value := range values {
+		if value.Value.String == nil {
+			continue
+		}
+		v := *value.Value.String
+		switch value.Name {
+		case "phase":
+			status.Phase = argov1alpha1.WorkflowPhase(v)
+		case "message":
+			status.Message = v
+		case "startedAt":
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				status.StartedAt = metav1.NewTime(t)
+			}
+		case "finishedAt":
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				status.FinishedAt = metav1.NewTime(t)
+			}
+		case "progress":
+			status.Progress = argov1alpha1.Progress(v)
+		}
+	}
+	return status, len(values) > 0
+}
+
+// getManifestWorkHubWorkflowReference returns the hub Workflow of the ManifestWork from the annotations of its Workflow manifest
+func getManifestWorkHubWorkflowReference(mw workv1.ManifestWork) (workflowv1alpha2.HubWorkflowReference, bool) {
+	for _, manifest := range mw.Spec.Workload.Manifests {
+		object := metav1.PartialObjectMetadata{}
+		if err := json.Unmarshal(manifest.Raw, &object); err != nil {
+			continue
+		}
+		if object.Kind != argov1alpha1.WorkflowSchemaGroupVersionKind.Kind || object.GroupVersionKind().Group != argov1alpha1.SchemeGroupVersion.Group {
+			continue
+		}
+
+		annos := object.GetAnnotations()
+		ref := workflowv1alpha2.HubWorkflowReference{
+			Namespace: annos[AnnotationKeyHubWorkflowNamespace],
+			Name:      annos[AnnotationKeyHubWorkflowName],
+			UID:       types.UID(annos[AnnotationKeyHubWorkflowUID]),
+		}
+		return ref, len(ref.Namespace) > 0 && len(ref.Name) > 0
+	}
+	return workflowv1alpha2.HubWorkflowReference{}, false
+}
+
+// getMaxClusterAttempts returns how many managed clusters the Workflow can be attempted on, defaults to 1
+func getMaxClusterAttempts(workflow argov1alpha1.Workflow) int {
+	maxAttempts, err := strconv.Atoi(workflow.GetAnnotations()[AnnotationKeyOCMMaxClusterAttempts])
+	if err != nil || maxAttempts < 1 {
+		return 1
+	}
+	return maxAttempts
+}
+
+// getClusterAttempts returns the Workflow's previous managed cluster attempts, an invalid history is ignored
+func getClusterAttempts(workflow argov1alpha1.Workflow) []ClusterAttempt {
+	attempts := []ClusterAttempt{}
+	if value := workflow.GetAnnotations()[AnnotationKeyOCMClusterAttempts]; len(value) > 0 {
+		if err := json.Unmarshal([]byte(value), &attempts); err != nil {
+			return []ClusterAttempt{}
+		}
+	}
+	return attempts
+}
+
+// recordClusterAttempt appends the managed cluster attempt to the Workflow's attempt history
+func recordClusterAttempt(workflow *argov1alpha1.Workflow, managedClusterName string, status argov1alpha1.WorkflowStatus) error {
+	attempt := ClusterAttempt{
+		Cluster:    managedClusterName,
+		Phase:      status.Phase,
+		Message:    status.Message,
+		StartedAt:  status.StartedAt,
+		FinishedAt: status.FinishedAt,
+	}
+	if attempt.FinishedAt.IsZero() {
+		attempt.FinishedAt = metav1.Now()
+	}
+
+	attemptsJSON, err := json.Marshal(append(getClusterAttempts(*workflow), attempt))
+	if err != nil {
+		return err
+	}
+
+	if workflow.Annotations == nil {
+		workflow.Annotations = map[string]string{}
+	}
+	workflow.Annotations[AnnotationKeyOCMClusterAttempts] = string(attemptsJSON)
+
+	return nil
+}
+
+// getRetryCandidates returns the decided managed clusters a failed Workflow can be retried on,
+// neither excluded nor the managed cluster it failed on
+func getRetryCandidates(workflow argov1alpha1.Workflow, decidedClusterNames []string, managedClusterName string) []string {
+	return excludeNames(excludeClusterNames(workflow, decidedClusterNames), []string{managedClusterName})
+}
+
+// shouldRetryOnAnotherCluster returns true if the Workflow failed on its managed cluster
+// and it has a Placement and attempts left to run on another managed cluster. Fan-out Workflows are not retried.
+func shouldRetryOnAnotherCluster(workflow argov1alpha1.Workflow, status argov1alpha1.WorkflowStatus) bool {
+	if isFanOutWorkflow(workflow) {
+		return false
+	}
+
+	if status.Phase != argov1alpha1.WorkflowFailed && status.Phase != argov1alpha1.WorkflowError {
+		return false
+	}
+
+	if len(workflow.GetAnnotations()[AnnotationKeyOCMLastPlacement]) == 0 {
+		return false
+	}
+
+	return len(getClusterAttempts(workflow))+1 < getMaxClusterAttempts(workflow)
+}
+
+// getMostRecentScheduleTime returns the most recent schedule time between the last schedule time and now,
+// nil if the schedule was not due, along with the next schedule time after now. With a starting deadline,
+// the schedules older than the deadline can not start anymore so they are not looked at.
+// Past the maximum number of missed schedules it reports too many missed schedules and skips ahead
+// to the most recent schedule time, same as the Kubernetes CronJob controller.
+func getMostRecentScheduleTime(schedule cron.Schedule, lastScheduleTime, now time.Time,
+	startingDeadlineSeconds *int64) (*time.Time, time.Time, bool) {
+	earliest := lastScheduleTime
+	if startingDeadlineSeconds != nil {
+		if deadline := now.Add(-time.Duration(*startingDeadlineSeconds) * time.Second); deadline.After(earliest) {
+			earliest = deadline
+		}
+	}
+
+	var mostRecent *time.Time
+	missed := 0
+	// a zero time is a schedule that never occurs again
+	for t := schedule.Next(earliest); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		if missed == maxMissedSchedules {
+			return skipToMostRecentScheduleTime(schedule, t, now), schedule.Next(now), true
+		}
+		scheduleTime := t
+		mostRecent = &scheduleTime
+		missed++
+	}
+
+	if mostRecent == nil {
+		return nil, schedule.Next(earliest), false
+	}
+	return mostRecent, schedule.Next(now), false
+}
+
+// skipToMostRecentScheduleTime returns the most recent schedule time between the given schedule time and now.
+// It searches back from now over a window that doubles until it holds a schedule time,
+// so the schedules in between are not all looked at.
+func skipToMostRecentScheduleTime(schedule cron.Schedule, scheduleTime, now time.Time) *time.Time {
+	window := schedule.Next(scheduleTime).Sub(scheduleTime)
+	start := now.Add(-window)
+	for window > 0 && start.After(scheduleTime) && schedule.Next(start).After(now) {
+		window *= 2
+		start = now.Add(-window)
+	}
+	if window <= 0 || start.Before(scheduleTime) {
+		start = scheduleTime
+	}
+
+	mostRecent := scheduleTime
+	for t := schedule.Next(start); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		mostRecent = t
+	}
+	return &mostRecent
+}
+
+// generateCronWorkflowRun creates the hub Workflow for a CronWorkflow schedule tick.
+// The Workflow keeps the OCM label and annotations of the CronWorkflow so it goes through the placement
+// and ManifestWork propagation like any other multicluster Workflow.
+func generateCronWorkflowRun(cronWorkflow argov1alpha1.CronWorkflow, scheduledTime time.Time) *argov1alpha1.Workflow {
+	labels := map[string]string{}
+	annotations := map[string]string{}
+	if cronWorkflow.Spec.WorkflowMetadata != nil {
+		for k, v := range cronWorkflow.Spec.WorkflowMetadata.Labels {
+			labels[k] = v
+		}
+		for k, v := range cronWorkflow.Spec.WorkflowMetadata.Annotations {
+			annotations[k] = v
+		}
+	}
+
+	for k, v := range cronWorkflow.Annotations {
+		if strings.HasPrefix(k, AnnotationKeyPrefixOCM) {
+			annotations[k] = v
+		}
+	}
+
+	labels[LabelKeyEnableOCMMulticluster] = "true"
+	labels[LabelKeyCronWorkflow] = cronWorkflow.Name
+	if instanceID := cronWorkflow.Labels[LabelKeyControllerInstanceID]; len(instanceID) > 0 {
+		labels[LabelKeyControllerInstanceID] = instanceID
+	}
+	annotations[AnnotationKeyCronWorkflowScheduledTime] = scheduledTime.Format(time.RFC3339)
+
+	return &argov1alpha1.Workflow{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: argov1alpha1.SchemeGroupVersion.String(),
+			Kind:       argov1alpha1.WorkflowSchemaGroupVersionKind.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cronWorkflow.Name + "-" + strconv.FormatInt(scheduledTime.Unix(), 10),
+			Namespace:   cronWorkflow.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(&cronWorkflow, argov1alpha1.SchemeGroupVersion.WithKind(workflow.CronWorkflowKind)),
+			},
+		},
+		Spec: *cronWorkflow.Spec.WorkflowSpec.DeepCopy(),
+	}
+}
+
+// getWorkflowObjectReference returns the object reference of the Workflow, used for the CronWorkflow active list
+func getWorkflowObjectReference(workflow argov1alpha1.Workflow) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		APIVersion: argov1alpha1.SchemeGroupVersion.String(),
+		Kind:       argov1alpha1.WorkflowSchemaGroupVersionKind.Kind,
+		Namespace:  workflow.Namespace,
+		Name:       workflow.Name,
+		UID:        workflow.UID,
+	}
+}
+
+// aggregateFanOutStatus combines the Workflow status of every fan-out managed cluster into a single status.
+// The combined phase is:
+// - Succeeded when all the clusters succeeded
+// - Failed or Error when all the clusters completed and at least one did not succeed
+// - Running when at least one cluster started
+// - Pending otherwise
+func aggregateFanOutStatus(clusterStatuses map[string]argov1alpha1.WorkflowStatus) argov1alpha1.WorkflowStatus {
+	status := argov1alpha1.WorkflowStatus{}
+
+	clusterNames := make([]string, 0, len(clusterStatuses))
+	for clusterName := range clusterStatuses {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	sort.Strings(clusterNames)
+
+	completed, succeeded, failed, errored, started := 0, 0, 0, 0, 0
+	messages := []string{}
+	progress := argov1alpha1.Progress("0/0")
+	for _, clusterName := range clusterNames {
+		clusterStatus := clusterStatuses[clusterName]
+		phase := clusterStatus.Phase
+		if len(phase) == 0 {
+			phase = argov1alpha1.WorkflowPending
+		}
+		messages = append(messages, clusterName+": "+string(phase))
+
+		switch phase {
+		case argov1alpha1.WorkflowSucceeded:
+			succeeded++
+		case argov1alpha1.WorkflowFailed:
+			failed++
+		case argov1alpha1.WorkflowError:
+			errored++
+		}
+		if phase.Completed() {
+			completed++
+		}
+		if phase != argov1alpha1.WorkflowPending {
+			started++
+		}
+
+		if !clusterStatus.StartedAt.IsZero() && (status.StartedAt.IsZero() || clusterStatus.StartedAt.Before(&status.StartedAt)) {
+			status.StartedAt = clusterStatus.StartedAt
+		}
+		if status.FinishedAt.Before(&clusterStatus.FinishedAt) {
+			status.FinishedAt = clusterStatus.FinishedAt
+		}
+		if clusterStatus.Progress.IsValid() {
+			progress = progress.Add(clusterStatus.Progress)
+		}
+		status.ResourcesDuration = status.ResourcesDuration.Add(clusterStatus.ResourcesDuration)
+	}
+
+	switch {
+	case len(clusterNames) > 0 && succeeded == len(clusterNames):
+		status.Phase = argov1alpha1.WorkflowSucceeded
+	case len(clusterNames) > 0 && completed == len(clusterNames) && failed > 0:
+		status.Phase = argov1alpha1.WorkflowFailed
+	case len(clusterNames) > 0 && completed == len(clusterNames) && errored > 0:
+		status.Phase = argov1alpha1.WorkflowError
+	case started > 0:
+		status.Phase = argov1alpha1.WorkflowRunning
+	default:
+		status.Phase = argov1alpha1.WorkflowPending
+	}
+
+	if !status.Phase.Completed() {
+		status.FinishedAt = metav1.Time{}
+	}
+	if progress.M() > 0 {
+		status.Progress = progress
+	}
+	status.Message = strconv.Itoa(succeeded) + "/" + strconv.Itoa(len(clusterNames)) + " clusters succeeded; " + strings.Join(messages, ", ")
+
+	return status
+}
+
+// populateFanOutFeedbackStatus records the status feedback of the managed cluster in the per managed cluster results
+// of the fan-out Workflow, then sets the Workflow status to the aggregated status of every fan-out managed cluster
+func populateFanOutFeedbackStatus(workflow *argov1alpha1.Workflow, managedClusterName string, clusterStatus argov1alpha1.WorkflowStatus) error {
+	summaries := getManagedClusterStatuses(*workflow)
+	summary := summaries[managedClusterName]
+	summary.Phase = clusterStatus.Phase
+	summary.Message = clusterStatus.Message
+	summary.StartedAt = clusterStatus.StartedAt
+	summary.FinishedAt = clusterStatus.FinishedAt
+	summary.Progress = clusterStatus.Progress
+	summaries[managedClusterName] = summary
+
+	clusterStatuses := map[string]argov1alpha1.WorkflowStatus{}
+	for _, name := range getManagedClusterNames(*workflow) {
+		summary := summaries[name]
+		clusterStatuses[name] = argov1alpha1.WorkflowStatus{
+			Phase:      summary.Phase,
+			Message:    summary.Message,
+			StartedAt:  summary.StartedAt,
+			FinishedAt: summary.FinishedAt,
+			Progress:   summary.Progress,
+		}
+	}
+
+	summariesJSON, err := json.Marshal(summaries)
+	if err != nil {
+		return err
+	}
+
+	if workflow.Annotations == nil {
+		workflow.Annotations = map[string]string{}
+	}
+	workflow.Annotations[AnnotationKeyOCMManagedClusterStatuses] = string(summariesJSON)
+	workflow.Status = aggregateFanOutStatus(clusterStatuses)
+	return nil
+}
+
+// getAcceptedStatusResults returns the last WorkflowStatusResult accepted into the hub Workflow by managed cluster
+func getAcceptedStatusResults(workflow argov1alpha1.Workflow) map[string]AcceptedStatusResult {
+	accepted := map[string]AcceptedStatusResult{}
+	if value := workflow.GetAnnotations()[AnnotationKeyOCMAcceptedResults]; len(value) > 0 {
+		if err := json.Unmarshal([]byte(value), &accepted); err != nil {
+			return map[string]AcceptedStatusResult{}
+		}
+	}
+	return accepted
+}
+
+// isStaleWorkflowStatusResult returns true if the result is older than the last result of its managed cluster accepted
+// into the hub Workflow, either by its sync sequence or by the generation of the same managed cluster Workflow
+func isStaleWorkflowStatusResult(workflow argov1alpha1.Workflow, result workflowv1alpha2.WorkflowStatusResult) (AcceptedStatusResult, bool) {
+	accepted, ok := getAcceptedStatusResults(workflow)[result.Namespace]
+	if !ok {
+		return accepted, false
+	}
+	if result.Spec.Sequence < accepted.Sequence {
+		return accepted, true
+	}
+
+	return accepted, len(accepted.WorkflowUID) > 0 && result.Spec.WorkflowUID == accepted.WorkflowUID &&
+		result.Spec.ObservedGeneration < accepted.Generation
+}
+
+// recordAcceptedStatusResult records the result on the hub Workflow as the last one accepted from its managed cluster
+func recordAcceptedStatusResult(workflow *argov1alpha1.Workflow, result workflowv1alpha2.WorkflowStatusResult) {
+	accepted := getAcceptedStatusResults(*workflow)
+	accepted[result.Namespace] = AcceptedStatusResult{
+		Sequence:    result.Spec.Sequence,
+		Generation:  result.Spec.ObservedGeneration,
+		WorkflowUID: result.Spec.WorkflowUID,
+	}
+	setAcceptedStatusResults(workflow, accepted)
+}
+
+// isStaleStatusFeedback returns true if the status feedback of the ManifestWork is superseded, either by a WorkflowStatusResult
+// accepted from the same managed cluster, which holds the full status, or by the feedback of a later ManifestWork generation
+func isStaleStatusFeedback(workflow argov1alpha1.Workflow, mw workv1.ManifestWork) bool {
+	accepted, ok := getAcceptedStatusResults(workflow)[mw.Namespace]
+	return ok && (accepted.Sequence > 0 || accepted.WorkGeneration > mw.Generation)
+}
+
+// recordAcceptedStatusFeedback records the status feedback of the ManifestWork on the hub Workflow
+// as the last status accepted from its managed cluster
+func recordAcceptedStatusFeedback(workflow *argov1alpha1.Workflow, mw workv1.ManifestWork) {
+	accepted := getAcceptedStatusResults(*workflow)
+	accepted[mw.Namespace] = AcceptedStatusResult{WorkGeneration: mw.Generation}
+	setAcceptedStatusResults(workflow, accepted)
+}
+
+// setAcceptedStatusResults sets the accepted results annotation of the hub Workflow, it is removed when empty
+func setAcceptedStatusResults(workflow *argov1alpha1.Workflow, accepted map[string]AcceptedStatusResult) {
+	annos := workflow.GetAnnotations()
+	if annos == nil {
+		annos = map[string]string{}
+	}
+	delete(annos, AnnotationKeyOCMAcceptedResults)
+	// a map of plain fields always marshals
+	if acceptedJSON, err := json.Marshal(accepted); err == nil && len(accepted) > 0 {
+		annos[AnnotationKeyOCMAcceptedResults] = string(acceptedJSON)
+	}
+	workflow.SetAnnotations(annos)
+}
+
+// isWorkflowStatusResultOwner returns true if the result belongs to the given hub Workflow,
+// a result without a hub Workflow UID is matched by name only
+func isWorkflowStatusResultOwner(workflow argov1alpha1.Workflow, result workflowv1alpha2.WorkflowStatusResult) bool {
+	ref := result.Spec.HubWorkflowRef
+	if workflow.Namespace != ref.Namespace || workflow.Name != ref.Name {
+		return false
+	}
+
+	return len(ref.UID) == 0 || workflow.UID == ref.UID
+}
+
+// acceptWorkflowStatusResult records the result as the last one copied to the hub Workflow status
+func acceptWorkflowStatusResult(result *workflowv1alpha2.WorkflowStatusResult) {
+	result.Status.AcceptedSequence = result.Spec.Sequence
+	result.Status.AcceptedGeneration = result.Spec.ObservedGeneration
+	result.Status.AcceptedWorkflowUID = result.Spec.WorkflowUID
+	setWorkflowStatusResultCondition(result, metav1.ConditionTrue, workflowv1alpha2.ReasonSynced,
+		"the managed cluster Workflow status is copied to the hub Workflow")
+}
+
+// setWorkflowStatusResultCondition sets the Accepted condition of the result
+func setWorkflowStatusResultCondition(result *workflowv1alpha2.WorkflowStatusResult, status metav1.ConditionStatus,
+	reason, message string) {
+	meta.SetStatusCondition(&result.Status.Conditions, metav1.Condition{
+		Type:               workflowv1alpha2.ConditionTypeAccepted,
+		Status:             status,
+		ObservedGeneration: result.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// isRemoteDeletedCluster returns true if the Workflow was deleted on the given managed cluster
+func isRemoteDeletedCluster(workflow argov1alpha1.Workflow, managedClusterName string) bool {
+	return containsString(splitNames(workflow.GetAnnotations()[AnnotationKeyOCMRemoteDeletedClusters]), managedClusterName)
+}
+
+// recordRemoteDeletedCluster adds the managed cluster to the Workflow's remote deleted clusters annotation
+func recordRemoteDeletedCluster(workflow *argov1alpha1.Workflow, managedClusterName string) {
+	if isRemoteDeletedCluster(*workflow, managedClusterName) {
+		return
+	}
+
+	if workflow.Annotations == nil {
+		workflow.Annotations = map[string]string{}
+	}
+	workflow.Annotations[AnnotationKeyOCMRemoteDeletedClusters] = strings.Join(
+		append(splitNames(workflow.Annotations[AnnotationKeyOCMRemoteDeletedClusters]), managedClusterName), ",")
+}
+
+// isLostCluster returns true if the fan-out Workflow failed on the managed cluster because the managed cluster was lost
+func isLostCluster(workflow argov1alpha1.Workflow, managedClusterName string) bool {
+	return containsString(splitNames(workflow.GetAnnotations()[AnnotationKeyOCMLostClusters]), managedClusterName)
+}
+
+// recordLostCluster adds the managed cluster to the fan-out Workflow's lost clusters annotation
+// and records the managed cluster result as failed with the given message
+func recordLostCluster(workflow *argov1alpha1.Workflow, managedClusterName, message string) error {
+	if isLostCluster(*workflow, managedClusterName) {
+		return nil
+	}
+
+	if workflow.Annotations == nil {
+		workflow.Annotations = map[string]string{}
+	}
+	workflow.Annotations[AnnotationKeyOCMLostClusters] = strings.Join(
+		append(splitNames(workflow.Annotations[AnnotationKeyOCMLostClusters]), managedClusterName), ",")
+
+	summaries := getManagedClusterStatuses(*workflow)
+	summary := summaries[managedClusterName]
+	summary.Phase = argov1alpha1.WorkflowFailed
+	summary.Message = message
+	summary.FinishedAt = metav1.Now()
+	summaries[managedClusterName] = summary
+	return setManagedClusterStatuses(workflow, summaries)
+}
+
+// aggregateManagedClusterStatuses sets the fan-out Workflow status to the aggregated status of its recorded
+// per managed cluster results, the results of the managed clusters it no longer runs on are dropped
+func aggregateManagedClusterStatuses(workflow *argov1alpha1.Workflow) error {
+	previousSummaries := getManagedClusterStatuses(*workflow)
+	summaries := map[string]ManagedClusterWorkflowStatus{}
+	clusterStatuses := map[string]argov1alpha1.WorkflowStatus{}
+	for _, managedClusterName := range getManagedClusterNames(*workflow) {
+		summaries[managedClusterName] = previousSummaries[managedClusterName]
+		clusterStatuses[managedClusterName] = getSummaryWorkflowStatus(previousSummaries[managedClusterName])
+	}
+	if err := setManagedClusterStatuses(workflow, summaries); err != nil {
+		return err
+	}
+	workflow.Status = aggregateFanOutStatus(clusterStatuses)
+	return nil
+}
+
+// getSummaryWorkflowStatus returns the managed cluster Workflow status kept by its summary
+func getSummaryWorkflowStatus(summary ManagedClusterWorkflowStatus) argov1alpha1.WorkflowStatus {
+	return argov1alpha1.WorkflowStatus{
+		Phase:      summary.Phase,
+		Message:    summary.Message,
+		StartedAt:  summary.StartedAt,
+		FinishedAt: summary.FinishedAt,
+		Progress:   summary.Progress,
+	}
+}
+
+// setManagedClusterStatuses records the per managed cluster results of a fan-out Workflow. When they are larger than
+// MaxManagedClusterStatusesSize, the largest outputs are left out until they fit, then the messages.
+func setManagedClusterStatuses(workflow *argov1alpha1.Workflow, summaries map[string]ManagedClusterWorkflowStatus) error {
+	summariesJSON, err := json.Marshal(summaries)
+	if err != nil {
+		return err
+	}
+
+	if len(summariesJSON) > MaxManagedClusterStatusesSize {
+		clusterNames := make([]string, 0, len(summaries))
+		sizes := map[string]int{}
+		for clusterName, summary := range summaries {
+			clusterNames = append(clusterNames, clusterName)
+			summaryJSON, err := json.Marshal(summary)
+			if err != nil {
+				return err
+			}
+			sizes[clusterName] = len(summaryJSON)
+		}
+		sort.Slice(clusterNames, func(i, j int) bool {
+			if sizes[clusterNames[i]] != sizes[clusterNames[j]] {
+				return sizes[clusterNames[i]] > sizes[clusterNames[j]]
+			}
+			return clusterNames[i] < clusterNames[j]
+		})
+
+		trims := []func(*ManagedClusterWorkflowStatus){
+			func(summary *ManagedClusterWorkflowStatus) { summary.Outputs = nil },
+			func(summary *ManagedClusterWorkflowStatus) { summary.Message = "" },
+		}
+		trimmed := map[string]ManagedClusterWorkflowStatus{}
+		for clusterName, summary := range summaries {
+			trimmed[clusterName] = summary
+		}
+		for _, trim := range trims {
+			for _, clusterName := range clusterNames {
+				if len(summariesJSON) <= MaxManagedClusterStatusesSize {
+					break
+				}
+				summary := trimmed[clusterName]
+				trim(&summary)
+				trimmed[clusterName] = summary
+				if summariesJSON, err = json.Marshal(trimmed); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if workflow.Annotations == nil {
+		workflow.Annotations = map[string]string{}
+	}
+	workflow.Annotations[AnnotationKeyOCMManagedClusterStatuses] = string(summariesJSON)
+	return nil
+}
+
+// getManagedClusterStatuses returns the per managed cluster results of a fan-out Workflow, an invalid annotation is ignored
+func getManagedClusterStatuses(workflow argov1alpha1.Workflow) map[string]ManagedClusterWorkflowStatus {
+	summaries := map[string]ManagedClusterWorkflowStatus{}
+	if value := workflow.GetAnnotations()[AnnotationKeyOCMManagedClusterStatuses]; len(value) > 0 {
+		if err := json.Unmarshal([]byte(value), &summaries); err != nil {
+			return map[string]ManagedClusterWorkflowStatus{}
+		}
+	}
+	return summaries
+}
+
+// SummarizeWorkflowOutputs returns the global outputs and the entrypoint outputs of the Workflow status, nil if there are none.
+// The entrypoint is the root node, named after the Workflow.
+func SummarizeWorkflowOutputs(workflowName string, status argov1alpha1.WorkflowStatus) *workflowv1alpha2.WorkflowOutputsSummary {
+	summary := workflowv1alpha2.WorkflowOutputsSummary{}
+	if status.Outputs != nil {
+		summary.Parameters = getParameterValues(status.Outputs.Parameters)
+	}
+
+	nodes := status.Nodes
+	if len(nodes) == 0 && len(status.CompressedNodes) > 0 {
+		// the global outputs are still summarized when the nodes can not be decoded
+		nodes, _ = DecompressNodes(status.CompressedNodes)
+	}
+	if root, ok := nodes[workflowName]; ok && root.Outputs != nil {
+		summary.EntrypointParameters = getParameterValues(root.Outputs.Parameters)
+		if root.Outputs.ExitCode != nil {
+			summary.ExitCode = *root.Outputs.ExitCode
+		}
+	}
+
+	if len(summary.Parameters) == 0 && len(summary.EntrypointParameters) == 0 && len(summary.ExitCode) == 0 {
+		return nil
+	}
+	return &summary
+}
+
+// getParameterValues returns the parameter values by name, the parameters without a value are left out
+func getParameterValues(parameters []argov1alpha1.Parameter) map[string]string {
+	values := map[string]string{}
+	for _, parameter := range parameters {
+		if parameter.Value != nil {
+			values[parameter.Name] = parameter.Value.String()
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// getWorkflowOutputsSummary returns the outputs summary synced by the status sync agent,
+// the summary of an agent that does not sync one is read from the synced status.
+// A summary larger than MaxOutputsSummarySize is left out, nil is returned.
+func getWorkflowOutputsSummary(workflowStatusResult workflowv1alpha2.WorkflowStatusResult) *workflowv1alpha2.WorkflowOutputsSummary {
+	summary := workflowStatusResult.Spec.Outputs
+	if summary == nil {
+		summary = SummarizeWorkflowOutputs(workflowStatusResult.Spec.HubWorkflowRef.Name, workflowStatusResult.WorkflowStatus)
+	}
+	if summary == nil {
+		return nil
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil || len(summaryJSON) > MaxOutputsSummarySize {
+		return nil
+	}
+	return summary
+}
+
+// setWorkflowOutputsSummary records the outputs summary in the Workflow annotation, the annotation is removed without outputs
+func setWorkflowOutputsSummary(workflow *argov1alpha1.Workflow, summary *workflowv1alpha2.WorkflowOutputsSummary) error {
+	annos := workflow.GetAnnotations()
+	if summary == nil {
+		delete(annos, AnnotationKeyOCMOutputs)
+		return nil
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	if annos == nil {
+		annos = map[string]string{}
+	}
+	annos[AnnotationKeyOCMOutputs] = string(summaryJSON)
+	workflow.SetAnnotations(annos)
+	return nil
+}
+
+// CompressNodes gzips and base64 encodes the Workflow nodes, same as the Argo compressedNodes
+func CompressNodes(nodes argov1alpha1.Nodes) (string, error) {
+	nodesJSON, err := json.Marshal(nodes)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(nodesJSON); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecompressNodes decodes the Workflow nodes compressed by CompressNodes or by the Argo controller
+func DecompressNodes(compressedNodes string) (argov1alpha1.Nodes, error) {
+	data, err := base64.StdEncoding.DecodeString(compressedNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	nodesJSON, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := argov1alpha1.Nodes{}
+	if err := json.Unmarshal(nodesJSON, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// CompressNodeStatusIfNeeded moves the nodes to the compressed nodes when they are larger than MaxNodeStatusSize,
+// returns true if the nodes were compressed
+func CompressNodeStatusIfNeeded(status *argov1alpha1.WorkflowStatus) (bool, error) {
+	if len(status.Nodes) == 0 {
+		return false, nil
+	}
+
+	nodesJSON, err := json.Marshal(status.Nodes)
+	if err != nil {
+		return false, err
+	}
+	if len(nodesJSON) <= MaxNodeStatusSize {
+		return false, nil
+	}
+
+	compressedNodes, err := CompressNodes(status.Nodes)
+	if err != nil {
+		return false, err
+	}
+	status.CompressedNodes = compressedNodes
+	status.Nodes = nil
+	return true, nil
+}
+
+// GenerateWorkflowStatusResultChunkName returns the name of the WorkflowStatusResultChunk at the given index
+func GenerateWorkflowStatusResultChunkName(resultName string, index int32) string {
+	return fmt.Sprintf("%s-%d", resultName, index)
+}
+
+// setNodeStatusOffloadedCondition clears the node status of the hub Workflow and points to the WorkflowStatusResultChunks
+// of the result that hold it
+func setNodeStatusOffloadedCondition(workflow *argov1alpha1.Workflow, result workflowv1alpha2.WorkflowStatusResult) {
+	workflow.Status.Nodes = nil
+	workflow.Status.CompressedNodes = ""
+	workflow.Status.Conditions.UpsertCondition(argov1alpha1.Condition{
+		Type:   ConditionTypeNodeStatusOffloaded,
+		Status: metav1.ConditionTrue,
+		Message: fmt.Sprintf("the node status is too large for the hub Workflow, it is kept compressed in the WorkflowStatusResultChunks "+
+			"%s/%s to %s of sequence %d", result.Namespace, GenerateWorkflowStatusResultChunkName(result.Name, 0),
+			GenerateWorkflowStatusResultChunkName(result.Name, result.Spec.NodeStatusChunks-1), result.Spec.Sequence),
+	})
+}
+
+// decompressNodeStatusIfFits moves the compressed nodes back to the nodes unless they are larger than MaxNodeStatusSize,
+// the hub Workflow keeps them compressed otherwise
+func decompressNodeStatusIfFits(status *argov1alpha1.WorkflowStatus) error {
+	if len(status.CompressedNodes) == 0 || len(status.Nodes) > 0 {
+		return nil
+	}
+
+	nodes, err := DecompressNodes(status.CompressedNodes)
+	if err != nil {
+		return err
+	}
+
+	nodesJSON, err := json.Marshal(nodes)
+	if err != nil {
+		return err
+	}
+	if len(nodesJSON) > MaxNodeStatusSize {
+		return nil
+	}
+
+	status.Nodes = nodes
+	status.CompressedNodes = ""
+	return nil
+}
+
+// isEmptyPatch returns true if the patch has no changes for the object
+func isEmptyPatch(patch client.Patch, obj client.Object) (bool, error) {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return false, err
+	}
+	return string(data) == "{}", nil
+}
+
+// isWorkflowStatusResultEvent returns true if the Event was emitted by the status sync agent for a managed cluster Workflow
+func isWorkflowStatusResultEvent(ev corev1.Event) bool {
+	return ev.InvolvedObject.Kind == KindWorkflowStatusResult &&
+		strings.HasPrefix(ev.InvolvedObject.APIVersion, workflowv1alpha2.GroupVersion.Group+"/")
+}
+
+// GetEventCount returns how many times the Event occurred, an Event without a count occurred once
+func GetEventCount(ev corev1.Event) int32 {
+	if ev.Series != nil && ev.Series.Count > ev.Count {
+		return ev.Series.Count
+	}
+	if ev.Count < 1 {
+		return 1
+	}
+	return ev.Count
+}
+
+// shouldReemitEvent returns true if the Event occurred again since it was last re-emitted against the hub Workflow
+func shouldReemitEvent(ev corev1.Event) bool {
+	reemitted, err := strconv.Atoi(ev.GetAnnotations()[AnnotationKeyOCMReemittedCount])
+	return err != nil || GetEventCount(ev) > int32(reemitted)
+}
+
+// isQueuedWorkflow returns true if the Workflow refers to a WorkflowQueue that did not admit it yet
+func isQueuedWorkflow(workflow argov1alpha1.Workflow) bool {
+	annos := workflow.GetAnnotations()
+	return len(annos[AnnotationKeyOCMQueue]) > 0 && len(annos[AnnotationKeyOCMQueueAdmitted]) == 0
+}
+
+// hasQueueStateChanged returns true if the change of the Workflow can change the usage of its WorkflowQueue
+func hasQueueStateChanged(oldWorkflow, newWorkflow argov1alpha1.Workflow) bool {
+	oldAnnos, newAnnos := oldWorkflow.GetAnnotations(), newWorkflow.GetAnnotations()
+	for _, key := range []string{AnnotationKeyOCMQueue, AnnotationKeyOCMQueueAdmitted, AnnotationKeyOCMPriorityClass} {
+		if oldAnnos[key] != newAnnos[key] {
+			return true
+		}
+	}
+	return !reflect.DeepEqual(getManagedClusterNames(oldWorkflow), getManagedClusterNames(newWorkflow)) ||
+		oldWorkflow.Status.Fulfilled() != newWorkflow.Status.Fulfilled() ||
+		(oldWorkflow.DeletionTimestamp == nil) != (newWorkflow.DeletionTimestamp == nil)
+}
+
+// classifyQueueWorkflows splits the Workflows of a WorkflowQueue into the admitted ones that did not complete yet
+// and the placed ones waiting for admission, the Workflows that are not placed yet take no part in the queue
+func classifyQueueWorkflows(workflows []argov1alpha1.Workflow) ([]argov1alpha1.Workflow, []argov1alpha1.Workflow) {
+	running, queued := []argov1alpha1.Workflow{}, []argov1alpha1.Workflow{}
+	for _, workflow := range workflows {
+		if workflow.DeletionTimestamp != nil || workflow.Status.Fulfilled() || len(getManagedClusterNames(workflow)) == 0 {
+			continue
+		}
+		if isQueuedWorkflow(workflow) {
+			queued = append(queued, workflow)
+		} else {
+			running = append(running, workflow)
+		}
+	}
+	return running, queued
+}
+
+// getNamespaceQueueName returns the name of the WorkflowQueue the namespace is bound to, the first one by name
+// when several queues list the namespace, empty if none
+func getNamespaceQueueName(queues []workflowv1alpha2.WorkflowQueue, namespace string) string {
+	name := ""
+	for _, queue := range queues {
+		if containsString(queue.Spec.Namespaces, namespace) && (len(name) == 0 || queue.Name < name) {
+			name = queue.Name
+		}
+	}
+	return name
+}
+
+// isPriorityClassAllowed returns true if the priority class exists in the WorkflowQueue and the namespace can use it
+func isPriorityClassAllowed(spec workflowv1alpha2.WorkflowQueueSpec, name, namespace string) bool {
+	for _, priorityClass := range spec.PriorityClasses {
+		if priorityClass.Name == name {
+			return len(priorityClass.Namespaces) == 0 || containsString(priorityClass.Namespaces, namespace)
+		}
+	}
+	return false
+}
+
+// getQueuePriority returns the value of the Workflow priority class in the WorkflowQueue, the default priority class
+// is used when the Workflow has none or can not use it, the priority is zero without a usable priority class
+func getQueuePriority(spec workflowv1alpha2.WorkflowQueueSpec, workflow argov1alpha1.Workflow) int32 {
+	name := workflow.GetAnnotations()[AnnotationKeyOCMPriorityClass]
+	if !isPriorityClassAllowed(spec, name, workflow.Namespace) {
+		name = spec.DefaultPriorityClass
+	}
+	if !isPriorityClassAllowed(spec, name, workflow.Namespace) {
+		return 0
+	}
+	for _, priorityClass := range spec.PriorityClasses {
+		if priorityClass.Name == name {
+			return priorityClass.Value
+		}
+	}
+	return 0
+}
+
+// selectAdmittedWorkflows returns the queued Workflows that fit the WorkflowQueue limits along with the running ones,
+// in admission order. A Workflow that does not fit, e.g. because its managed cluster is full, does not hold back
+// the Workflows queued behind it.
+func selectAdmittedWorkflows(spec workflowv1alpha2.WorkflowQueueSpec, running, queued []argov1alpha1.Workflow) []argov1alpha1.Workflow {
+	total := len(running)
+	perCluster, perNamespace := map[string]int{}, map[string]int{}
+	for _, workflow := range running {
+		perNamespace[workflow.Namespace]++
+		for _, name := range getManagedClusterNames(workflow) {
+			perCluster[name]++
+		}
+	}
+
+	candidates := append([]argov1alpha1.Workflow{}, queued...)
+	admitted := []argov1alpha1.Workflow{}
+	for len(candidates) > 0 && (spec.MaxRunning <= 0 || total < int(spec.MaxRunning)) {
+		// the fair share order changes with every admission
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return isQueuedBefore(spec, perNamespace, candidates[i], candidates[j])
+		})
+		workflow := candidates[0]
+		candidates = candidates[1:]
+
+		if spec.MaxRunningPerNamespace > 0 && perNamespace[workflow.Namespace] >= int(spec.MaxRunningPerNamespace) {
+			continue
+		}
+		clusterNames := getManagedClusterNames(workflow)
+		fits := true
+		for _, name := range clusterNames {
+			if spec.MaxRunningPerCluster > 0 && perCluster[name] >= int(spec.MaxRunningPerCluster) {
+				fits = false
+				break
+			}
+		}
+		if !fits {
+			continue
+		}
+
+		total++
+		perNamespace[workflow.Namespace]++
+		for _, name := range clusterNames {
+			perCluster[name]++
+		}
+		admitted = append(admitted, workflow)
+	}
+	return admitted
+}
+
+// isQueuedBefore returns true if the Workflow a is admitted before the Workflow b: by priority,
+// then by the running Workflows of their namespace for a fair share queue, then by creation
+func isQueuedBefore(spec workflowv1alpha2.WorkflowQueueSpec, perNamespace map[string]int, a, b argov1alpha1.Workflow) bool {
+	if priorityA, priorityB := getQueuePriority(spec, a), getQueuePriority(spec, b); priorityA != priorityB {
+		return priorityA > priorityB
+	}
+	if spec.Ordering == workflowv1alpha2.WorkflowQueueOrderingFairShare && perNamespace[a.Namespace] != perNamespace[b.Namespace] {
+		return perNamespace[a.Namespace] < perNamespace[b.Namespace]
+	}
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+}
+
+// setQueuedStatus keeps the Workflow Pending with the Queued condition until its WorkflowQueue admits it
+func setQueuedStatus(workflow *argov1alpha1.Workflow, message string) {
+	workflow.Status.Phase = argov1alpha1.WorkflowPending
+	workflow.Status.Message = message
+	workflow.Status.Conditions.UpsertCondition(argov1alpha1.Condition{
+		Type:    ConditionTypeQueued,
+		Status:  metav1.ConditionTrue,
+		Message: message,
+	})
+}
+
+// admitQueuedWorkflow marks the Workflow as admitted by its WorkflowQueue so it gets propagated to its managed cluster(s)
+func admitQueuedWorkflow(workflow *argov1alpha1.Workflow, now time.Time) {
+	annos := workflow.GetAnnotations()
+	annos[AnnotationKeyOCMQueueAdmitted] = now.UTC().Format(time.RFC3339)
+	workflow.SetAnnotations(annos)
+
+	workflow.Status.Message = "admitted by WorkflowQueue " + annos[AnnotationKeyOCMQueue] + ", pending Workflow propagation and execution"
+	workflow.Status.Conditions.RemoveCondition(ConditionTypeQueued)
 }
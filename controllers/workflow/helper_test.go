@@ -17,11 +17,29 @@ limitations under the License.
 package workflow
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	workv1 "open-cluster-management.io/api/work/v1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func Test_containsValidOCMLabel(t *testing.T) {
@@ -125,6 +143,17 @@ func Test_containsValidOCMAnnotation(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "valid OCM fan-out annotation",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMManagedClusters: "cluster1,cluster2"},
+					},
+				},
+			},
+			want: true,
+		},
 		{
 			name: "invalid OCM annotation",
 			args: args{
@@ -206,6 +235,77 @@ func Test_containsValidOCMPlacementAnnotation(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "inline Placement spec",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMPlacementSpec: "numberOfClusters: 1"},
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "evaluated inline Placement spec",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMPlacementSpec:  "numberOfClusters: 1",
+							AnnotationKeyOCMLastPlacement:  "hello-abcde",
+							AnnotationKeyOCMManagedCluster: "cluster1",
+						},
+					},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "placed Workflow",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMPlacement:         "placement1",
+							AnnotationKeyOCMManagedCluster:    "cluster1",
+							AnnotationKeyOCMPlacementDecision: `[{"placement":"placement1","clusters":["cluster1"]}]`,
+						},
+					},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "rescheduled fan-out Workflow",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMPlacement:         "placement1",
+							AnnotationKeyOCMManagedClusters:   "cluster1",
+							AnnotationKeyOCMPlacementDecision: `[{"placement":"placement1","clusters":["cluster1","cluster2"]}]`,
+						},
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "changed Placement",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMPlacement:         "placement2",
+							AnnotationKeyOCMManagedCluster:    "cluster1",
+							AnnotationKeyOCMPlacementDecision: `[{"placement":"placement1","clusters":["cluster1"]}]`,
+						},
+					},
+				},
+			},
+			want: true,
+		},
 		{
 			name: "no OCM Placement annotation",
 			args: args{
@@ -223,6 +323,124 @@ func Test_containsValidOCMPlacementAnnotation(t *testing.T) {
 	}
 }
 
+func Test_getAwaitedPlacementName(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+	}{
+		{
+			name:        "pre-created Placement",
+			annotations: map[string]string{AnnotationKeyOCMPlacement: "placement1"},
+			want:        "placement1",
+		},
+		{
+			name:        "inline Placement spec",
+			annotations: map[string]string{AnnotationKeyOCMPlacementSpec: "numberOfClusters: 1"},
+			want:        "hello-abcde",
+		},
+		{
+			name: "placed Workflow",
+			annotations: map[string]string{
+				AnnotationKeyOCMPlacement:         "placement1",
+				AnnotationKeyOCMLastPlacement:     "placement1",
+				AnnotationKeyOCMManagedCluster:    "cluster1",
+				AnnotationKeyOCMPlacementDecision: `[{"placement":"placement1","clusters":["cluster1"]}]`,
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow := argov1alpha1.Workflow{
+				ObjectMeta: v1.ObjectMeta{Name: "hello", UID: "abcdefgh", Annotations: tt.annotations},
+			}
+			if got := getAwaitedPlacementName(workflow); got != tt.want {
+				t.Errorf("getAwaitedPlacementName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setAwaitingPlacementDecisionStatus(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		Status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowError, Message: "previous error"},
+	}
+	if isAwaitingPlacementDecision(workflow) {
+		t.Errorf("isAwaitingPlacementDecision() = true before the status is set")
+	}
+	setAwaitingPlacementDecisionStatus(&workflow, "waiting for a PlacementDecision of Placement placement1")
+	setAwaitingPlacementDecisionStatus(&workflow, "waiting for a PlacementDecision of Placement placement1")
+	if !isAwaitingPlacementDecision(workflow) {
+		t.Errorf("isAwaitingPlacementDecision() = false after the status is set")
+	}
+
+	if workflow.Status.Phase != argov1alpha1.WorkflowPending ||
+		workflow.Status.Message != "waiting for a PlacementDecision of Placement placement1" {
+		t.Errorf("setAwaitingPlacementDecisionStatus() status = %v", workflow.Status)
+	}
+	if len(workflow.Status.Conditions) != 1 || workflow.Status.Conditions[0].Type != ConditionTypeAwaitingPlacementDecision ||
+		workflow.Status.Conditions[0].Status != v1.ConditionTrue {
+		t.Errorf("setAwaitingPlacementDecisionStatus() conditions = %v", workflow.Status.Conditions)
+	}
+}
+
+func Test_generateInlinePlacement(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "hello",
+			Namespace: "argo",
+			UID:       "abcdef-123",
+			Annotations: map[string]string{AnnotationKeyOCMPlacementSpec: `
+predicates:
+- requiredClusterSelector:
+    labelSelector:
+      matchLabels:
+        gpu: "true"
+tolerations:
+- key: cluster.open-cluster-management.io/unreachable
+  operator: Exists
+`},
+		},
+	}
+
+	placement, err := generateInlinePlacement(workflow)
+	if err != nil {
+		t.Fatalf("generateInlinePlacement() error = %v", err)
+	}
+	if placement.Name != "hello-abcde" || placement.Namespace != "argo" ||
+		len(placement.OwnerReferences) != 1 || placement.OwnerReferences[0].UID != workflow.UID {
+		t.Errorf("generateInlinePlacement() = %v", placement.ObjectMeta)
+	}
+	if len(placement.Spec.Predicates) != 1 || len(placement.Spec.Tolerations) != 1 ||
+		placement.Spec.Predicates[0].RequiredClusterSelector.LabelSelector.MatchLabels["gpu"] != "true" {
+		t.Errorf("generateInlinePlacement() spec = %v", placement.Spec)
+	}
+
+	workflow.Annotations[AnnotationKeyOCMPlacementSpec] = "clusterSelector: gpu=true"
+	if _, err := generateInlinePlacement(workflow); err == nil {
+		t.Errorf("generateInlinePlacement() expected an error for an unknown field")
+	}
+}
+
+func Test_generateInlinePlacementName(t *testing.T) {
+	workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Name: "hello", UID: "abcdef-123"}}
+	if got := generateInlinePlacementName(workflow); got != "hello-abcde" {
+		t.Errorf("generateInlinePlacementName() = %v, want %v", got, "hello-abcde")
+	}
+
+	workflow.Name = strings.Repeat("a", 100)
+	other := workflow
+	other.UID = "fedcba-321"
+	got, otherGot := generateInlinePlacementName(workflow), generateInlinePlacementName(other)
+	if len(got) > maxLabelValueLength || len(otherGot) > maxLabelValueLength {
+		t.Errorf("generateInlinePlacementName() = %v, longer than %d", got, maxLabelValueLength)
+	}
+	if got == otherGot {
+		t.Errorf("generateInlinePlacementName() = %v for two Workflow UIDs", got)
+	}
+}
+
 func Test_generateWorkflowNamespace(t *testing.T) {
 	type args struct {
 		workflow argov1alpha1.Workflow
@@ -330,16 +548,82 @@ func Test_prepareWorkflowForWorkPayload(t *testing.T) {
 					ObjectMeta: v1.ObjectMeta{
 						Name:      "workflow1",
 						Namespace: "argo",
+						UID:       "abcdefghijk",
 						Labels:    map[string]string{LabelKeyEnableOCMMulticluster: "true"},
 					},
 				},
 			},
 			want: argov1alpha1.Workflow{
 				ObjectMeta: v1.ObjectMeta{
-					Name:        "workflow1",
-					Namespace:   "argo",
-					Labels:      map[string]string{LabelKeyEnableOCMMulticluster: "false"},
-					Annotations: map[string]string{AnnotationKeyHubWorkflowNamespace: "argo", AnnotationKeyHubWorkflowName: "workflow1"},
+					Name:      "workflow1",
+					Namespace: "argo",
+					Labels:    map[string]string{LabelKeyEnableOCMMulticluster: "false"},
+					Annotations: map[string]string{
+						AnnotationKeyHubWorkflowNamespace: "argo",
+						AnnotationKeyHubWorkflowName:      "workflow1",
+						AnnotationKeyHubWorkflowUID:       "abcdefghijk",
+					},
+				},
+			},
+		},
+		{
+			name: "hub only workflow",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      "workflow1",
+						Namespace: "argo",
+						UID:       "abcdefghijk",
+						Labels: map[string]string{
+							LabelKeyEnableOCMMulticluster: "true",
+							LabelKeyControllerInstanceID:  DefaultHubControllerInstanceID,
+						},
+						Annotations: map[string]string{AnnotationKeyOCMClusterAttempts: "[]"},
+					},
+				},
+			},
+			want: argov1alpha1.Workflow{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "workflow1",
+					Namespace: "argo",
+					Labels:    map[string]string{LabelKeyEnableOCMMulticluster: "false"},
+					Annotations: map[string]string{
+						AnnotationKeyHubWorkflowNamespace: "argo",
+						AnnotationKeyHubWorkflowName:      "workflow1",
+						AnnotationKeyHubWorkflowUID:       "abcdefghijk",
+					},
+				},
+			},
+		},
+		{
+			name: "user instance ID workflow",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Name:      "workflow1",
+						Namespace: "argo",
+						UID:       "abcdefghijk",
+						Labels: map[string]string{
+							LabelKeyEnableOCMMulticluster: "true",
+							LabelKeyControllerInstanceID:  DefaultHubControllerInstanceID,
+						},
+						Annotations: map[string]string{AnnotationKeyOCMControllerInstanceID: "custom"},
+					},
+				},
+			},
+			want: argov1alpha1.Workflow{
+				ObjectMeta: v1.ObjectMeta{
+					Name:      "workflow1",
+					Namespace: "argo",
+					Labels: map[string]string{
+						LabelKeyEnableOCMMulticluster: "false",
+						LabelKeyControllerInstanceID:  "custom",
+					},
+					Annotations: map[string]string{
+						AnnotationKeyHubWorkflowNamespace: "argo",
+						AnnotationKeyHubWorkflowName:      "workflow1",
+						AnnotationKeyHubWorkflowUID:       "abcdefghijk",
+					},
 				},
 			},
 		},
@@ -372,14 +656,17 @@ func Test_generateManifestWork(t *testing.T) {
 	}
 
 	type args struct {
-		name      string
-		namespace string
-		workflow  argov1alpha1.Workflow
+		name         string
+		namespace    string
+		workflow     argov1alpha1.Workflow
+		dependencies []runtime.Object
 	}
 	tests := []struct {
 		name              string
 		args              args
 		populatedWorkload bool
+		wantManifests     int
+		wantOrphans       int
 	}{
 		{
 			name: "sunny",
@@ -389,14 +676,2334 @@ func Test_generateManifestWork(t *testing.T) {
 				workflow:  workflow,
 			},
 			populatedWorkload: true,
+			wantManifests:     1,
+		},
+		{
+			name: "with dependencies",
+			args: args{
+				name:      "workflow1-abcde",
+				namespace: "cluster1",
+				workflow:  workflow,
+				dependencies: []runtime.Object{
+					&argov1alpha1.WorkflowTemplate{ObjectMeta: v1.ObjectMeta{Name: "template1", Namespace: "argo"}},
+					&argov1alpha1.ClusterWorkflowTemplate{ObjectMeta: v1.ObjectMeta{Name: "template2"}},
+				},
+			},
+			populatedWorkload: true,
+			wantManifests:     3,
+		},
+		{
+			name: "with namespace",
+			args: args{
+				name:         "workflow1-abcde",
+				namespace:    "cluster1",
+				workflow:     workflow,
+				dependencies: generateNamespaceManifests(workflow),
+			},
+			populatedWorkload: true,
+			wantManifests:     4,
+			wantOrphans:       1,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := generateManifestWork(tt.args.name, tt.args.namespace, tt.args.workflow)
+			got := generateManifestWork(tt.args.name, tt.args.namespace, tt.args.workflow, tt.args.dependencies...)
+			if tt.wantOrphans == 0 && got.Spec.DeleteOption != nil {
+				t.Errorf("generateManifestWork() DeleteOption = %v, want nil", got.Spec.DeleteOption)
+			}
+			if tt.wantOrphans > 0 && (got.Spec.DeleteOption == nil ||
+				len(got.Spec.DeleteOption.SelectivelyOrphan.OrphaningRules) != tt.wantOrphans) {
+				t.Errorf("generateManifestWork() DeleteOption = %v, want %v orphaning rules", got.Spec.DeleteOption, tt.wantOrphans)
+			}
 			if !reflect.DeepEqual(len(got.Spec.Workload.Manifests) > 0, tt.populatedWorkload) {
 				t.Errorf("generateManifestWork() populatedWorkload = %v, want %v", got.Spec.Workload.Manifests, tt.populatedWorkload)
 			}
+			if len(got.Spec.Workload.Manifests) != tt.wantManifests {
+				t.Errorf("generateManifestWork() manifests = %v, want %v", len(got.Spec.Workload.Manifests), tt.wantManifests)
+			}
+		})
+	}
+}
+
+func Test_getStatusFeedbackWorkflowStatus(t *testing.T) {
+	str := func(v string) *string { return &v }
+	feedbackWork := func(values ...workv1.FeedbackValue) workv1.ManifestWork {
+		return workv1.ManifestWork{Status: workv1.ManifestWorkStatus{ResourceStatus: workv1.ManifestResourceStatus{
+			Manifests: []workv1.ManifestCondition{
+				{ResourceMeta: workv1.ManifestResourceMeta{Group: "argoproj.io", Resource: "workflowtemplates"}},
+				{
+					ResourceMeta:    workv1.ManifestResourceMeta{Group: "argoproj.io", Resource: "workflows"},
+					StatusFeedbacks: workv1.StatusFeedbackResult{Values: values},
+				},
+			},
+		}}}
+	}
+	startedAt := v1.NewTime(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	tests := []struct {
+		name   string
+		mw     workv1.ManifestWork
+		want   argov1alpha1.WorkflowStatus
+		wantOk bool
+	}{
+		{
+			name: "no feedback",
+			mw:   feedbackWork(),
+		},
+		{
+			name: "running",
+			mw: feedbackWork(
+				workv1.FeedbackValue{Name: "phase", Value: workv1.FieldValue{Type: workv1.String, String: str("Running")}},
+				workv1.FeedbackValue{Name: "startedAt", Value: workv1.FieldValue{Type: workv1.String, String: str("2023-01-02T03:04:05Z")}},
+				workv1.FeedbackValue{Name: "finishedAt", Value: workv1.FieldValue{Type: workv1.String, String: str("invalid")}},
+				workv1.FeedbackValue{Name: "progress", Value: workv1.FieldValue{Type: workv1.String, String: str("1/2")}},
+			),
+			want:   argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowRunning, StartedAt: startedAt, Progress: "1/2"},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := getStatusFeedbackWorkflowStatus(tt.mw)
+			if ok != tt.wantOk || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getStatusFeedbackWorkflowStatus() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_getManifestWorkHubWorkflowReference(t *testing.T) {
+	workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Name: "hello", Namespace: "argo", UID: "abcdef"}}
+	payload, _ := json.Marshal(prepareWorkflowForWorkPayload(workflow))
+	template, _ := json.Marshal(&argov1alpha1.WorkflowTemplate{
+		TypeMeta:   v1.TypeMeta{APIVersion: "argoproj.io/v1alpha1", Kind: "WorkflowTemplate"},
+		ObjectMeta: v1.ObjectMeta{Name: "template1"},
+	})
+	manifestWork := func(raws ...[]byte) workv1.ManifestWork {
+		mw := workv1.ManifestWork{}
+		for _, raw := range raws {
+			mw.Spec.Workload.Manifests = append(mw.Spec.Workload.Manifests, workv1.Manifest{RawExtension: runtime.RawExtension{Raw: raw}})
+		}
+		return mw
+	}
+
+	tests := []struct {
+		name   string
+		mw     workv1.ManifestWork
+		want   workflowv1alpha2.HubWorkflowReference
+		wantOk bool
+	}{
+		{
+			name:   "workflow manifest",
+			mw:     manifestWork(template, payload),
+			want:   workflowv1alpha2.HubWorkflowReference{Namespace: "argo", Name: "hello", UID: "abcdef"},
+			wantOk: true,
+		},
+		{
+			name: "no workflow manifest",
+			mw:   manifestWork(template),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := getManifestWorkHubWorkflowReference(tt.mw)
+			if ok != tt.wantOk || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getManifestWorkHubWorkflowReference() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_getManagedClusterNames(t *testing.T) {
+	type args struct {
+		workflow argov1alpha1.Workflow
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "single managed cluster",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMManagedCluster: "cluster1"},
+					},
+				},
+			},
+			want: []string{"cluster1"},
+		},
+		{
+			name: "fan-out managed clusters",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMManagedCluster:  "cluster1",
+							AnnotationKeyOCMManagedClusters: "cluster2, cluster3,,",
+						},
+					},
+				},
+			},
+			want: []string{"cluster2", "cluster3"},
+		},
+		{
+			name: "no managed cluster",
+			args: args{
+				argov1alpha1.Workflow{},
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getManagedClusterNames(tt.args.workflow); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getManagedClusterNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getDecidedClusterNames(t *testing.T) {
+	type args struct {
+		placementDecisions []clusterv1beta1.PlacementDecision
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "multiple PlacementDecision pages",
+			args: args{
+				[]clusterv1beta1.PlacementDecision{
+					{
+						Status: clusterv1beta1.PlacementDecisionStatus{
+							Decisions: []clusterv1beta1.ClusterDecision{{ClusterName: "cluster1"}, {ClusterName: "cluster2"}},
+						},
+					},
+					{
+						Status: clusterv1beta1.PlacementDecisionStatus{
+							Decisions: []clusterv1beta1.ClusterDecision{{ClusterName: "cluster2"}, {ClusterName: ""}, {ClusterName: "cluster3"}},
+						},
+					},
+				},
+			},
+			want: []string{"cluster1", "cluster2", "cluster3"},
+		},
+		{
+			name: "no decisions",
+			args: args{
+				[]clusterv1beta1.PlacementDecision{{}},
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getDecidedClusterNames(tt.args.placementDecisions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getDecidedClusterNames() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
+
+func Test_aggregateFanOutStatus(t *testing.T) {
+	early := v1.NewTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	late := v1.NewTime(time.Date(2023, 1, 1, 1, 0, 0, 0, time.UTC))
+
+	type args struct {
+		clusterStatuses map[string]argov1alpha1.WorkflowStatus
+	}
+	tests := []struct {
+		name         string
+		args         args
+		wantPhase    argov1alpha1.WorkflowPhase
+		wantProgress argov1alpha1.Progress
+		wantFinished v1.Time
+	}{
+		{
+			name: "all succeeded",
+			args: args{
+				map[string]argov1alpha1.WorkflowStatus{
+					"cluster1": {Phase: argov1alpha1.WorkflowSucceeded, StartedAt: early, FinishedAt: early, Progress: "1/1"},
+					"cluster2": {Phase: argov1alpha1.WorkflowSucceeded, StartedAt: late, FinishedAt: late, Progress: "1/1"},
+				},
+			},
+			wantPhase:    argov1alpha1.WorkflowSucceeded,
+			wantProgress: "2/2",
+			wantFinished: late,
+		},
+		{
+			name: "one failed",
+			args: args{
+				map[string]argov1alpha1.WorkflowStatus{
+					"cluster1": {Phase: argov1alpha1.WorkflowSucceeded, FinishedAt: early},
+					"cluster2": {Phase: argov1alpha1.WorkflowFailed, FinishedAt: late},
+				},
+			},
+			wantPhase:    argov1alpha1.WorkflowFailed,
+			wantFinished: late,
+		},
+		{
+			name: "one still running",
+			args: args{
+				map[string]argov1alpha1.WorkflowStatus{
+					"cluster1": {Phase: argov1alpha1.WorkflowFailed, FinishedAt: early, Progress: "0/1"},
+					"cluster2": {Phase: argov1alpha1.WorkflowRunning, Progress: "0/1"},
+				},
+			},
+			wantPhase:    argov1alpha1.WorkflowRunning,
+			wantProgress: "0/2",
+		},
+		{
+			name: "none started",
+			args: args{
+				map[string]argov1alpha1.WorkflowStatus{
+					"cluster1": {},
+					"cluster2": {},
+				},
+			},
+			wantPhase: argov1alpha1.WorkflowPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregateFanOutStatus(tt.args.clusterStatuses)
+			if got.Phase != tt.wantPhase {
+				t.Errorf("aggregateFanOutStatus() Phase = %v, want %v", got.Phase, tt.wantPhase)
+			}
+			if got.Progress != tt.wantProgress {
+				t.Errorf("aggregateFanOutStatus() Progress = %v, want %v", got.Progress, tt.wantProgress)
+			}
+			if !got.FinishedAt.Equal(&tt.wantFinished) {
+				t.Errorf("aggregateFanOutStatus() FinishedAt = %v, want %v", got.FinishedAt, tt.wantFinished)
+			}
+		})
+	}
+}
+
+func Test_populateFanOutFeedbackStatus(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{
+			Annotations: map[string]string{
+				AnnotationKeyOCMManagedClusters:        "cluster1,cluster2",
+				AnnotationKeyOCMManagedClusterStatuses: `{"cluster2":{"phase":"Succeeded","outputs":{"exitCode":"0"}}}`,
+			},
+		},
+	}
+
+	if err := populateFanOutFeedbackStatus(&workflow, "cluster1", argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowRunning}); err != nil {
+		t.Fatalf("populateFanOutFeedbackStatus() error = %v", err)
+	}
+	if workflow.Status.Phase != argov1alpha1.WorkflowRunning {
+		t.Errorf("populateFanOutFeedbackStatus() phase = %v, want %v", workflow.Status.Phase, argov1alpha1.WorkflowRunning)
+	}
+	summaries := getManagedClusterStatuses(workflow)
+	if summaries["cluster1"].Phase != argov1alpha1.WorkflowRunning || summaries["cluster2"].Outputs == nil {
+		t.Errorf("populateFanOutFeedbackStatus() summaries = %v", summaries)
+	}
+
+	if err := populateFanOutFeedbackStatus(&workflow, "cluster1", argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowSucceeded}); err != nil {
+		t.Fatalf("populateFanOutFeedbackStatus() error = %v", err)
+	}
+	if workflow.Status.Phase != argov1alpha1.WorkflowSucceeded {
+		t.Errorf("populateFanOutFeedbackStatus() phase = %v, want %v", workflow.Status.Phase, argov1alpha1.WorkflowSucceeded)
+	}
+}
+
+func Test_excludeClusterNames(t *testing.T) {
+	type args struct {
+		workflow argov1alpha1.Workflow
+		names    []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "excluded clusters",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMExcludedClusters: "cluster1,cluster3"},
+					},
+				},
+				names: []string{"cluster1", "cluster2", "cluster3"},
+			},
+			want: []string{"cluster2"},
+		},
+		{
+			name: "no excluded clusters",
+			args: args{
+				workflow: argov1alpha1.Workflow{},
+				names:    []string{"cluster1", "cluster2"},
+			},
+			want: []string{"cluster1", "cluster2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := excludeClusterNames(tt.args.workflow, tt.args.names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("excludeClusterNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getWorkflowResourceDemand(t *testing.T) {
+	resources := func(cpu, memory string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}}
+	}
+	gpu := corev1.ResourceRequirements{Limits: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}}
+	parallelism, templateParallelism := int64(3), int64(2)
+	count := intstr.FromString("4")
+	small := argov1alpha1.Template{Name: "small", Container: &corev1.Container{Resources: resources("1", "1Gi")}}
+	large := argov1alpha1.Template{Name: "large", Container: &corev1.Container{Resources: resources("2", "4Gi")}}
+
+	tests := []struct {
+		name          string
+		spec          argov1alpha1.WorkflowSpec
+		templateSpecs map[templateReference]argov1alpha1.WorkflowSpec
+		want          corev1.ResourceList
+	}{
+		{
+			name: "no pod templates",
+			spec: argov1alpha1.WorkflowSpec{Entrypoint: "steps", Templates: []argov1alpha1.Template{
+				{Name: "steps", Steps: []argov1alpha1.ParallelSteps{}},
+			}},
+			want: corev1.ResourceList{},
+		},
+		{
+			name: "largest pod with sidecars and init containers",
+			spec: argov1alpha1.WorkflowSpec{Templates: []argov1alpha1.Template{
+				small,
+				{
+					Name:           "script",
+					Script:         &argov1alpha1.ScriptTemplate{Container: corev1.Container{Resources: resources("2", "1Gi")}},
+					Sidecars:       []argov1alpha1.UserContainer{{Container: corev1.Container{Name: "sidecar", Resources: resources("500m", "1Gi")}}},
+					InitContainers: []argov1alpha1.UserContainer{{Container: corev1.Container{Name: "init", Resources: resources("100m", "4Gi")}}},
+				},
+				{Name: "gpu", Container: &corev1.Container{Resources: gpu}},
+			}},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2500m"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+				"nvidia.com/gpu":      resource.MustParse("1"),
+			},
+		},
+		{
+			name: "pod spec patches",
+			spec: argov1alpha1.WorkflowSpec{
+				PodSpecPatch: `{"containers":[{"name":"main","resources":{"requests":{"cpu":"2"}}}]}`,
+				Templates: []argov1alpha1.Template{
+					{
+						Name:         "patched",
+						Container:    &corev1.Container{Resources: resources("1", "1Gi")},
+						PodSpecPatch: "containers:\n- name: main\n  resources:\n    requests:\n      memory: 2Gi",
+					},
+					{
+						Name:         "expression",
+						Container:    &corev1.Container{Resources: resources("1", "1Gi")},
+						PodSpecPatch: "{{inputs.parameters.patch}}",
+					},
+				},
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("2Gi"),
+			},
+		},
+		{
+			name: "largest step group with items",
+			spec: argov1alpha1.WorkflowSpec{Entrypoint: "main", Templates: []argov1alpha1.Template{
+				{Name: "main", Steps: []argov1alpha1.ParallelSteps{
+					{Steps: []argov1alpha1.WorkflowStep{{Name: "prepare", Template: "large"}}},
+					{Steps: []argov1alpha1.WorkflowStep{
+						{Name: "items", Template: "small", WithItems: []argov1alpha1.Item{{}, {}, {}}},
+						{Name: "param", Template: "small", WithParam: "{{steps.prepare.outputs.result}}"},
+					}},
+				}},
+				small, large,
+			}},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+		},
+		{
+			name: "DAG depths with sequence and template parallelism",
+			spec: argov1alpha1.WorkflowSpec{Entrypoint: "main", Templates: []argov1alpha1.Template{
+				{Name: "main", Parallelism: &templateParallelism, DAG: &argov1alpha1.DAGTemplate{Tasks: []argov1alpha1.DAGTask{
+					{Name: "a", Template: "large"},
+					{Name: "b", Template: "small", Dependencies: []string{"a"}, WithSequence: &argov1alpha1.Sequence{Count: &count}},
+					{Name: "c", Template: "large", Depends: "a.Succeeded"},
+					{Name: "d", Template: "small", Depends: "b && c"},
+				}}},
+				small, large,
+			}},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			},
+		},
+		{
+			name: "nested template references and Workflow parallelism",
+			spec: argov1alpha1.WorkflowSpec{
+				Parallelism:         &parallelism,
+				WorkflowTemplateRef: &argov1alpha1.WorkflowTemplateRef{Name: "wft"},
+			},
+			templateSpecs: map[templateReference]argov1alpha1.WorkflowSpec{
+				{Name: "wft"}: {Entrypoint: "main", Templates: []argov1alpha1.Template{
+					{Name: "main", Steps: []argov1alpha1.ParallelSteps{{Steps: []argov1alpha1.WorkflowStep{
+						{Name: "fanout", TemplateRef: &argov1alpha1.TemplateRef{Name: "cwft", Template: "fanout", ClusterScope: true}},
+					}}}},
+				}},
+				{Name: "cwft", ClusterScope: true}: {Templates: []argov1alpha1.Template{
+					{Name: "fanout", Steps: []argov1alpha1.ParallelSteps{{Steps: []argov1alpha1.WorkflowStep{
+						{Name: "small", Template: "small", WithItems: []argov1alpha1.Item{{}, {}, {}, {}, {}}},
+						{Name: "recursive", Template: "fanout"},
+					}}}},
+					small,
+				}},
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("3"),
+				corev1.ResourceMemory: resource.MustParse("3Gi"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getWorkflowResourceDemand(tt.spec, tt.templateSpecs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("getWorkflowResourceDemand() = %v, want %v", got, tt.want)
+			}
+			for name, quantity := range tt.want {
+				if gotQuantity := got[name]; gotQuantity.Cmp(quantity) != 0 {
+					t.Errorf("getWorkflowResourceDemand() %s = %v, want %v", name, got[name], quantity)
+				}
+			}
+		})
+	}
+}
+
+func Test_getExpansionCount(t *testing.T) {
+	sequence := func(count, start, end *intstr.IntOrString) *argov1alpha1.Sequence {
+		return &argov1alpha1.Sequence{Count: count, Start: start, End: end}
+	}
+	five, two, expression := intstr.FromInt(5), intstr.FromString("2"), intstr.FromString("{{inputs.parameters.count}}")
+
+	tests := []struct {
+		name         string
+		withItems    []argov1alpha1.Item
+		withSequence *argov1alpha1.Sequence
+		want         int64
+	}{
+		{"no expansion", nil, nil, 1},
+		{"items", []argov1alpha1.Item{{}, {}}, nil, 2},
+		{"count", nil, sequence(&five, nil, nil), 5},
+		{"start and end", nil, sequence(nil, &two, &five), 4},
+		{"reversed", nil, sequence(nil, &five, &two), 4},
+		{"expression", nil, sequence(&expression, nil, nil), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getExpansionCount(tt.withItems, tt.withSequence); got != tt.want {
+				t.Errorf("getExpansionCount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getDAGTaskDepths(t *testing.T) {
+	tasks := []argov1alpha1.DAGTask{
+		{Name: "a"},
+		{Name: "b", Dependencies: []string{"a"}},
+		{Name: "c", Depends: "(a || b.Failed) && !b-2.Errored"},
+		{Name: "b-2", Depends: "a"},
+		{Name: "cycle", Depends: "cycle2"},
+		{Name: "cycle2", Depends: "cycle"},
+	}
+	want := []int{0, 1, 2, 1, 2, 1}
+	if got := getDAGTaskDepths(tasks); !reflect.DeepEqual(got, want) {
+		t.Errorf("getDAGTaskDepths() = %v, want %v", got, want)
+	}
+}
+
+func Test_multiplyQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity resource.Quantity
+		factor   int64
+		want     resource.Quantity
+	}{
+		{"cpu", resource.MustParse("500m"), 3, resource.MustParse("1500m")},
+		{"memory", resource.MustParse("1Gi"), 1000000, resource.MustParse("1000000Gi")},
+		{"overflow", resource.MustParse("1Ti"), math.MaxInt32, *resource.NewMilliQuantity(math.MaxInt64, resource.BinarySI)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := multiplyQuantity(tt.quantity, tt.factor); got.Cmp(tt.want) != 0 {
+				t.Errorf("multiplyQuantity() = %v, want %v", got.String(), tt.want.String())
+			}
+		})
+	}
+}
+
+func Test_fitsResourceDemand(t *testing.T) {
+	managedCluster := clusterv1.ManagedCluster{Status: clusterv1.ManagedClusterStatus{Allocatable: clusterv1.ResourceList{
+		clusterv1.ResourceCPU:    resource.MustParse("4"),
+		clusterv1.ResourceMemory: resource.MustParse("8Gi"),
+	}}}
+
+	tests := []struct {
+		name   string
+		claim  string
+		demand corev1.ResourceList
+		want   bool
+	}{
+		{
+			name:   "fits",
+			demand: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+			want:   true,
+		},
+		{
+			name:   "too much memory",
+			demand: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("16Gi")},
+		},
+		{
+			name:   "unreported resource",
+			demand: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")},
+			want:   true,
+		},
+		{
+			name:   "used resources",
+			claim:  `{"cpu":"3500m","memory":"1Gi"}`,
+			demand: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+		},
+		{
+			name:   "invalid usage claim",
+			claim:  "3500m",
+			demand: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			managedCluster := *managedCluster.DeepCopy()
+			if len(tt.claim) > 0 {
+				managedCluster.Status.ClusterClaims = []clusterv1.ManagedClusterClaim{{Name: ClusterClaimResourceUsage, Value: tt.claim}}
+			}
+			if got := fitsResourceDemand(managedCluster, tt.demand); got != tt.want {
+				t.Errorf("fitsResourceDemand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getPlacementScore(t *testing.T) {
+	now := time.Now()
+	expired := v1.NewTime(now.Add(-time.Minute))
+	score := clusterv1alpha1.AddOnPlacementScore{Status: clusterv1alpha1.AddOnPlacementScoreStatus{
+		Scores: []clusterv1alpha1.AddOnPlacementScoreItem{{Name: "cpuAvailable", Value: 42}},
+	}}
+
+	if value, ok := getPlacementScore(score, "cpuAvailable", now); !ok || value != 42 {
+		t.Errorf("getPlacementScore() = %v, %v, want 42, true", value, ok)
+	}
+	if _, ok := getPlacementScore(score, "memAvailable", now); ok {
+		t.Errorf("getPlacementScore() of a missing score expected false")
+	}
+	score.Status.ValidUntil = &expired
+	if _, ok := getPlacementScore(score, "cpuAvailable", now); ok {
+		t.Errorf("getPlacementScore() of an expired score expected false")
+	}
+}
+
+func Test_rankClusterNamesByScore(t *testing.T) {
+	names := []string{"cluster1", "cluster2", "cluster3", "cluster4"}
+	scores := map[string]int32{"cluster2": 10, "cluster3": 50, "cluster4": 10}
+	want := []string{"cluster3", "cluster2", "cluster4", "cluster1"}
+	if got := rankClusterNamesByScore(names, scores); !reflect.DeepEqual(got, want) {
+		t.Errorf("rankClusterNamesByScore() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(names, []string{"cluster1", "cluster2", "cluster3", "cluster4"}) {
+		t.Errorf("rankClusterNamesByScore() modified the decided cluster names")
+	}
+}
+
+func Test_getPlacementDecisionNames(t *testing.T) {
+	placementDecisions := []clusterv1beta1.PlacementDecision{
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "placement-decision-1"},
+			Status: clusterv1beta1.PlacementDecisionStatus{
+				Decisions: []clusterv1beta1.ClusterDecision{{ClusterName: "cluster1"}, {ClusterName: "cluster2"}},
+			},
+		},
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "placement-decision-2"},
+			Status: clusterv1beta1.PlacementDecisionStatus{
+				Decisions: []clusterv1beta1.ClusterDecision{{ClusterName: "cluster3"}},
+			},
+		},
+	}
+	tests := []struct {
+		name         string
+		clusterNames []string
+		want         []string
+	}{
+		{"single cluster", []string{"cluster2"}, []string{"placement-decision-1"}},
+		{"clusters across decisions", []string{"cluster3", "cluster1"}, []string{"placement-decision-1", "placement-decision-2"}},
+		{"not decided", []string{"cluster4"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getPlacementDecisionNames(placementDecisions, tt.clusterNames); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getPlacementDecisionNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GetPlacementDecisionRecord(t *testing.T) {
+	record := PlacementDecisionRecord{
+		Placement:          "placement",
+		PlacementDecisions: []string{"placement-decision-1"},
+		Clusters:           []string{"cluster1"},
+		Candidates:         []string{"cluster2"},
+		DecidedAt:          v1.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	recordJSON, _ := json.Marshal(record)
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{AnnotationKeyOCMPlacementDecision: string(recordJSON)}},
+	}
+	got, ok := GetPlacementDecisionRecord(workflow)
+	if !ok || !got.DecidedAt.Equal(&record.DecidedAt) {
+		t.Errorf("GetPlacementDecisionRecord() = %v, %v, want %v", got, ok, record)
+	}
+	got.DecidedAt = record.DecidedAt
+	if !reflect.DeepEqual(got, record) {
+		t.Errorf("GetPlacementDecisionRecord() = %v, want %v", got, record)
+	}
+
+	workflow.Annotations[AnnotationKeyOCMPlacementDecision] = "not json"
+	if _, ok := GetPlacementDecisionRecord(workflow); ok {
+		t.Errorf("GetPlacementDecisionRecord() of an invalid record expected false")
+	}
+	if _, ok := GetPlacementDecisionRecord(argov1alpha1.Workflow{}); ok {
+		t.Errorf("GetPlacementDecisionRecord() of an unplaced Workflow expected false")
+	}
+}
+
+func Test_appendPlacementDecisionRecord(t *testing.T) {
+	legacy, _ := json.Marshal(PlacementDecisionRecord{Placement: "placement", Clusters: []string{"cluster0"}})
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{AnnotationKeyOCMPlacementDecision: string(legacy)}},
+	}
+	for i := 1; i <= maxPlacementDecisionRecords; i++ {
+		record := PlacementDecisionRecord{Placement: "placement", Clusters: []string{fmt.Sprintf("cluster%d", i)}}
+		if err := appendPlacementDecisionRecord(&workflow, record); err != nil {
+			t.Fatalf("appendPlacementDecisionRecord() error = %v", err)
+		}
+	}
+
+	records := GetPlacementDecisionRecords(workflow)
+	if len(records) != maxPlacementDecisionRecords || records[0].Clusters[0] != "cluster1" {
+		t.Errorf("GetPlacementDecisionRecords() = %v, want the last %d records", records, maxPlacementDecisionRecords)
+	}
+	record, ok := GetPlacementDecisionRecord(workflow)
+	if !ok || record.Clusters[0] != fmt.Sprintf("cluster%d", maxPlacementDecisionRecords) {
+		t.Errorf("GetPlacementDecisionRecord() = %v, %v, want the last record", record, ok)
+	}
+}
+
+func Test_prepareWorkflowForReschedule(t *testing.T) {
+	type args struct {
+		workflow           argov1alpha1.Workflow
+		managedClusterName string
+	}
+	tests := []struct {
+		name            string
+		args            args
+		want            bool
+		wantAnnotations map[string]string
+	}{
+		{
+			name: "reschedule with last Placement",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMPlacement:             "",
+							AnnotationKeyOCMLastPlacement:         "placement1",
+							AnnotationKeyOCMManagedCluster:        "cluster2",
+							AnnotationKeyOCMExcludedClusters:      "cluster1",
+							AnnotationKeyOCMRemoteDeletedClusters: "cluster2",
+						},
+					},
+				},
+				managedClusterName: "cluster2",
+			},
+			want: true,
+			wantAnnotations: map[string]string{
+				AnnotationKeyOCMPlacement:        "placement1",
+				AnnotationKeyOCMLastPlacement:    "placement1",
+				AnnotationKeyOCMExcludedClusters: "cluster1,cluster2",
+			},
+		},
+		{
+			name: "reschedule a fan-out managed cluster",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMPlacementMode:   PlacementModeFanOut,
+							AnnotationKeyOCMPlacement:       "",
+							AnnotationKeyOCMLastPlacement:   "placement1",
+							AnnotationKeyOCMManagedClusters: "cluster1,cluster2,cluster3",
+							AnnotationKeyOCMQueueAdmitted:   "2023-01-01T00:00:00Z",
+						},
+					},
+				},
+				managedClusterName: "cluster2",
+			},
+			want: true,
+			wantAnnotations: map[string]string{
+				AnnotationKeyOCMPlacementMode:    PlacementModeFanOut,
+				AnnotationKeyOCMPlacement:        "placement1",
+				AnnotationKeyOCMLastPlacement:    "placement1",
+				AnnotationKeyOCMManagedClusters:  "cluster1,cluster3",
+				AnnotationKeyOCMExcludedClusters: "cluster2",
+				AnnotationKeyOCMQueueAdmitted:    "2023-01-01T00:00:00Z",
+			},
+		},
+		{
+			name: "reschedule the last fan-out managed cluster",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMPlacementMode:   PlacementModeFanOut,
+							AnnotationKeyOCMLastPlacement:   "placement1",
+							AnnotationKeyOCMManagedClusters: "cluster1",
+							AnnotationKeyOCMLostClusters:    "cluster1",
+						},
+					},
+				},
+				managedClusterName: "cluster1",
+			},
+			want: true,
+			wantAnnotations: map[string]string{
+				AnnotationKeyOCMPlacementMode:    PlacementModeFanOut,
+				AnnotationKeyOCMPlacement:        "placement1",
+				AnnotationKeyOCMLastPlacement:    "placement1",
+				AnnotationKeyOCMExcludedClusters: "cluster1",
+			},
+		},
+		{
+			name: "no last Placement",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMManagedCluster: "cluster1"},
+					},
+				},
+				managedClusterName: "cluster1",
+			},
+			want:            false,
+			wantAnnotations: map[string]string{AnnotationKeyOCMManagedCluster: "cluster1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prepareWorkflowForReschedule(&tt.args.workflow, tt.args.managedClusterName); got != tt.want {
+				t.Errorf("prepareWorkflowForReschedule() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.args.workflow.Annotations, tt.wantAnnotations) {
+				t.Errorf("prepareWorkflowForReschedule() Annotations = %v, want %v", tt.args.workflow.Annotations, tt.wantAnnotations)
+			}
+		})
+	}
+}
+
+func Test_recordLostCluster(t *testing.T) {
+	workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{
+		AnnotationKeyOCMPlacementMode:   PlacementModeFanOut,
+		AnnotationKeyOCMManagedClusters: "cluster1,cluster2",
+		AnnotationKeyOCMManagedClusterStatuses: `{"cluster1":{"phase":"Succeeded"},"cluster2":{"phase":"Running"},` +
+			`"cluster3":{"phase":"Failed"}}`,
+	}}}
+	if isLostCluster(workflow, "cluster2") {
+		t.Errorf("isLostCluster() = true, want false")
+	}
+
+	if err := recordLostCluster(&workflow, "cluster2", "ManagedCluster cluster2 was deleted"); err != nil {
+		t.Fatalf("recordLostCluster() error = %v", err)
+	}
+	if err := aggregateManagedClusterStatuses(&workflow); err != nil {
+		t.Fatalf("aggregateManagedClusterStatuses() error = %v", err)
+	}
+	if !isLostCluster(workflow, "cluster2") || isLostCluster(workflow, "cluster1") {
+		t.Errorf("recordLostCluster() lost clusters = %v, want cluster2", workflow.Annotations[AnnotationKeyOCMLostClusters])
+	}
+	summaries := getManagedClusterStatuses(workflow)
+	if len(summaries) != 2 || summaries["cluster1"].Phase != argov1alpha1.WorkflowSucceeded ||
+		summaries["cluster2"].Phase != argov1alpha1.WorkflowFailed || summaries["cluster2"].Message != "ManagedCluster cluster2 was deleted" {
+		t.Errorf("recordLostCluster() summaries = %v", summaries)
+	}
+	if workflow.Status.Phase != argov1alpha1.WorkflowFailed {
+		t.Errorf("aggregateManagedClusterStatuses() phase = %v, want %v", workflow.Status.Phase, argov1alpha1.WorkflowFailed)
+	}
+}
+
+func Test_setManagedClusterStatuses(t *testing.T) {
+	outputs := &workflowv1alpha2.WorkflowOutputsSummary{Parameters: map[string]string{"result": strings.Repeat("x", 10*1024)}}
+	summaries := map[string]ManagedClusterWorkflowStatus{}
+	for i := 0; i < 20; i++ {
+		summaries[fmt.Sprintf("cluster%d", i)] = ManagedClusterWorkflowStatus{
+			Phase:   argov1alpha1.WorkflowSucceeded,
+			Message: "done",
+			Outputs: outputs,
+		}
+	}
+
+	workflow := argov1alpha1.Workflow{}
+	if err := setManagedClusterStatuses(&workflow, summaries); err != nil {
+		t.Fatalf("setManagedClusterStatuses() error = %v", err)
+	}
+	if size := len(workflow.Annotations[AnnotationKeyOCMManagedClusterStatuses]); size > MaxManagedClusterStatusesSize {
+		t.Errorf("setManagedClusterStatuses() size = %v, want at most %v", size, MaxManagedClusterStatusesSize)
+	}
+	got := getManagedClusterStatuses(workflow)
+	withOutputs := 0
+	for _, summary := range got {
+		if summary.Phase != argov1alpha1.WorkflowSucceeded || summary.Message != "done" {
+			t.Errorf("setManagedClusterStatuses() summary = %v, want the phase and message kept", summary)
+		}
+		if summary.Outputs != nil {
+			withOutputs++
+		}
+	}
+	if len(got) != 20 || withOutputs == 0 || withOutputs == 20 {
+		t.Errorf("setManagedClusterStatuses() = %v summaries, %v with outputs, want only some outputs left out", len(got), withOutputs)
+	}
+}
+
+func Test_recordRemoteDeletedCluster(t *testing.T) {
+	workflow := argov1alpha1.Workflow{}
+	if isRemoteDeletedCluster(workflow, "cluster1") {
+		t.Errorf("isRemoteDeletedCluster() = true, want false")
+	}
+
+	recordRemoteDeletedCluster(&workflow, "cluster1")
+	recordRemoteDeletedCluster(&workflow, "cluster2")
+	recordRemoteDeletedCluster(&workflow, "cluster1")
+	if got := workflow.Annotations[AnnotationKeyOCMRemoteDeletedClusters]; got != "cluster1,cluster2" {
+		t.Errorf("recordRemoteDeletedCluster() = %v, want cluster1,cluster2", got)
+	}
+	if !isRemoteDeletedCluster(workflow, "cluster2") || isRemoteDeletedCluster(workflow, "cluster3") {
+		t.Errorf("isRemoteDeletedCluster() = %v", workflow.Annotations)
+	}
+}
+
+func Test_getMaxClusterAttempts(t *testing.T) {
+	type args struct {
+		workflow argov1alpha1.Workflow
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{
+			name: "valid max attempts",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMMaxClusterAttempts: "3"},
+					},
+				},
+			},
+			want: 3,
+		},
+		{
+			name: "invalid max attempts",
+			args: args{
+				argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMMaxClusterAttempts: "-1"},
+					},
+				},
+			},
+			want: 1,
+		},
+		{
+			name: "no max attempts",
+			args: args{
+				argov1alpha1.Workflow{},
+			},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getMaxClusterAttempts(tt.args.workflow); got != tt.want {
+				t.Errorf("getMaxClusterAttempts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_recordClusterAttempt(t *testing.T) {
+	workflow := argov1alpha1.Workflow{}
+	finishedAt := v1.NewTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	if err := recordClusterAttempt(&workflow, "cluster1", argov1alpha1.WorkflowStatus{
+		Phase: argov1alpha1.WorkflowFailed, Message: "failed", FinishedAt: finishedAt}); err != nil {
+		t.Fatalf("recordClusterAttempt() error = %v", err)
+	}
+	if err := recordClusterAttempt(&workflow, "cluster2", argov1alpha1.WorkflowStatus{
+		Phase: argov1alpha1.WorkflowError}); err != nil {
+		t.Fatalf("recordClusterAttempt() error = %v", err)
+	}
+
+	got := getClusterAttempts(workflow)
+	if len(got) != 2 {
+		t.Fatalf("getClusterAttempts() = %v, want 2 attempts", got)
+	}
+	if got[0].Cluster != "cluster1" || got[0].Phase != argov1alpha1.WorkflowFailed || got[0].Message != "failed" ||
+		!got[0].FinishedAt.Equal(&finishedAt) {
+		t.Errorf("getClusterAttempts()[0] = %v", got[0])
+	}
+	if got[1].Cluster != "cluster2" || got[1].Phase != argov1alpha1.WorkflowError || got[1].FinishedAt.IsZero() {
+		t.Errorf("getClusterAttempts()[1] = %v", got[1])
+	}
+}
+
+func Test_getRetryCandidates(t *testing.T) {
+	type args struct {
+		workflow            argov1alpha1.Workflow
+		decidedClusterNames []string
+		managedClusterName  string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "another decided cluster",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMExcludedClusters: "cluster1"},
+					},
+				},
+				decidedClusterNames: []string{"cluster1", "cluster2", "cluster3"},
+				managedClusterName:  "cluster2",
+			},
+			want: []string{"cluster3"},
+		},
+		{
+			name: "every other decided cluster excluded",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMExcludedClusters: "cluster1,cluster3"},
+					},
+				},
+				decidedClusterNames: []string{"cluster1", "cluster2", "cluster3"},
+				managedClusterName:  "cluster2",
+			},
+			want: []string{},
+		},
+		{
+			name: "only the failed cluster decided",
+			args: args{
+				workflow:            argov1alpha1.Workflow{},
+				decidedClusterNames: []string{"cluster1"},
+				managedClusterName:  "cluster1",
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getRetryCandidates(tt.args.workflow, tt.args.decidedClusterNames, tt.args.managedClusterName); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getRetryCandidates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_shouldRetryOnAnotherCluster(t *testing.T) {
+	type args struct {
+		workflow argov1alpha1.Workflow
+		status   argov1alpha1.WorkflowStatus
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "failed with attempts left",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMMaxClusterAttempts: "2",
+							AnnotationKeyOCMLastPlacement:      "placement1",
+						},
+					},
+				},
+				status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowError},
+			},
+			want: true,
+		},
+		{
+			name: "failed without attempts left",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMMaxClusterAttempts: "2",
+							AnnotationKeyOCMLastPlacement:      "placement1",
+							AnnotationKeyOCMClusterAttempts:    `[{"cluster":"cluster1","phase":"Failed"}]`,
+						},
+					},
+				},
+				status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowFailed},
+			},
+			want: false,
+		},
+		{
+			name: "failed without Placement",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{AnnotationKeyOCMMaxClusterAttempts: "2"},
+					},
+				},
+				status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowFailed},
+			},
+			want: false,
+		},
+		{
+			name: "succeeded",
+			args: args{
+				workflow: argov1alpha1.Workflow{
+					ObjectMeta: v1.ObjectMeta{
+						Annotations: map[string]string{
+							AnnotationKeyOCMMaxClusterAttempts: "2",
+							AnnotationKeyOCMLastPlacement:      "placement1",
+						},
+					},
+				},
+				status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowSucceeded},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetryOnAnotherCluster(tt.args.workflow, tt.args.status); got != tt.want {
+				t.Errorf("shouldRetryOnAnotherCluster() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getTemplateReferences(t *testing.T) {
+	type args struct {
+		spec argov1alpha1.WorkflowSpec
+	}
+	tests := []struct {
+		name string
+		args args
+		want []templateReference
+	}{
+		{
+			name: "workflowTemplateRef",
+			args: args{
+				argov1alpha1.WorkflowSpec{
+					WorkflowTemplateRef: &argov1alpha1.WorkflowTemplateRef{Name: "template1", ClusterScope: true},
+				},
+			},
+			want: []templateReference{{Name: "template1", ClusterScope: true}},
+		},
+		{
+			name: "steps, DAG tasks and hooks templateRef",
+			args: args{
+				argov1alpha1.WorkflowSpec{
+					Hooks: argov1alpha1.LifecycleHooks{
+						argov1alpha1.ExitLifecycleEvent: {TemplateRef: &argov1alpha1.TemplateRef{Name: "template4"}},
+					},
+					Templates: []argov1alpha1.Template{
+						{
+							Steps: []argov1alpha1.ParallelSteps{
+								{Steps: []argov1alpha1.WorkflowStep{
+									{TemplateRef: &argov1alpha1.TemplateRef{Name: "template1"}},
+									{Template: "local"},
+								}},
+								{Steps: []argov1alpha1.WorkflowStep{
+									{TemplateRef: &argov1alpha1.TemplateRef{Name: "template1"}},
+								}},
+							},
+						},
+						{
+							DAG: &argov1alpha1.DAGTemplate{
+								Tasks: []argov1alpha1.DAGTask{
+									{TemplateRef: &argov1alpha1.TemplateRef{Name: "template2", ClusterScope: true}},
+									{TemplateRef: &argov1alpha1.TemplateRef{Name: "template3"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			want: []templateReference{
+				{Name: "template4"},
+				{Name: "template1"},
+				{Name: "template2", ClusterScope: true},
+				{Name: "template3"},
+			},
+		},
+		{
+			name: "no templateRef",
+			args: args{
+				argov1alpha1.WorkflowSpec{
+					Templates: []argov1alpha1.Template{{Name: "local"}},
+				},
+			},
+			want: []templateReference{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getTemplateReferences(tt.args.spec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getTemplateReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getTemplateReferenceIndexValues(t *testing.T) {
+	spec := argov1alpha1.WorkflowSpec{
+		WorkflowTemplateRef: &argov1alpha1.WorkflowTemplateRef{Name: "shared", ClusterScope: true},
+		Templates: []argov1alpha1.Template{{Name: "main", Steps: []argov1alpha1.ParallelSteps{{Steps: []argov1alpha1.WorkflowStep{
+			{Name: "step", TemplateRef: &argov1alpha1.TemplateRef{Name: "shared", Template: "hello"}},
+		}}}}},
+	}
+	want := []string{"ClusterWorkflowTemplate/shared", "WorkflowTemplate/shared"}
+	if got := getTemplateReferenceIndexValues(spec); !reflect.DeepEqual(got, want) {
+		t.Errorf("getTemplateReferenceIndexValues() = %v, want %v", got, want)
+	}
+}
+
+func Test_prepareWorkflowTemplateForWorkPayload(t *testing.T) {
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "template1",
+			Namespace:       "default",
+			ResourceVersion: "1",
+			UID:             "abcdefghijk",
+			Labels:          map[string]string{"app": "template1"},
+		},
+	}
+
+	got := prepareWorkflowTemplateForWorkPayload(workflowTemplate, "argo")
+	if got.Kind != "WorkflowTemplate" || got.APIVersion != argov1alpha1.SchemeGroupVersion.String() {
+		t.Errorf("prepareWorkflowTemplateForWorkPayload() TypeMeta = %v", got.TypeMeta)
+	}
+	if got.Name != "template1" || got.Namespace != "argo" || len(got.ResourceVersion) > 0 || len(got.UID) > 0 {
+		t.Errorf("prepareWorkflowTemplateForWorkPayload() ObjectMeta = %v", got.ObjectMeta)
+	}
+	if !reflect.DeepEqual(got.Labels, workflowTemplate.Labels) {
+		t.Errorf("prepareWorkflowTemplateForWorkPayload() Labels = %v, want %v", got.Labels, workflowTemplate.Labels)
+	}
+}
+
+func Test_getMostRecentScheduleTime(t *testing.T) {
+	hourly, err := cron.ParseStandard("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekdays, err := cron.ParseStandard("0 9 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	deadline, shortDeadline := int64(3600), int64(600)
+
+	tests := []struct {
+		name              string
+		schedule          cron.Schedule
+		now               time.Time
+		deadline          *int64
+		wantTime          *time.Time
+		wantNext          time.Time
+		wantTooManyMissed bool
+	}{
+		{
+			name:     "not due",
+			schedule: hourly,
+			now:      time.Date(2023, 1, 1, 10, 30, 0, 0, time.UTC),
+			wantTime: nil,
+			wantNext: time.Date(2023, 1, 1, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "due",
+			schedule: hourly,
+			now:      time.Date(2023, 1, 1, 11, 0, 5, 0, time.UTC),
+			wantTime: &[]time.Time{time.Date(2023, 1, 1, 11, 0, 0, 0, time.UTC)}[0],
+			wantNext: time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "missed schedules",
+			schedule: hourly,
+			now:      time.Date(2023, 1, 1, 13, 30, 0, 0, time.UTC),
+			wantTime: &[]time.Time{time.Date(2023, 1, 1, 13, 0, 0, 0, time.UTC)}[0],
+			wantNext: time.Date(2023, 1, 1, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:              "too many missed schedules",
+			schedule:          hourly,
+			now:               time.Date(2023, 1, 10, 13, 30, 0, 0, time.UTC),
+			wantTime:          &[]time.Time{time.Date(2023, 1, 10, 13, 0, 0, 0, time.UTC)}[0],
+			wantNext:          time.Date(2023, 1, 10, 14, 0, 0, 0, time.UTC),
+			wantTooManyMissed: true,
+		},
+		{
+			name:              "too many missed schedules over a weekend",
+			schedule:          weekdays,
+			now:               time.Date(2023, 6, 3, 12, 0, 0, 0, time.UTC),
+			wantTime:          &[]time.Time{time.Date(2023, 6, 2, 9, 0, 0, 0, time.UTC)}[0],
+			wantNext:          time.Date(2023, 6, 5, 9, 0, 0, 0, time.UTC),
+			wantTooManyMissed: true,
+		},
+		{
+			name:     "missed schedules bounded by the starting deadline",
+			schedule: hourly,
+			now:      time.Date(2023, 1, 10, 13, 30, 0, 0, time.UTC),
+			deadline: &deadline,
+			wantTime: &[]time.Time{time.Date(2023, 1, 10, 13, 0, 0, 0, time.UTC)}[0],
+			wantNext: time.Date(2023, 1, 10, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "missed schedules past the starting deadline",
+			schedule: hourly,
+			now:      time.Date(2023, 1, 10, 13, 30, 0, 0, time.UTC),
+			deadline: &shortDeadline,
+			wantTime: nil,
+			wantNext: time.Date(2023, 1, 10, 14, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTime, gotNext, gotTooManyMissed := getMostRecentScheduleTime(tt.schedule, last, tt.now, tt.deadline)
+			if !reflect.DeepEqual(gotTime, tt.wantTime) {
+				t.Errorf("getMostRecentScheduleTime() time = %v, want %v", gotTime, tt.wantTime)
+			}
+			if !gotNext.Equal(tt.wantNext) {
+				t.Errorf("getMostRecentScheduleTime() next = %v, want %v", gotNext, tt.wantNext)
+			}
+			if gotTooManyMissed != tt.wantTooManyMissed {
+				t.Errorf("getMostRecentScheduleTime() too many missed = %v, want %v", gotTooManyMissed, tt.wantTooManyMissed)
+			}
+		})
+	}
+}
+
+func Test_generateCronWorkflowRun(t *testing.T) {
+	cronWorkflow := argov1alpha1.CronWorkflow{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "cron1",
+			Namespace: "default",
+			UID:       "abcdefghijk",
+			Labels:    map[string]string{LabelKeyEnableOCMMulticluster: "true"},
+			Annotations: map[string]string{
+				AnnotationKeyOCMPlacement: "placement1",
+				"other":                   "value",
+			},
+		},
+		Spec: argov1alpha1.CronWorkflowSpec{
+			Schedule:     "0 * * * *",
+			WorkflowSpec: argov1alpha1.WorkflowSpec{Entrypoint: "main"},
+			WorkflowMetadata: &v1.ObjectMeta{
+				Labels: map[string]string{"app": "cron1"},
+			},
+		},
+	}
+	scheduledTime := time.Date(2023, 1, 1, 11, 0, 0, 0, time.UTC)
+
+	got := generateCronWorkflowRun(cronWorkflow, scheduledTime)
+	if got.Name != "cron1-1672570800" || got.Namespace != "default" {
+		t.Errorf("generateCronWorkflowRun() name = %v/%v", got.Namespace, got.Name)
+	}
+	wantLabels := map[string]string{
+		"app":                         "cron1",
+		LabelKeyEnableOCMMulticluster: "true",
+		LabelKeyCronWorkflow:          "cron1",
+	}
+	if !reflect.DeepEqual(got.Labels, wantLabels) {
+		t.Errorf("generateCronWorkflowRun() labels = %v, want %v", got.Labels, wantLabels)
+	}
+	wantAnnotations := map[string]string{
+		AnnotationKeyOCMPlacement:              "placement1",
+		AnnotationKeyCronWorkflowScheduledTime: "2023-01-01T11:00:00Z",
+	}
+	if !reflect.DeepEqual(got.Annotations, wantAnnotations) {
+		t.Errorf("generateCronWorkflowRun() annotations = %v, want %v", got.Annotations, wantAnnotations)
+	}
+	if len(got.OwnerReferences) != 1 || got.OwnerReferences[0].UID != "abcdefghijk" ||
+		got.OwnerReferences[0].Kind != "CronWorkflow" {
+		t.Errorf("generateCronWorkflowRun() owner references = %v", got.OwnerReferences)
+	}
+	if got.Spec.Entrypoint != "main" {
+		t.Errorf("generateCronWorkflowRun() spec = %v", got.Spec)
+	}
+}
+
+func Test_getDependencyReferences(t *testing.T) {
+	spec := argov1alpha1.WorkflowSpec{
+		ServiceAccountName: "runner",
+		ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "registry"}},
+		ArtifactRepositoryRef: &argov1alpha1.ArtifactRepositoryRef{
+			Key: "s3",
+		},
+		Volumes: []corev1.Volume{
+			{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "config1"}}}},
+			{Name: "projected", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{{Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "secret1"}}}}}}},
+		},
+		Templates: []argov1alpha1.Template{
+			{
+				Name:               "main",
+				ServiceAccountName: "default",
+				Container: &corev1.Container{
+					Env: []corev1.EnvVar{
+						{Name: "A", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "config1"}, Key: "a"}}},
+						{Name: "B", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "secret2"}, Key: "b"}}},
+					},
+					EnvFrom: []corev1.EnvFromSource{
+						{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "config2"}}},
+					},
+				},
+				Outputs: argov1alpha1.Outputs{
+					Artifacts: []argov1alpha1.Artifact{{Name: "out", ArtifactLocation: argov1alpha1.ArtifactLocation{
+						S3: &argov1alpha1.S3Artifact{S3Bucket: argov1alpha1.S3Bucket{
+							AccessKeySecret: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "s3"}},
+							SecretKeySecret: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "s3"}},
+						}},
+					}}},
+				},
+			},
+		},
+	}
+
+	want := []dependencyReference{
+		{Kind: dependencyKindServiceAccount, Name: "runner"},
+		{Kind: dependencyKindSecret, Name: "registry"},
+		{Kind: dependencyKindConfigMap, Name: "artifact-repositories"},
+		{Kind: dependencyKindConfigMap, Name: "config1"},
+		{Kind: dependencyKindSecret, Name: "secret1"},
+		{Kind: dependencyKindSecret, Name: "s3"},
+		{Kind: dependencyKindSecret, Name: "secret2"},
+		{Kind: dependencyKindConfigMap, Name: "config2"},
+	}
+	if got := getDependencyReferences(spec); !reflect.DeepEqual(got, want) {
+		t.Errorf("getDependencyReferences() = %v, want %v", got, want)
+	}
+}
+
+func Test_getArtifactRepositorySecretReferences(t *testing.T) {
+	configMap := corev1.ConfigMap{
+		Data: map[string]string{
+			"s3":      "s3:\n  bucket: my-bucket\n  accessKeySecret:\n    name: s3-creds\n    key: accessKey\n",
+			"invalid": "not: [valid",
+		},
+	}
+
+	want := []dependencyReference{{Kind: dependencyKindSecret, Name: "s3-creds"}}
+	if got := getArtifactRepositorySecretReferences(configMap); !reflect.DeepEqual(got, want) {
+		t.Errorf("getArtifactRepositorySecretReferences() = %v, want %v", got, want)
+	}
+}
+
+func Test_getServiceAccountSecretReferences(t *testing.T) {
+	serviceAccount := corev1.ServiceAccount{
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-creds"}, {Name: ""}, {Name: "registry-creds"}},
+	}
+
+	want := []dependencyReference{{Kind: dependencyKindSecret, Name: "registry-creds"}}
+	if got := getServiceAccountSecretReferences(serviceAccount); !reflect.DeepEqual(got, want) {
+		t.Errorf("getServiceAccountSecretReferences() = %v, want %v", got, want)
+	}
+}
+
+func Test_isSecretAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{name: "allowed", labels: map[string]string{LabelKeyOCMAllowPropagation: "true"}, want: true},
+		{name: "not allowed", labels: map[string]string{LabelKeyOCMAllowPropagation: "false"}, want: false},
+		{name: "no label", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "secret1", Labels: tt.labels}}
+			if got := isSecretAllowed(secret); got != tt.want {
+				t.Errorf("isSecretAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_prepareServiceAccountForWorkPayload(t *testing.T) {
+	serviceAccount := corev1.ServiceAccount{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            "runner",
+			Namespace:       "default",
+			ResourceVersion: "1",
+			UID:             "abcdefghijk",
+		},
+		Secrets:          []corev1.ObjectReference{{Name: "runner-token-abcde"}},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+	}
+
+	got := prepareServiceAccountForWorkPayload(serviceAccount, "argo")
+	if got.Kind != "ServiceAccount" || got.APIVersion != "v1" {
+		t.Errorf("prepareServiceAccountForWorkPayload() TypeMeta = %v", got.TypeMeta)
+	}
+	if got.Name != "runner" || got.Namespace != "argo" || len(got.ResourceVersion) > 0 || len(got.UID) > 0 {
+		t.Errorf("prepareServiceAccountForWorkPayload() ObjectMeta = %v", got.ObjectMeta)
+	}
+	if len(got.Secrets) > 0 || len(got.ImagePullSecrets) != 1 {
+		t.Errorf("prepareServiceAccountForWorkPayload() Secrets = %v, ImagePullSecrets = %v", got.Secrets, got.ImagePullSecrets)
+	}
+}
+
+func Test_generateNamespaceManifests(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "workflow1",
+			Namespace:   "default",
+			Annotations: map[string]string{AnnotationKeyOCMManagedClusterNamespace: "team1"},
+		},
+		Spec: argov1alpha1.WorkflowSpec{
+			ServiceAccountName: "runner",
+			Templates:          []argov1alpha1.Template{{Name: "main", ServiceAccountName: "builder"}},
+		},
+	}
+
+	got := generateNamespaceManifests(workflow)
+	if len(got) != 4 {
+		t.Fatalf("generateNamespaceManifests() = %v manifests, want 4", len(got))
+	}
+
+	namespace := got[0].(*corev1.Namespace)
+	if namespace.Name != "team1" || namespace.Labels[LabelKeyManagedBy] != LabelValueManagedBy {
+		t.Errorf("generateNamespaceManifests() Namespace = %v", namespace.ObjectMeta)
+	}
+	role := got[1].(*rbacv1.Role)
+	if role.Namespace != "team1" || len(role.Rules) == 0 {
+		t.Errorf("generateNamespaceManifests() Role = %v", role)
+	}
+	for i, serviceAccountName := range []string{"runner", "builder"} {
+		wantSubjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccountName, Namespace: "team1"}}
+		roleBinding := got[2+i].(*rbacv1.RoleBinding)
+		if roleBinding.Name != executorRoleName+"-"+serviceAccountName || roleBinding.RoleRef.Name != role.Name ||
+			!reflect.DeepEqual(roleBinding.Subjects, wantSubjects) {
+			t.Errorf("generateNamespaceManifests() RoleBinding = %v", roleBinding)
+		}
+	}
+}
+
+func Test_shortenName(t *testing.T) {
+	long := strings.Repeat("a", 60)
+	tests := []struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		{"short", 63, "short"},
+		{long, 60, long},
+		{long + "-b", 60, strings.Repeat("a", 51) + "-" + fmt.Sprintf("%x", sha256.Sum256([]byte(long+"-b")))[0:8]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shortenName(tt.name, tt.maxLength)
+			if got != tt.want || len(got) > tt.maxLength {
+				t.Errorf("shortenName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if shortenName(long+"-b", 60) == shortenName(long+"-c", 60) {
+		t.Errorf("shortenName() expected the hash to tell the names apart")
+	}
+}
+
+func Test_hasWorkPayloadChanged(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "workflow1",
+			Labels:      map[string]string{LabelKeyEnableOCMMulticluster: "true"},
+			Annotations: map[string]string{AnnotationKeyOCMManagedCluster: "cluster1"},
+		},
+		Spec: argov1alpha1.WorkflowSpec{Entrypoint: "main"},
+	}
+
+	tests := []struct {
+		name   string
+		update func(*argov1alpha1.Workflow)
+		want   bool
+	}{
+		{
+			name:   "status only",
+			update: func(w *argov1alpha1.Workflow) { w.Status.Phase = argov1alpha1.WorkflowRunning },
+			want:   false,
+		},
+		{
+			name: "hub only annotation",
+			update: func(w *argov1alpha1.Workflow) {
+				w.Annotations[AnnotationKeyOCMManagedClusterStatuses] = "{}"
+			},
+			want: false,
+		},
+		{
+			name:   "spec",
+			update: func(w *argov1alpha1.Workflow) { w.Spec.Shutdown = argov1alpha1.ShutdownStrategyStop },
+			want:   true,
+		},
+		{
+			name: "action annotation",
+			update: func(w *argov1alpha1.Workflow) {
+				w.Annotations[AnnotationKeyOCMAction] = ActionRetry
+			},
+			want: true,
+		},
+		{
+			name:   "finalizer",
+			update: func(w *argov1alpha1.Workflow) { w.Finalizers = []string{FinalizerCleanupManifestWork} },
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newWorkflow := *workflow.DeepCopy()
+			tt.update(&newWorkflow)
+			if got := hasWorkPayloadChanged(workflow, newWorkflow); got != tt.want {
+				t.Errorf("hasWorkPayloadChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ensureHubOnlyLabel(t *testing.T) {
+	tests := []struct {
+		name           string
+		labels         map[string]string
+		instanceID     string
+		want           bool
+		wantLabel      string
+		wantAnnotation string
+	}{
+		{
+			name:       "not labeled",
+			labels:     map[string]string{LabelKeyEnableOCMMulticluster: "true"},
+			instanceID: DefaultHubControllerInstanceID,
+			want:       true,
+			wantLabel:  DefaultHubControllerInstanceID,
+		},
+		{
+			name:           "labeled with another instance ID",
+			labels:         map[string]string{LabelKeyControllerInstanceID: "custom"},
+			instanceID:     DefaultHubControllerInstanceID,
+			want:           true,
+			wantLabel:      DefaultHubControllerInstanceID,
+			wantAnnotation: "custom",
+		},
+		{
+			name:       "already labeled",
+			labels:     map[string]string{LabelKeyControllerInstanceID: DefaultHubControllerInstanceID},
+			instanceID: DefaultHubControllerInstanceID,
+			want:       false,
+			wantLabel:  DefaultHubControllerInstanceID,
+		},
+		{
+			name:       "no instance ID",
+			labels:     nil,
+			instanceID: "",
+			want:       false,
+			wantLabel:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Labels: tt.labels}}
+			if got := ensureHubOnlyLabel(&workflow, tt.instanceID); got != tt.want {
+				t.Errorf("ensureHubOnlyLabel() = %v, want %v", got, tt.want)
+			}
+			if got := workflow.Labels[LabelKeyControllerInstanceID]; got != tt.wantLabel {
+				t.Errorf("ensureHubOnlyLabel() label = %v, want %v", got, tt.wantLabel)
+			}
+			if got := workflow.Annotations[AnnotationKeyOCMControllerInstanceID]; got != tt.wantAnnotation {
+				t.Errorf("ensureHubOnlyLabel() annotation = %v, want %v", got, tt.wantAnnotation)
+			}
+		})
+	}
+}
+
+func Test_setHubOnlyCondition(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{Labels: map[string]string{LabelKeyControllerInstanceID: DefaultHubControllerInstanceID}},
+		Status:     argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowRunning},
+	}
+
+	setHubOnlyCondition(&workflow)
+	setHubOnlyCondition(&workflow)
+	if len(workflow.Status.Conditions) != 1 || workflow.Status.Conditions[0].Type != ConditionTypeHubOnly ||
+		workflow.Status.Conditions[0].Status != v1.ConditionTrue {
+		t.Errorf("setHubOnlyCondition() conditions = %v", workflow.Status.Conditions)
+	}
+
+	unlabeled := argov1alpha1.Workflow{}
+	setHubOnlyCondition(&unlabeled)
+	if len(unlabeled.Status.Conditions) > 0 {
+		t.Errorf("setHubOnlyCondition() conditions = %v, want none", unlabeled.Status.Conditions)
+	}
+}
+
+func Test_isStaleWorkflowStatusResult(t *testing.T) {
+	accepted := map[string]AcceptedStatusResult{"cluster1": {Sequence: 5, Generation: 10, WorkflowUID: "remote"}}
+	tests := []struct {
+		name     string
+		cluster  string
+		spec     workflowv1alpha2.WorkflowStatusResultSpec
+		accepted map[string]AcceptedStatusResult
+		want     bool
+	}{
+		{
+			name: "never accepted",
+			spec: workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 1, WorkflowUID: "remote", ObservedGeneration: 1},
+			want: false,
+		},
+		{
+			name:     "accepted from another managed cluster",
+			cluster:  "cluster2",
+			spec:     workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 1, WorkflowUID: "other", ObservedGeneration: 1},
+			accepted: accepted,
+			want:     false,
+		},
+		{
+			name:     "newer sequence and generation",
+			spec:     workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 6, WorkflowUID: "remote", ObservedGeneration: 11},
+			accepted: accepted,
+			want:     false,
+		},
+		{
+			name:     "same sequence",
+			spec:     workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 5, WorkflowUID: "remote", ObservedGeneration: 10},
+			accepted: accepted,
+			want:     false,
+		},
+		{
+			name:     "older sequence",
+			spec:     workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 4, WorkflowUID: "remote", ObservedGeneration: 11},
+			accepted: accepted,
+			want:     true,
+		},
+		{
+			name:     "older generation of the same Workflow",
+			spec:     workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 6, WorkflowUID: "remote", ObservedGeneration: 9},
+			accepted: accepted,
+			want:     true,
+		},
+		{
+			name:     "recreated Workflow",
+			spec:     workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 6, WorkflowUID: "recreated", ObservedGeneration: 1},
+			accepted: accepted,
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := tt.cluster
+			if len(cluster) == 0 {
+				cluster = "cluster1"
+			}
+			workflow := argov1alpha1.Workflow{}
+			setAcceptedStatusResults(&workflow, tt.accepted)
+			result := workflowv1alpha2.WorkflowStatusResult{ObjectMeta: v1.ObjectMeta{Namespace: cluster}, Spec: tt.spec}
+			if _, got := isStaleWorkflowStatusResult(workflow, result); got != tt.want {
+				t.Errorf("isStaleWorkflowStatusResult() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isWorkflowStatusResultOwner(t *testing.T) {
+	workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "hello", UID: "hub"}}
+	tests := []struct {
+		name string
+		ref  workflowv1alpha2.HubWorkflowReference
+		want bool
+	}{
+		{
+			name: "matching UID",
+			ref:  workflowv1alpha2.HubWorkflowReference{Namespace: "default", Name: "hello", UID: "hub"},
+			want: true,
+		},
+		{
+			name: "no UID",
+			ref:  workflowv1alpha2.HubWorkflowReference{Namespace: "default", Name: "hello"},
+			want: true,
+		},
+		{
+			name: "recreated hub Workflow",
+			ref:  workflowv1alpha2.HubWorkflowReference{Namespace: "default", Name: "hello", UID: "deleted"},
+			want: false,
+		},
+		{
+			name: "different name",
+			ref:  workflowv1alpha2.HubWorkflowReference{Namespace: "default", Name: "world", UID: "hub"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := workflowv1alpha2.WorkflowStatusResult{
+				Spec: workflowv1alpha2.WorkflowStatusResultSpec{HubWorkflowRef: tt.ref},
+			}
+			if got := isWorkflowStatusResultOwner(workflow, result); got != tt.want {
+				t.Errorf("isWorkflowStatusResultOwner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_recordAcceptedStatusResult(t *testing.T) {
+	workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{AnnotationKeyOCMLastPlacement: "placement1"}}}
+	for _, cluster := range []string{"cluster1", "cluster2"} {
+		recordAcceptedStatusResult(&workflow, workflowv1alpha2.WorkflowStatusResult{
+			ObjectMeta: v1.ObjectMeta{Namespace: cluster},
+			Spec:       workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 3, WorkflowUID: "remote", ObservedGeneration: 7},
+		})
+	}
+	want := map[string]AcceptedStatusResult{
+		"cluster1": {Sequence: 3, Generation: 7, WorkflowUID: "remote"},
+		"cluster2": {Sequence: 3, Generation: 7, WorkflowUID: "remote"},
+	}
+	if got := getAcceptedStatusResults(workflow); !reflect.DeepEqual(got, want) {
+		t.Errorf("recordAcceptedStatusResult() = %v, want %v", got, want)
+	}
+
+	prepareWorkflowForReschedule(&workflow, "cluster1")
+	if got := getAcceptedStatusResults(workflow); !reflect.DeepEqual(got, map[string]AcceptedStatusResult{"cluster2": want["cluster2"]}) {
+		t.Errorf("prepareWorkflowForReschedule() accepted results = %v", got)
+	}
+}
+
+func Test_isStaleStatusFeedback(t *testing.T) {
+	feedbackWork := func(cluster string, generation int64) workv1.ManifestWork {
+		return workv1.ManifestWork{ObjectMeta: v1.ObjectMeta{Namespace: cluster, Generation: generation}}
+	}
+	workflow := argov1alpha1.Workflow{}
+	if isStaleStatusFeedback(workflow, feedbackWork("cluster1", 1)) {
+		t.Errorf("isStaleStatusFeedback() = true without an accepted status")
+	}
+
+	recordAcceptedStatusFeedback(&workflow, feedbackWork("cluster1", 2))
+	if !isStaleStatusFeedback(workflow, feedbackWork("cluster1", 1)) {
+		t.Errorf("isStaleStatusFeedback() = false for the feedback of an older ManifestWork generation")
+	}
+	if isStaleStatusFeedback(workflow, feedbackWork("cluster1", 2)) || isStaleStatusFeedback(workflow, feedbackWork("cluster2", 1)) {
+		t.Errorf("isStaleStatusFeedback() = true for the feedback of the same generation or another cluster")
+	}
+
+	recordAcceptedStatusResult(&workflow, workflowv1alpha2.WorkflowStatusResult{
+		ObjectMeta: v1.ObjectMeta{Namespace: "cluster1"},
+		Spec:       workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 1},
+	})
+	if !isStaleStatusFeedback(workflow, feedbackWork("cluster1", 3)) {
+		t.Errorf("isStaleStatusFeedback() = false after a WorkflowStatusResult was accepted")
+	}
+}
+
+func Test_acceptWorkflowStatusResult(t *testing.T) {
+	result := workflowv1alpha2.WorkflowStatusResult{
+		Spec: workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 3, WorkflowUID: "remote", ObservedGeneration: 7},
+	}
+	setWorkflowStatusResultCondition(&result, v1.ConditionFalse, workflowv1alpha2.ReasonStale, "stale")
+
+	acceptWorkflowStatusResult(&result)
+	if result.Status.AcceptedSequence != 3 || result.Status.AcceptedGeneration != 7 || result.Status.AcceptedWorkflowUID != "remote" {
+		t.Errorf("acceptWorkflowStatusResult() status = %v", result.Status)
+	}
+	if len(result.Status.Conditions) != 1 || result.Status.Conditions[0].Status != v1.ConditionTrue ||
+		result.Status.Conditions[0].Reason != workflowv1alpha2.ReasonSynced {
+		t.Errorf("acceptWorkflowStatusResult() conditions = %v", result.Status.Conditions)
+	}
+}
+
+func generateNodes(count int, message string) argov1alpha1.Nodes {
+	nodes := argov1alpha1.Nodes{}
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("hello-%d", i)
+		nodes[id] = argov1alpha1.NodeStatus{ID: id, Name: id, Phase: argov1alpha1.NodeSucceeded, Message: message}
+	}
+	return nodes
+}
+
+func Test_CompressNodes(t *testing.T) {
+	nodes := generateNodes(3, "done")
+	compressedNodes, err := CompressNodes(nodes)
+	if err != nil {
+		t.Fatalf("CompressNodes() error = %v", err)
+	}
+
+	got, err := DecompressNodes(compressedNodes)
+	if err != nil {
+		t.Fatalf("DecompressNodes() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, nodes) {
+		t.Errorf("DecompressNodes() = %v, want %v", got, nodes)
+	}
+
+	if _, err := DecompressNodes("not compressed"); err == nil {
+		t.Errorf("DecompressNodes() expected an error")
+	}
+}
+
+func Test_CompressNodeStatusIfNeeded(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes argov1alpha1.Nodes
+		want  bool
+	}{
+		{
+			name:  "small node status",
+			nodes: generateNodes(10, "done"),
+			want:  false,
+		},
+		{
+			name:  "large node status",
+			nodes: generateNodes(2000, strings.Repeat("done ", 200)),
+			want:  true,
+		},
+		{
+			name:  "no nodes",
+			nodes: nil,
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := argov1alpha1.WorkflowStatus{Nodes: tt.nodes}
+			got, err := CompressNodeStatusIfNeeded(&status)
+			if err != nil {
+				t.Fatalf("CompressNodeStatusIfNeeded() error = %v", err)
+			}
+			if got != tt.want || (len(status.CompressedNodes) > 0) != tt.want {
+				t.Errorf("CompressNodeStatusIfNeeded() = %v, want %v", got, tt.want)
+			}
+			if got && len(status.Nodes) > 0 {
+				t.Errorf("CompressNodeStatusIfNeeded() nodes = %v, want none", len(status.Nodes))
+			}
+		})
+	}
+}
+
+func Test_decompressNodeStatusIfFits(t *testing.T) {
+	small := generateNodes(10, "done")
+	compressedSmall, _ := CompressNodes(small)
+	status := argov1alpha1.WorkflowStatus{CompressedNodes: compressedSmall}
+	if err := decompressNodeStatusIfFits(&status); err != nil {
+		t.Fatalf("decompressNodeStatusIfFits() error = %v", err)
+	}
+	if !reflect.DeepEqual(status.Nodes, small) || len(status.CompressedNodes) > 0 {
+		t.Errorf("decompressNodeStatusIfFits() = %v, want the decompressed nodes", status)
+	}
+
+	compressedLarge, _ := CompressNodes(generateNodes(2000, strings.Repeat("done ", 200)))
+	status = argov1alpha1.WorkflowStatus{CompressedNodes: compressedLarge}
+	if err := decompressNodeStatusIfFits(&status); err != nil {
+		t.Fatalf("decompressNodeStatusIfFits() error = %v", err)
+	}
+	if len(status.Nodes) > 0 || status.CompressedNodes != compressedLarge {
+		t.Errorf("decompressNodeStatusIfFits() expected the nodes to stay compressed")
+	}
+}
+
+func Test_setNodeStatusOffloadedCondition(t *testing.T) {
+	workflow := argov1alpha1.Workflow{Status: argov1alpha1.WorkflowStatus{Nodes: generateNodes(10, "done")}}
+	result := workflowv1alpha2.WorkflowStatusResult{
+		ObjectMeta: v1.ObjectMeta{Namespace: "cluster1", Name: "default-hello-world"},
+		Spec:       workflowv1alpha2.WorkflowStatusResultSpec{Sequence: 7, NodeStatusChunks: 3},
+	}
+	setNodeStatusOffloadedCondition(&workflow, result)
+	if len(workflow.Status.Nodes) > 0 || len(workflow.Status.CompressedNodes) > 0 {
+		t.Errorf("setNodeStatusOffloadedCondition() expected the node status to be cleared")
+	}
+	want := "the node status is too large for the hub Workflow, it is kept compressed in the WorkflowStatusResultChunks " +
+		"cluster1/default-hello-world-0 to default-hello-world-2 of sequence 7"
+	if len(workflow.Status.Conditions) != 1 || workflow.Status.Conditions[0].Type != ConditionTypeNodeStatusOffloaded ||
+		workflow.Status.Conditions[0].Message != want {
+		t.Errorf("setNodeStatusOffloadedCondition() = %v, want the %v condition", workflow.Status.Conditions, want)
+	}
+}
+
+func Test_SummarizeWorkflowOutputs(t *testing.T) {
+	exitCode := "1"
+	nodes := argov1alpha1.Nodes{
+		"hello": argov1alpha1.NodeStatus{ID: "hello", Outputs: &argov1alpha1.Outputs{
+			Parameters: []argov1alpha1.Parameter{{Name: "result", Value: argov1alpha1.AnyStringPtr("ok")}, {Name: "empty"}},
+			ExitCode:   &exitCode,
+		}},
+		"hello-123": argov1alpha1.NodeStatus{ID: "hello-123", Outputs: &argov1alpha1.Outputs{
+			Parameters: []argov1alpha1.Parameter{{Name: "step", Value: argov1alpha1.AnyStringPtr("1")}},
+		}},
+	}
+	compressedNodes, _ := CompressNodes(nodes)
+	outputs := &argov1alpha1.Outputs{Parameters: []argov1alpha1.Parameter{{Name: "global", Value: argov1alpha1.AnyStringPtr("value")}}}
+
+	tests := []struct {
+		name   string
+		status argov1alpha1.WorkflowStatus
+		want   *workflowv1alpha2.WorkflowOutputsSummary
+	}{
+		{
+			name:   "no outputs",
+			status: argov1alpha1.WorkflowStatus{Nodes: argov1alpha1.Nodes{"hello": argov1alpha1.NodeStatus{ID: "hello"}}},
+		},
+		{
+			name:   "global and entrypoint outputs",
+			status: argov1alpha1.WorkflowStatus{Nodes: nodes, Outputs: outputs},
+			want: &workflowv1alpha2.WorkflowOutputsSummary{
+				Parameters:           map[string]string{"global": "value"},
+				EntrypointParameters: map[string]string{"result": "ok"},
+				ExitCode:             "1",
+			},
+		},
+		{
+			name:   "compressed nodes",
+			status: argov1alpha1.WorkflowStatus{CompressedNodes: compressedNodes},
+			want: &workflowv1alpha2.WorkflowOutputsSummary{
+				EntrypointParameters: map[string]string{"result": "ok"},
+				ExitCode:             "1",
+			},
+		},
+		{
+			name:   "global outputs without the nodes",
+			status: argov1alpha1.WorkflowStatus{Outputs: outputs},
+			want:   &workflowv1alpha2.WorkflowOutputsSummary{Parameters: map[string]string{"global": "value"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SummarizeWorkflowOutputs("hello", tt.status); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SummarizeWorkflowOutputs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getWorkflowOutputsSummary(t *testing.T) {
+	synced := &workflowv1alpha2.WorkflowOutputsSummary{ExitCode: "0"}
+	outputs := &argov1alpha1.Outputs{Parameters: []argov1alpha1.Parameter{{Name: "global", Value: argov1alpha1.AnyStringPtr("value")}}}
+	large := &argov1alpha1.Outputs{Parameters: []argov1alpha1.Parameter{
+		{Name: "global", Value: argov1alpha1.AnyStringPtr(strings.Repeat("a", MaxOutputsSummarySize))}}}
+
+	tests := []struct {
+		name   string
+		result workflowv1alpha2.WorkflowStatusResult
+		want   *workflowv1alpha2.WorkflowOutputsSummary
+	}{
+		{
+			name: "synced summary",
+			result: workflowv1alpha2.WorkflowStatusResult{
+				Spec:           workflowv1alpha2.WorkflowStatusResultSpec{Outputs: synced},
+				WorkflowStatus: argov1alpha1.WorkflowStatus{Outputs: outputs},
+			},
+			want: synced,
+		},
+		{
+			name:   "summary read from the status",
+			result: workflowv1alpha2.WorkflowStatusResult{WorkflowStatus: argov1alpha1.WorkflowStatus{Outputs: outputs}},
+			want:   &workflowv1alpha2.WorkflowOutputsSummary{Parameters: map[string]string{"global": "value"}},
+		},
+		{
+			name:   "summary too large",
+			result: workflowv1alpha2.WorkflowStatusResult{WorkflowStatus: argov1alpha1.WorkflowStatus{Outputs: large}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getWorkflowOutputsSummary(tt.result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getWorkflowOutputsSummary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isEmptyPatch(t *testing.T) {
+	original := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{Name: "hello", ResourceVersion: "1"},
+		Status:     argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowRunning, Nodes: generateNodes(2, "running")},
+	}
+
+	unchanged := original.DeepCopy()
+	if empty, err := isEmptyPatch(client.MergeFrom(&original), unchanged); err != nil || !empty {
+		t.Errorf("isEmptyPatch() = %v, %v, want true", empty, err)
+	}
+
+	changed := original.DeepCopy()
+	changed.Status.Phase = argov1alpha1.WorkflowSucceeded
+	if empty, err := isEmptyPatch(client.MergeFrom(&original), changed); err != nil || empty {
+		t.Errorf("isEmptyPatch() = %v, %v, want false", empty, err)
+	}
+}
+
+func Test_shouldReemitEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   corev1.Event
+		want bool
+	}{
+		{
+			name: "never re-emitted",
+			ev:   corev1.Event{Count: 1},
+			want: true,
+		},
+		{
+			name: "already re-emitted",
+			ev: corev1.Event{
+				ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{AnnotationKeyOCMReemittedCount: "2"}},
+				Count:      2,
+			},
+			want: false,
+		},
+		{
+			name: "occurred again",
+			ev: corev1.Event{
+				ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{AnnotationKeyOCMReemittedCount: "2"}},
+				Count:      3,
+			},
+			want: true,
+		},
+		{
+			name: "event series occurred again",
+			ev: corev1.Event{
+				ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{AnnotationKeyOCMReemittedCount: "1"}},
+				Series:     &corev1.EventSeries{Count: 2},
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldReemitEvent(tt.ev); got != tt.want {
+				t.Errorf("shouldReemitEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_classifyQueueWorkflows(t *testing.T) {
+	now := v1.Now()
+	workflows := []argov1alpha1.Workflow{
+		{ObjectMeta: v1.ObjectMeta{Name: "unplaced", Annotations: map[string]string{AnnotationKeyOCMQueue: "gpu"}}},
+		{ObjectMeta: v1.ObjectMeta{Name: "queued", Annotations: map[string]string{
+			AnnotationKeyOCMQueue: "gpu", AnnotationKeyOCMManagedCluster: "cluster1"}}},
+		{ObjectMeta: v1.ObjectMeta{Name: "running", Annotations: map[string]string{
+			AnnotationKeyOCMQueue: "gpu", AnnotationKeyOCMQueueAdmitted: "2023-01-01T00:00:00Z", AnnotationKeyOCMManagedCluster: "cluster1"}}},
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "completed", Annotations: map[string]string{
+				AnnotationKeyOCMQueue: "gpu", AnnotationKeyOCMQueueAdmitted: "2023-01-01T00:00:00Z", AnnotationKeyOCMManagedCluster: "cluster1"}},
+			Status: argov1alpha1.WorkflowStatus{Phase: argov1alpha1.WorkflowSucceeded},
+		},
+		{ObjectMeta: v1.ObjectMeta{Name: "deleted", DeletionTimestamp: &now, Annotations: map[string]string{
+			AnnotationKeyOCMQueue: "gpu", AnnotationKeyOCMManagedCluster: "cluster1"}}},
+	}
+	running, queued := classifyQueueWorkflows(workflows)
+	if len(running) != 1 || running[0].Name != "running" {
+		t.Errorf("classifyQueueWorkflows() running = %v", running)
+	}
+	if len(queued) != 1 || queued[0].Name != "queued" {
+		t.Errorf("classifyQueueWorkflows() queued = %v", queued)
+	}
+}
+
+func Test_getNamespaceQueueName(t *testing.T) {
+	newQueue := func(name string, namespaces ...string) workflowv1alpha2.WorkflowQueue {
+		return workflowv1alpha2.WorkflowQueue{
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Spec:       workflowv1alpha2.WorkflowQueueSpec{Namespaces: namespaces},
+		}
+	}
+	queues := []workflowv1alpha2.WorkflowQueue{newQueue("gpu", "team-a", "team-b"), newQueue("cpu", "team-b"), newQueue("batch")}
+	tests := []struct {
+		name      string
+		namespace string
+		want      string
+	}{
+		{"bound namespace", "team-a", "gpu"},
+		{"namespace bound to several queues", "team-b", "cpu"},
+		{"unbound namespace", "team-c", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getNamespaceQueueName(queues, tt.namespace); got != tt.want {
+				t.Errorf("getNamespaceQueueName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getQueuePriority(t *testing.T) {
+	spec := workflowv1alpha2.WorkflowQueueSpec{
+		PriorityClasses: []workflowv1alpha2.WorkflowQueuePriorityClass{
+			{Name: "high", Value: 100},
+			{Name: "low", Value: 10},
+			{Name: "urgent", Value: 1000, Namespaces: []string{"ops"}},
+		},
+		DefaultPriorityClass: "low",
+	}
+	tests := []struct {
+		name          string
+		namespace     string
+		priorityClass string
+		want          int32
+	}{
+		{"priority class", "default", "high", 100},
+		{"default priority class", "default", "", 10},
+		{"unknown priority class", "default", "critical", 10},
+		{"priority class of the namespace", "ops", "urgent", 1000},
+		{"priority class of another namespace", "default", "urgent", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow := argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{Namespace: tt.namespace, Annotations: map[string]string{}}}
+			if len(tt.priorityClass) > 0 {
+				workflow.Annotations[AnnotationKeyOCMPriorityClass] = tt.priorityClass
+			}
+			if got := getQueuePriority(spec, workflow); got != tt.want {
+				t.Errorf("getQueuePriority() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectAdmittedWorkflows(t *testing.T) {
+	newWorkflow := func(namespace, name string, created int, cluster, priorityClass string) argov1alpha1.Workflow {
+		return argov1alpha1.Workflow{ObjectMeta: v1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			CreationTimestamp: v1.Date(2023, 1, 1, 0, created, 0, 0, time.UTC),
+			Annotations: map[string]string{
+				AnnotationKeyOCMManagedCluster: cluster,
+				AnnotationKeyOCMPriorityClass:  priorityClass,
+			},
+		}}
+	}
+	priorityClasses := []workflowv1alpha2.WorkflowQueuePriorityClass{{Name: "high", Value: 100}}
+
+	tests := []struct {
+		name    string
+		spec    workflowv1alpha2.WorkflowQueueSpec
+		running []argov1alpha1.Workflow
+		queued  []argov1alpha1.Workflow
+		want    []string
+	}{
+		{
+			name:   "unlimited",
+			queued: []argov1alpha1.Workflow{newWorkflow("team1", "wf2", 2, "cluster1", ""), newWorkflow("team1", "wf1", 1, "cluster1", "")},
+			want:   []string{"wf1", "wf2"},
+		},
+		{
+			name:    "global limit in FIFO order",
+			spec:    workflowv1alpha2.WorkflowQueueSpec{MaxRunning: 2},
+			running: []argov1alpha1.Workflow{newWorkflow("team1", "wf0", 0, "cluster1", "")},
+			queued:  []argov1alpha1.Workflow{newWorkflow("team1", "wf2", 2, "cluster1", ""), newWorkflow("team1", "wf1", 1, "cluster1", "")},
+			want:    []string{"wf1"},
+		},
+		{
+			name:   "priority before creation",
+			spec:   workflowv1alpha2.WorkflowQueueSpec{MaxRunning: 1, PriorityClasses: priorityClasses},
+			queued: []argov1alpha1.Workflow{newWorkflow("team1", "wf1", 1, "cluster1", ""), newWorkflow("team1", "wf2", 2, "cluster1", "high")},
+			want:   []string{"wf2"},
+		},
+		{
+			name:    "cluster limit does not hold back other clusters",
+			spec:    workflowv1alpha2.WorkflowQueueSpec{MaxRunningPerCluster: 1},
+			running: []argov1alpha1.Workflow{newWorkflow("team1", "wf0", 0, "cluster1", "")},
+			queued:  []argov1alpha1.Workflow{newWorkflow("team1", "wf1", 1, "cluster1", ""), newWorkflow("team1", "wf2", 2, "cluster2", "")},
+			want:    []string{"wf2"},
+		},
+		{
+			name:    "namespace limit",
+			spec:    workflowv1alpha2.WorkflowQueueSpec{MaxRunningPerNamespace: 1},
+			running: []argov1alpha1.Workflow{newWorkflow("team1", "wf0", 0, "cluster1", "")},
+			queued:  []argov1alpha1.Workflow{newWorkflow("team1", "wf1", 1, "cluster1", ""), newWorkflow("team2", "wf2", 2, "cluster1", "")},
+			want:    []string{"wf2"},
+		},
+		{
+			name:    "fair share",
+			spec:    workflowv1alpha2.WorkflowQueueSpec{MaxRunning: 3, Ordering: workflowv1alpha2.WorkflowQueueOrderingFairShare},
+			running: []argov1alpha1.Workflow{newWorkflow("team1", "wf0", 0, "cluster1", "")},
+			queued: []argov1alpha1.Workflow{
+				newWorkflow("team1", "wf1", 1, "cluster1", ""),
+				newWorkflow("team1", "wf2", 2, "cluster1", ""),
+				newWorkflow("team2", "wf3", 3, "cluster1", ""),
+				newWorkflow("team2", "wf4", 4, "cluster1", ""),
+			},
+			want: []string{"wf3", "wf1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, workflow := range selectAdmittedWorkflows(tt.spec, tt.running, tt.queued) {
+				got = append(got, workflow.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectAdmittedWorkflows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_admitQueuedWorkflow(t *testing.T) {
+	workflow := argov1alpha1.Workflow{
+		ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{AnnotationKeyOCMQueue: "gpu", AnnotationKeyOCMManagedCluster: "cluster1"}},
+	}
+	setQueuedStatus(&workflow, "waiting for capacity in WorkflowQueue gpu")
+	if !isQueuedWorkflow(workflow) || workflow.Status.Phase != argov1alpha1.WorkflowPending ||
+		len(workflow.Status.Conditions) != 1 || workflow.Status.Conditions[0].Type != ConditionTypeQueued {
+		t.Errorf("setQueuedStatus() = %v", workflow.Status)
+	}
+
+	admitQueuedWorkflow(&workflow, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	if isQueuedWorkflow(workflow) || workflow.Annotations[AnnotationKeyOCMQueueAdmitted] != "2023-01-01T00:00:00Z" ||
+		len(workflow.Status.Conditions) != 0 {
+		t.Errorf("admitQueuedWorkflow() = %v, %v", workflow.Annotations, workflow.Status)
+	}
+
+	workflow.Annotations[AnnotationKeyOCMLastPlacement] = "placement1"
+	if !prepareWorkflowForReschedule(&workflow, "cluster1") || !isQueuedWorkflow(workflow) {
+		t.Errorf("prepareWorkflowForReschedule() expected the Workflow to be queued again, got %v", workflow.Annotations)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+const (
+	// Workflow annotation that dictates what happens to the Workflow when its managed cluster becomes unavailable.
+	AnnotationKeyOCMClusterUnavailablePolicy = "workflows.argoproj.io/ocm-cluster-unavailable-policy"
+	// ClusterUnavailablePolicyFail marks the Workflow as Failed, this is the default.
+	ClusterUnavailablePolicyFail = "fail"
+	// ClusterUnavailablePolicyReschedule evaluates the Placement again and moves the Workflow to another managed cluster.
+	ClusterUnavailablePolicyReschedule = "reschedule"
+	// Workflow annotation that lists the comma separated managed clusters a fan-out Workflow failed on because they were lost.
+	AnnotationKeyOCMLostClusters = "workflows.argoproj.io/ocm-lost-clusters"
+	// IndexKeyWorkflowManagedCluster indexes the OCM enabled Workflows by their managed cluster(s).
+	IndexKeyWorkflowManagedCluster = "workflowManagedCluster"
+)
+
+// WorkflowClusterReconciler reconciles a ManagedCluster object
+type WorkflowClusterReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// UnavailableGracePeriod is how long a ManagedCluster can be unavailable before its Workflows are considered stranded.
+	UnavailableGracePeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=work.open-cluster-management.io,resources=manifestworks,verbs=get;list;watch;create;update;patch;delete
+
+// ManagedClusterPredicateFunctions only reconciles when the ManagedCluster availability might have changed
+var ManagedClusterPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		newCluster := e.ObjectNew.(*clusterv1.ManagedCluster)
+		oldCluster := e.ObjectOld.(*clusterv1.ManagedCluster)
+		return isManagedClusterAvailable(*newCluster) != isManagedClusterAvailable(*oldCluster)
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return true
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return true
+	},
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkflowClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &argov1alpha1.Workflow{}, IndexKeyWorkflowManagedCluster,
+		func(obj client.Object) []string {
+			workflow := obj.(*argov1alpha1.Workflow)
+			if !containsValidOCMLabel(*workflow) {
+				return nil
+			}
+			return getManagedClusterNames(*workflow)
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&clusterv1.ManagedCluster{}, builder.WithPredicates(ManagedClusterPredicateFunctions)).
+		Complete(r)
+}
+
+// Reconcile finds the Workflows stranded on an unavailable ManagedCluster then either marks them as Failed
+// or reschedules them to another managed cluster, depending on the Workflow's cluster unavailable policy.
+// A fan-out Workflow only fails or is rescheduled on the unavailable ManagedCluster, the other ones keep running.
+func (r *WorkflowClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("reconciling ManagedCluster for stranded Workflows...")
+	defer log.Info("done reconciling ManagedCluster for stranded Workflows")
+
+	unavailableMessage := "ManagedCluster " + req.Name + " was deleted"
+	var managedCluster clusterv1.ManagedCluster
+	err := r.Get(ctx, req.NamespacedName, &managedCluster)
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		log.Error(err, "unable to fetch ManagedCluster")
+		return ctrl.Result{}, err
+	default:
+		if isManagedClusterAvailable(managedCluster) {
+			return ctrl.Result{}, nil
+		}
+
+		unavailableMessage = "ManagedCluster " + req.Name + " became unavailable"
+		condition := meta.FindStatusCondition(managedCluster.Status.Conditions, clusterv1.ManagedClusterConditionAvailable)
+		if condition != nil {
+			if remaining := r.UnavailableGracePeriod - time.Since(condition.LastTransitionTime.Time); remaining > 0 {
+				return ctrl.Result{RequeueAfter: remaining}, nil
+			}
+			if len(condition.Message) > 0 {
+				unavailableMessage += ": " + condition.Message
+			}
+		}
+	}
+
+	workflows := &argov1alpha1.WorkflowList{}
+	if err := r.List(ctx, workflows, client.MatchingFields{IndexKeyWorkflowManagedCluster: req.Name}); err != nil {
+		log.Error(err, "unable to list Workflows")
+		return ctrl.Result{}, err
+	}
+
+	for i := range workflows.Items {
+		workflow := workflows.Items[i]
+		if workflow.DeletionTimestamp != nil || workflow.Status.Fulfilled() || isLostCluster(workflow, req.Name) {
+			continue
+		}
+
+		message := unavailableMessage
+		if workflow.Annotations[AnnotationKeyOCMClusterUnavailablePolicy] == ClusterUnavailablePolicyReschedule {
+			if prepareWorkflowForReschedule(&workflow, req.Name) {
+				log.Info("rescheduling Workflow " + workflow.Namespace + "/" + workflow.Name)
+				if err := recordClusterAttempt(&workflow, req.Name, argov1alpha1.WorkflowStatus{
+					Phase:     argov1alpha1.WorkflowError,
+					Message:   message,
+					StartedAt: workflow.Status.StartedAt,
+				}); err != nil {
+					log.Error(err, "unable to record the ManagedCluster attempt")
+					return ctrl.Result{}, err
+				}
+
+				if len(getManagedClusterNames(workflow)) > 0 {
+					if err := aggregateManagedClusterStatuses(&workflow); err != nil {
+						log.Error(err, "unable to aggregate fan-out Workflow status")
+						return ctrl.Result{}, err
+					}
+				} else {
+					workflow.Status = argov1alpha1.WorkflowStatus{
+						Phase:   argov1alpha1.WorkflowPending,
+						Message: message + ", pending Workflow rescheduling to another ManagedCluster",
+					}
+				}
+				setHubOnlyCondition(&workflow)
+				if err := r.Update(ctx, &workflow); err != nil {
+					log.Error(err, "unable to update Workflow")
+					return ctrl.Result{}, err
+				}
+
+				if err := cleanupManagedClusterWorkflow(ctx, r.Client, workflow, req.Name); err != nil {
+					log.Error(err, "unable to clean up Workflow "+workflow.Namespace+"/"+workflow.Name)
+					return ctrl.Result{}, err
+				}
+				continue
+			}
+
+			message += ", unable to reschedule the Workflow without a Placement"
+		}
+
+		if isFanOutWorkflow(workflow) {
+			log.Info("failing Workflow " + workflow.Namespace + "/" + workflow.Name + " on ManagedCluster " + req.Name)
+			if err := recordLostCluster(&workflow, req.Name, message); err != nil {
+				log.Error(err, "unable to record the lost ManagedCluster")
+				return ctrl.Result{}, err
+			}
+			if err := aggregateManagedClusterStatuses(&workflow); err != nil {
+				log.Error(err, "unable to aggregate fan-out Workflow status")
+				return ctrl.Result{}, err
+			}
+		} else {
+			log.Info("failing Workflow " + workflow.Namespace + "/" + workflow.Name)
+			workflow.Status.Phase = argov1alpha1.WorkflowFailed
+			workflow.Status.Message = message
+			workflow.Status.FinishedAt = metav1.Now()
+		}
+		setHubOnlyCondition(&workflow)
+		if err := r.Update(ctx, &workflow); err != nil {
+			log.Error(err, "unable to update Workflow")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// isManagedClusterAvailable returns true if the ManagedCluster's available condition is true
+func isManagedClusterAvailable(managedCluster clusterv1.ManagedCluster) bool {
+	return meta.IsStatusConditionTrue(managedCluster.Status.Conditions, clusterv1.ManagedClusterConditionAvailable)
+}
@@ -19,44 +19,100 @@ package workflow
 import (
 	"context"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	workv1 "open-cluster-management.io/api/work/v1"
-	workflowv1alpha1 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 )
 
 const (
 	// Workflow annotation that dictates which managed cluster this Workflow should be propgated to.
 	AnnotationKeyOCMManagedCluster = "workflows.argoproj.io/ocm-managed-cluster"
+	// Workflow annotation that lists the comma separated managed clusters a fan-out Workflow should be propgated to.
+	AnnotationKeyOCMManagedClusters = "workflows.argoproj.io/ocm-managed-clusters"
 	// Workflow annotation that dictates which managed cluster namespace this Workflow should be propgated to.
 	AnnotationKeyOCMManagedClusterNamespace = "workflows.argoproj.io/ocm-managed-cluster-namespace"
 	// ManifestWork annotation that shows the namespace of the hub Workflow.
 	AnnotationKeyHubWorkflowNamespace = "workflows.argoproj.io/ocm-hub-workflow-namespace"
 	// ManifestWork annotation that shows the name of the hub Workflow.
 	AnnotationKeyHubWorkflowName = "workflows.argoproj.io/ocm-hub-workflow-name"
+	// ManifestWork annotation that shows the UID of the hub Workflow.
+	AnnotationKeyHubWorkflowUID = "workflows.argoproj.io/ocm-hub-workflow-uid"
 	// Workflow label that enables the controller to wrap the Workflow in ManifestWork payload.
 	LabelKeyEnableOCMMulticluster = "workflows.argoproj.io/enable-ocm-multicluster"
+	// Workflow label the Argo controllers use to only process the Workflows of their own instance ID.
+	// The hub Workflow is labeled with the hub controller instance ID so the hub Argo controller does not execute it.
+	LabelKeyControllerInstanceID = "workflows.argoproj.io/controller-instanceid"
+	// Workflow annotation that keeps the controller instance ID the user labeled the hub Workflow with,
+	// the managed cluster Workflow is labeled with it instead of the hub controller instance ID.
+	AnnotationKeyOCMControllerInstanceID = "workflows.argoproj.io/ocm-controller-instanceid"
+	// DefaultHubControllerInstanceID is the hub controller instance ID when none is configured.
+	DefaultHubControllerInstanceID = "argo-workflow-multicluster-hub"
+	// ConditionTypeHubOnly is the hub Workflow condition that shows it only runs on the managed cluster(s).
+	ConditionTypeHubOnly argov1alpha1.ConditionType = "OCMHubOnly"
+	// Workflow annotation that opts out of shipping the Workflow's ConfigMaps, Secrets and ServiceAccounts to the managed cluster.
+	AnnotationKeyOCMSkipDependencies = "workflows.argoproj.io/ocm-skip-dependencies"
+	// Secret label that allows the Secret to be copied to the managed clusters along with the Workflows that refer to it,
+	// it is set on the Secret by whoever manages the Secret and not requested by the Workflow.
+	LabelKeyOCMAllowPropagation = "workflows.argoproj.io/ocm-allow-propagation"
+	// Workflow annotation that adds the managed cluster Workflow namespace, and the Argo executor Role and RoleBinding, to the ManifestWork.
+	AnnotationKeyOCMCreateNamespace = "workflows.argoproj.io/ocm-create-namespace"
+	// Label added to the resources created on the managed cluster for the namespace, these are orphaned by the ManifestWork deletion.
+	LabelKeyManagedBy = "app.kubernetes.io/managed-by"
+	// LabelValueManagedBy is the value of the managed by label.
+	LabelValueManagedBy = "argo-workflow-multicluster"
+	// Workflow annotation that requests an action on the managed cluster Workflow, either "retry" or "resume".
+	AnnotationKeyOCMAction = "workflows.argoproj.io/ocm-action"
+	// ActionRetry resets the failed nodes of the completed managed cluster Workflow so they run again.
+	ActionRetry = "retry"
+	// ActionResume resumes the suspended nodes of the managed cluster Workflow.
+	ActionResume = "resume"
+	// Workflow annotation that identifies the requested action, a new value repeats the same action.
+	AnnotationKeyOCMActionID = "workflows.argoproj.io/ocm-action-id"
+	// Workflow annotation that selects the nodes the action applies to, e.g. "displayName=step1" or "templateName!=notify".
+	AnnotationKeyOCMActionNodeFieldSelector = "workflows.argoproj.io/ocm-action-node-field-selector"
+	// Workflow annotation that also restarts the selected succeeded nodes on retry.
+	AnnotationKeyOCMActionRestartSuccessful = "workflows.argoproj.io/ocm-action-restart-successful"
+	// Managed cluster Workflow annotation that records the last action applied by the status sync agent.
+	AnnotationKeyOCMAppliedAction = "workflows.argoproj.io/ocm-applied-action"
 	// FinalizerCleanupManifestWork is added to the Workflow so the associated ManifestWork gets cleaned up after a Workflow deletion.
 	FinalizerCleanupManifestWork = "workflows.argoproj.io/cleanup-ocm-manifestwork"
+	// IndexKeyTemplateReference indexes the running OCM enabled Workflows, the WorkflowTemplates and the ClusterWorkflowTemplates
+	// by the WorkflowTemplates and ClusterWorkflowTemplates they reference, as "<kind>/<name>".
+	IndexKeyTemplateReference = "templateReference"
 )
 
 // WorkflowReconciler reconciles a Workflow object
 type WorkflowReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// HubInstanceID is the controller instance ID the hub Workflow is labeled with.
+	HubInstanceID string
+	// StatusFeedback asks the OCM work agent to report the basic Workflow status as ManifestWork status feedback,
+	// for the managed clusters without the status sync addon.
+	StatusFeedback bool
+	// WorkflowQueue holds the Workflows that refer to a WorkflowQueue until the queue admits them.
+	WorkflowQueue bool
 }
 
 //+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=argoproj.io,resources=workflowstatusresults,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowtemplates;clusterworkflowtemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets;serviceaccounts,verbs=get;list;watch
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters,verbs=get;list;watch
 //+kubebuilder:rbac:groups=work.open-cluster-management.io,resources=manifestworks,verbs=get;list;watch;create;update;patch;delete
 
@@ -64,8 +120,16 @@ type WorkflowReconciler struct {
 var WorkflowPredicateFunctions = predicate.Funcs{
 	UpdateFunc: func(e event.UpdateEvent) bool {
 		newWorkflow := e.ObjectNew.(*argov1alpha1.Workflow)
-		return containsValidOCMLabel(*newWorkflow) && containsValidOCMAnnotation(*newWorkflow)
-
+		// a Workflow that is being rescheduled has no managed cluster but still needs its finalizer removed
+		if newWorkflow.DeletionTimestamp != nil && ContainsCleanupFinalizer(*newWorkflow) {
+			return true
+		}
+		if !containsValidOCMLabel(*newWorkflow) || !containsValidOCMAnnotation(*newWorkflow) {
+			return false
+		}
+		// status updates are not part of the ManifestWork payload
+		oldWorkflow := e.ObjectOld.(*argov1alpha1.Workflow)
+		return hasWorkPayloadChanged(*oldWorkflow, *newWorkflow) || isQueuedWorkflow(*oldWorkflow) != isQueuedWorkflow(*newWorkflow)
 	},
 	CreateFunc: func(e event.CreateEvent) bool {
 		workflow := e.Object.(*argov1alpha1.Workflow)
@@ -78,14 +142,118 @@ var WorkflowPredicateFunctions = predicate.Funcs{
 	},
 }
 
+// TemplatePredicateFunctions only reconciles the WorkflowTemplates and ClusterWorkflowTemplates that were created,
+// e.g. a missing template, or whose spec changed
+var TemplatePredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.ObjectNew.GetGeneration() != e.ObjectOld.GetGeneration()
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return true
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *WorkflowReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	indexes := map[client.Object]func(obj client.Object) []string{
+		&argov1alpha1.Workflow{}: func(obj client.Object) []string {
+			workflow := obj.(*argov1alpha1.Workflow)
+			if !containsValidOCMLabel(*workflow) || !containsValidOCMAnnotation(*workflow) || workflow.Status.Fulfilled() {
+				return nil
+			}
+			return getTemplateReferenceIndexValues(workflow.Spec)
+		},
+		&argov1alpha1.WorkflowTemplate{}: func(obj client.Object) []string {
+			return getTemplateReferenceIndexValues(obj.(*argov1alpha1.WorkflowTemplate).Spec)
+		},
+		&argov1alpha1.ClusterWorkflowTemplate{}: func(obj client.Object) []string {
+			return getTemplateReferenceIndexValues(obj.(*argov1alpha1.ClusterWorkflowTemplate).Spec)
+		},
+	}
+	for obj, indexerFunc := range indexes {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), obj, IndexKeyTemplateReference, indexerFunc); err != nil {
+			return err
+		}
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&argov1alpha1.Workflow{}).
-		WithEventFilter(WorkflowPredicateFunctions).
+		For(&argov1alpha1.Workflow{}, builder.WithPredicates(WorkflowPredicateFunctions)).
+		Watches(&source.Kind{Type: &argov1alpha1.WorkflowTemplate{}},
+			handler.EnqueueRequestsFromMapFunc(r.findWorkflowsForTemplate),
+			builder.WithPredicates(TemplatePredicateFunctions)).
+		Watches(&source.Kind{Type: &argov1alpha1.ClusterWorkflowTemplate{}},
+			handler.EnqueueRequestsFromMapFunc(r.findWorkflowsForTemplate),
+			builder.WithPredicates(TemplatePredicateFunctions)).
 		Complete(r)
 }
 
+// findWorkflowsForTemplate returns the running Workflows that reference the WorkflowTemplate or ClusterWorkflowTemplate,
+// directly or through the templates that reference it, so their ManifestWorks ship the new template
+func (r *WorkflowReconciler) findWorkflowsForTemplate(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	type namespacedReference struct {
+		ref       templateReference
+		namespace string
+	}
+	// a ClusterWorkflowTemplate has no namespace, it is referenced from every namespace
+	refs := []namespacedReference{{
+		ref:       templateReference{Name: obj.GetName(), ClusterScope: len(obj.GetNamespace()) == 0},
+		namespace: obj.GetNamespace(),
+	}}
+	visited := map[namespacedReference]bool{}
+	requests := []reconcile.Request{}
+	seen := map[types.NamespacedName]bool{}
+
+	for len(refs) > 0 {
+		current := refs[0]
+		refs = refs[1:]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		field := client.MatchingFields{IndexKeyTemplateReference: getTemplateReferenceIndexValue(current.ref)}
+
+		workflows := &argov1alpha1.WorkflowList{}
+		if err := r.List(ctx, workflows, client.InNamespace(current.namespace), field); err != nil {
+			ctrl.Log.Error(err, "unable to list Workflows referencing template "+current.ref.Name)
+			return nil
+		}
+		for _, workflow := range workflows.Items {
+			key := types.NamespacedName{Namespace: workflow.Namespace, Name: workflow.Name}
+			if !seen[key] {
+				seen[key] = true
+				requests = append(requests, reconcile.Request{NamespacedName: key})
+			}
+		}
+
+		workflowTemplates := &argov1alpha1.WorkflowTemplateList{}
+		if err := r.List(ctx, workflowTemplates, client.InNamespace(current.namespace), field); err != nil {
+			ctrl.Log.Error(err, "unable to list WorkflowTemplates referencing template "+current.ref.Name)
+			return nil
+		}
+		for _, workflowTemplate := range workflowTemplates.Items {
+			refs = append(refs, namespacedReference{
+				ref:       templateReference{Name: workflowTemplate.Name},
+				namespace: workflowTemplate.Namespace,
+			})
+		}
+
+		clusterWorkflowTemplates := &argov1alpha1.ClusterWorkflowTemplateList{}
+		if err := r.List(ctx, clusterWorkflowTemplates, field); err != nil {
+			ctrl.Log.Error(err, "unable to list ClusterWorkflowTemplates referencing template "+current.ref.Name)
+			return nil
+		}
+		for _, clusterWorkflowTemplate := range clusterWorkflowTemplates.Items {
+			refs = append(refs, namespacedReference{ref: templateReference{Name: clusterWorkflowTemplate.Name, ClusterScope: true}})
+		}
+	}
+
+	return requests
+}
+
 // Reconcile create/update/delete ManifestWork with the Workflow as its payload
 func (r *WorkflowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
@@ -97,30 +265,20 @@ func (r *WorkflowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	managedClusterName := workflow.GetAnnotations()[AnnotationKeyOCMManagedCluster]
+	managedClusterNames := getManagedClusterNames(workflow)
 	mwName := generateManifestWorkName(workflow)
 
-	// the Workflow is being deleted, find the ManifestWork and delete that as well
+	// the Workflow is being deleted, find the ManifestWork(s) and delete them as well
 	if workflow.ObjectMeta.DeletionTimestamp != nil {
-		// remove the WorkflowStatusResult in the managed cluster namespace that holds the full status
-		// it might not exist so if it's not found it's ok.
-		var workflowWithStatus workflowv1alpha1.WorkflowStatusResult
-		err := r.Get(ctx, types.NamespacedName{Namespace: managedClusterName,
-			Name: req.Name + "-" + string(workflow.UID)[0:5]}, &workflowWithStatus)
-		if errors.IsNotFound(err) {
-			log.Info("missing Workflow containing status")
-		} else if err != nil {
-			log.Error(err, "unable to fetch WorkflowStatusResult")
-			return ctrl.Result{}, err
-		} else if err == nil {
-			if err := r.Delete(ctx, &workflowWithStatus); err != nil {
-				log.Error(err, "unable to delete WorkflowStatusResult")
+		for _, managedClusterName := range managedClusterNames {
+			if err := cleanupManagedClusterWorkflow(ctx, r.Client, workflow, managedClusterName); err != nil {
+				log.Error(err, "unable to clean up Workflow from ManagedCluster "+managedClusterName)
 				return ctrl.Result{}, err
 			}
 		}
 
-		// remove finalizer from Workflow but do not 'commit' yet
-		if len(workflow.Finalizers) != 0 {
+		// deleted ManifestWork(s), commit the Workflow finalizer removal
+		if ContainsCleanupFinalizer(workflow) {
 			f := workflow.GetFinalizers()
 			for i := 0; i < len(f); i++ {
 				if f[i] == FinalizerCleanupManifestWork {
@@ -129,43 +287,44 @@ func (r *WorkflowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 				}
 			}
 			workflow.SetFinalizers(f)
-		}
 
-		// delete the ManifestWork associated with this Workflow
-		var work workv1.ManifestWork
-		err = r.Get(ctx, types.NamespacedName{Name: mwName, Namespace: managedClusterName}, &work)
-		if errors.IsNotFound(err) {
-			// already deleted ManifestWork, commit the Workflow finalizer removal
-			if err = r.Update(ctx, &workflow); err != nil {
+			if err := r.Update(ctx, &workflow); err != nil {
 				log.Error(err, "unable to update Workflow")
 				return ctrl.Result{}, err
 			}
-		} else if err != nil {
-			log.Error(err, "unable to fetch ManifestWork")
-			return ctrl.Result{}, err
 		}
 
-		if err := r.Delete(ctx, &work); err != nil {
-			log.Error(err, "unable to delete ManifestWork")
+		return ctrl.Result{}, nil
+	}
+
+	// the WorkflowQueue controller admits the Workflow once its managed cluster(s) have capacity
+	if r.WorkflowQueue && isQueuedWorkflow(workflow) {
+		log.Info("Workflow is waiting for WorkflowQueue " + workflow.Annotations[AnnotationKeyOCMQueue] + " admission")
+		return ctrl.Result{}, nil
+	}
+
+	// verify the ManagedCluster(s) actually exists
+	for _, managedClusterName := range managedClusterNames {
+		var managedCluster clusterv1.ManagedCluster
+		if err := r.Get(ctx, types.NamespacedName{Name: managedClusterName}, &managedCluster); err != nil {
+			log.Error(err, "unable to fetch ManagedCluster")
 			return ctrl.Result{}, err
 		}
+	}
 
-		// deleted ManifestWork, commit the Workflow finalizer removal
-		if err := r.Update(ctx, &workflow); err != nil {
-			log.Error(err, "unable to update Workflow")
+	// in case the Workflow was created before the webhook was served
+	if ensureHubOnlyLabel(&workflow, r.HubInstanceID) {
+		log.Info("labeling Workflow with the hub controller instance ID")
+		setHubOnlyCondition(&workflow)
+		if err := r.Client.Update(ctx, &workflow); err != nil {
+			log.Error(err, "unable to label Workflow with the hub controller instance ID")
 			return ctrl.Result{}, err
 		}
 
+		// the reconcile will retrigger from the above resource update
 		return ctrl.Result{}, nil
 	}
 
-	// verify the ManagedCluster actually exists
-	var managedCluster clusterv1.ManagedCluster
-	if err := r.Get(ctx, types.NamespacedName{Name: managedClusterName}, &managedCluster); err != nil {
-		log.Error(err, "unable to fetch ManagedCluster")
-		return ctrl.Result{}, err
-	}
-
 	if !ContainsCleanupFinalizer(workflow) {
 		log.Info("adding finalizer for Workflow")
 		workflow.SetFinalizers(append(workflow.GetFinalizers(), FinalizerCleanupManifestWork))
@@ -179,29 +338,60 @@ func (r *WorkflowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{Requeue: false}, nil
 	}
 
+	templates, err := r.resolveWorkflowTemplates(ctx, workflow)
+	if err != nil {
+		log.Error(err, "unable to resolve the Workflow's templates")
+		return ctrl.Result{}, err
+	}
+
+	dependencies, err := r.resolveWorkflowDependencies(ctx, workflow, templates)
+	if err != nil {
+		log.Error(err, "unable to resolve the Workflow's dependencies")
+		return ctrl.Result{}, err
+	}
+
+	manifests := []runtime.Object{}
+	if shouldCreateNamespace(workflow) {
+		manifests = append(manifests, generateNamespaceManifests(workflow)...)
+	}
+	manifests = append(append(manifests, templates...), dependencies...)
+
 	log.Info("generating ManifestWork for Workflow")
 	wf := prepareWorkflowForWorkPayload(workflow)
-	w := generateManifestWork(mwName, managedClusterName, wf)
 
-	// create or update the ManifestWork depends if it already exists or not
-	var mw workv1.ManifestWork
-	err := r.Get(ctx, types.NamespacedName{Name: mwName, Namespace: managedClusterName}, &mw)
-	if errors.IsNotFound(err) {
-		err = r.Client.Create(ctx, w)
-		if err != nil {
-			log.Error(err, "unable to create ManifestWork")
-			return ctrl.Result{}, err
+	for _, managedClusterName := range managedClusterNames {
+		// the ManifestWork would run the Workflow deleted on the managed cluster again
+		if isRemoteDeletedCluster(workflow, managedClusterName) {
+			continue
 		}
-	} else if err == nil {
-		mw.Spec.Workload.Manifests = []workv1.Manifest{{RawExtension: runtime.RawExtension{Object: &wf}}}
-		err = r.Client.Update(ctx, &mw)
-		if err != nil {
-			log.Error(err, "unable to update ManifestWork")
+
+		w := generateManifestWork(mwName, managedClusterName, wf, manifests...)
+		if r.StatusFeedback {
+			w.Spec.ManifestConfigs = generateStatusFeedbackConfigs(wf)
+		}
+
+		// create or update the ManifestWork depends if it already exists or not
+		var mw workv1.ManifestWork
+		err := r.Get(ctx, types.NamespacedName{Name: mwName, Namespace: managedClusterName}, &mw)
+		if errors.IsNotFound(err) {
+			err = r.Client.Create(ctx, w)
+			if err != nil {
+				log.Error(err, "unable to create ManifestWork")
+				return ctrl.Result{}, err
+			}
+		} else if err == nil {
+			mw.Spec.Workload = w.Spec.Workload
+			mw.Spec.DeleteOption = w.Spec.DeleteOption
+			mw.Spec.ManifestConfigs = w.Spec.ManifestConfigs
+			err = r.Client.Update(ctx, &mw)
+			if err != nil {
+				log.Error(err, "unable to update ManifestWork")
+				return ctrl.Result{}, err
+			}
+		} else {
+			log.Error(err, "unable to fetch ManifestWork")
 			return ctrl.Result{}, err
 		}
-	} else {
-		log.Error(err, "unable to fetch ManifestWork")
-		return ctrl.Result{}, err
 	}
 
 	log.Info("done reconciling Workflow")
@@ -209,6 +399,144 @@ func (r *WorkflowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	return ctrl.Result{}, nil
 }
 
+// resolveWorkflowTemplates fetches every WorkflowTemplate and ClusterWorkflowTemplate referenced by the Workflow,
+// including the nested references of the fetched templates, and prepares them for the ManifestWork payload.
+// Templates shared by multiple Workflows on the same managed cluster are applied by every ManifestWork,
+// the OCM work agent only removes them from the managed cluster once no ManifestWork owns them anymore.
+func (r *WorkflowReconciler) resolveWorkflowTemplates(ctx context.Context, workflow argov1alpha1.Workflow) ([]runtime.Object, error) {
+	templates := []runtime.Object{}
+	visited := map[templateReference]bool{}
+	refs := getTemplateReferences(workflow.Spec)
+
+	for len(refs) > 0 {
+		ref := refs[0]
+		refs = refs[1:]
+		if visited[ref] {
+			continue
+		}
+		visited[ref] = true
+
+		if ref.ClusterScope {
+			var clusterWorkflowTemplate argov1alpha1.ClusterWorkflowTemplate
+			if err := r.Get(ctx, types.NamespacedName{Name: ref.Name}, &clusterWorkflowTemplate); err != nil {
+				return nil, err
+			}
+			refs = append(refs, getTemplateReferences(clusterWorkflowTemplate.Spec)...)
+			templates = append(templates, prepareClusterWorkflowTemplateForWorkPayload(clusterWorkflowTemplate))
+			continue
+		}
+
+		var workflowTemplate argov1alpha1.WorkflowTemplate
+		if err := r.Get(ctx, types.NamespacedName{Namespace: workflow.Namespace, Name: ref.Name}, &workflowTemplate); err != nil {
+			return nil, err
+		}
+		refs = append(refs, getTemplateReferences(workflowTemplate.Spec)...)
+		templates = append(templates, prepareWorkflowTemplateForWorkPayload(workflowTemplate, generateWorkflowNamespace(workflow)))
+	}
+
+	return templates, nil
+}
+
+// resolveWorkflowDependencies fetches the ConfigMaps, Secrets and ServiceAccounts referenced by the Workflow
+// and its templates, along with the Secrets of the artifact repositories and the image pull Secrets of the ServiceAccounts,
+// and prepares them for the ManifestWork payload. Secrets are only copied when they are labeled with
+// LabelKeyOCMAllowPropagation, and missing dependencies are assumed to exist on the managed cluster.
+func (r *WorkflowReconciler) resolveWorkflowDependencies(ctx context.Context, workflow argov1alpha1.Workflow,
+	templates []runtime.Object) ([]runtime.Object, error) {
+	log := log.FromContext(ctx)
+	if isDependencySkipped(workflow) {
+		return nil, nil
+	}
+
+	refs := getDependencyReferences(workflow.Spec)
+	for _, template := range templates {
+		switch t := template.(type) {
+		case *argov1alpha1.WorkflowTemplate:
+			refs = append(refs, getDependencyReferences(t.Spec)...)
+		case *argov1alpha1.ClusterWorkflowTemplate:
+			refs = append(refs, getDependencyReferences(t.Spec)...)
+		}
+	}
+
+	dependencies := []runtime.Object{}
+	visited := map[dependencyReference]bool{}
+	namespace := generateWorkflowNamespace(workflow)
+	for len(refs) > 0 {
+		ref := refs[0]
+		refs = refs[1:]
+		if visited[ref] {
+			continue
+		}
+		visited[ref] = true
+
+		key := types.NamespacedName{Namespace: workflow.Namespace, Name: ref.Name}
+		var err error
+		switch ref.Kind {
+		case dependencyKindConfigMap:
+			var configMap corev1.ConfigMap
+			if err = r.Get(ctx, key, &configMap); err == nil {
+				// the artifact repositories reference their credential Secrets
+				refs = append(refs, getArtifactRepositorySecretReferences(configMap)...)
+				dependencies = append(dependencies, prepareConfigMapForWorkPayload(configMap, namespace))
+			}
+		case dependencyKindSecret:
+			var secret corev1.Secret
+			if err = r.Get(ctx, key, &secret); err == nil {
+				if !isSecretAllowed(secret) {
+					log.Info("skipping Secret " + ref.Name + ", it does not allow propagation to the managed clusters")
+					continue
+				}
+				dependencies = append(dependencies, prepareSecretForWorkPayload(secret, namespace))
+			}
+		case dependencyKindServiceAccount:
+			var serviceAccount corev1.ServiceAccount
+			if err = r.Get(ctx, key, &serviceAccount); err == nil {
+				// the pods of the ServiceAccount pull their images with its image pull Secrets
+				refs = append(refs, getServiceAccountSecretReferences(serviceAccount)...)
+				dependencies = append(dependencies, prepareServiceAccountForWorkPayload(serviceAccount, namespace))
+			}
+		}
+
+		if errors.IsNotFound(err) {
+			log.Info("skipping " + ref.Kind + " " + ref.Name + ", not found on the hub cluster")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dependencies, nil
+}
+
+// cleanupManagedClusterWorkflow deletes the ManifestWork and the WorkflowStatusResult
+// of the Workflow in the given managed cluster namespace, both might already be gone.
+// It is called once the managed cluster is no longer assigned to the Workflow, a failed clean up
+// is retried by the WorkflowStatusResult controller which cleans up the leftover results.
+func cleanupManagedClusterWorkflow(ctx context.Context, c client.Client, workflow argov1alpha1.Workflow, managedClusterName string) error {
+	// the WorkflowStatusResult shares the ManifestWork name since both use the hub Workflow UID
+	var workflowStatusResult workflowv1alpha2.WorkflowStatusResult
+	err := c.Get(ctx, types.NamespacedName{Namespace: managedClusterName, Name: generateManifestWorkName(workflow)}, &workflowStatusResult)
+	if err == nil {
+		err = c.Delete(ctx, &workflowStatusResult)
+	}
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+
+	return deleteManifestWork(ctx, c, workflow, managedClusterName)
+}
+
+// deleteManifestWork deletes the ManifestWork of the Workflow in the given managed cluster namespace, it might already be gone
+func deleteManifestWork(ctx context.Context, c client.Client, workflow argov1alpha1.Workflow, managedClusterName string) error {
+	var work workv1.ManifestWork
+	err := c.Get(ctx, types.NamespacedName{Namespace: managedClusterName, Name: generateManifestWorkName(workflow)}, &work)
+	if err == nil {
+		err = c.Delete(ctx, &work)
+	}
+	return client.IgnoreNotFound(err)
+}
+
 func ContainsCleanupFinalizer(workflow argov1alpha1.Workflow) bool {
 	f := workflow.GetFinalizers()
 	for _, e := range f {
@@ -0,0 +1,130 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+)
+
+const (
+	// Event annotation that records the count of the managed cluster Event already re-emitted against the hub Workflow.
+	AnnotationKeyOCMReemittedCount = "workflows.argoproj.io/ocm-reemitted-count"
+	// KindWorkflowStatusResult is the involved object kind of the Events the status sync agent emits for the managed cluster Workflows.
+	KindWorkflowStatusResult = "WorkflowStatusResult"
+)
+
+// WorkflowEventReconciler reconciles an Event object
+type WorkflowEventReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Recorder emits the managed cluster Events against the hub Workflow.
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowstatusresults,verbs=get;list;watch
+
+// EventPredicateFunctions only reconciles the Events the status sync agent emitted for a managed cluster Workflow
+var EventPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isWorkflowStatusResultEvent(*e.ObjectNew.(*corev1.Event))
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return isWorkflowStatusResultEvent(*e.Object.(*corev1.Event))
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkflowEventReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Event{}, builder.WithPredicates(EventPredicateFunctions)).
+		Complete(r)
+}
+
+// Reconcile re-emits the Event the status sync agent emitted against the WorkflowStatusResult in the managed cluster namespace
+// against the hub Workflow, so describing the hub Workflow shows what happened on the managed cluster.
+// The agent already deduplicates and rate limits the Events, the re-emitted count is recorded on the Event
+// so a repeated Event is only re-emitted when its count increases.
+func (r *WorkflowEventReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("reconciling Event...")
+	defer log.Info("done reconciling Event")
+
+	var ev corev1.Event
+	if err := r.Get(ctx, req.NamespacedName, &ev); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !shouldReemitEvent(ev) {
+		return ctrl.Result{}, nil
+	}
+
+	var workflowStatusResult workflowv1alpha2.WorkflowStatusResult
+	err := r.Get(ctx, types.NamespacedName{Namespace: ev.InvolvedObject.Namespace, Name: ev.InvolvedObject.Name}, &workflowStatusResult)
+	if errors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		log.Error(err, "unable to fetch WorkflowStatusResult")
+		return ctrl.Result{}, err
+	}
+
+	ref := workflowStatusResult.Spec.HubWorkflowRef
+	workflow := argov1alpha1.Workflow{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, &workflow)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to fetch Workflow")
+		return ctrl.Result{}, err
+	}
+	if errors.IsNotFound(err) || !isWorkflowStatusResultOwner(workflow, workflowStatusResult) || workflow.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	r.Recorder.Event(&workflow, ev.Type, ev.Reason, "ManagedCluster "+workflowStatusResult.Namespace+": "+ev.Message)
+
+	original := ev.DeepCopy()
+	if ev.Annotations == nil {
+		ev.Annotations = map[string]string{}
+	}
+	ev.Annotations[AnnotationKeyOCMReemittedCount] = strconv.Itoa(int(GetEventCount(ev)))
+	if err := r.Patch(ctx, &ev, client.MergeFrom(original)); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to patch Event")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	workv1 "open-cluster-management.io/api/work/v1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+)
+
+// WorkflowFeedbackReconciler reconciles a ManifestWork object
+type WorkflowFeedbackReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowstatusresults,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=work.open-cluster-management.io,resources=manifestworks,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=placementdecisions,verbs=get;list;watch
+
+// ManifestWorkFeedbackPredicateFunctions only reconciles the ManifestWorks whose Workflow status feedback changed
+var ManifestWorkFeedbackPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		newValues := getStatusFeedbackValues(*e.ObjectNew.(*workv1.ManifestWork))
+		return len(newValues) > 0 && !reflect.DeepEqual(getStatusFeedbackValues(*e.ObjectOld.(*workv1.ManifestWork)), newValues)
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return len(getStatusFeedbackValues(*e.Object.(*workv1.ManifestWork))) > 0
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkflowFeedbackReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("workflow-feedback").
+		For(&workv1.ManifestWork{}, builder.WithPredicates(ManifestWorkFeedbackPredicateFunctions)).
+		Complete(r)
+}
+
+// Reconcile populates the hub Workflow status with the status feedback the OCM work agent reported on the ManifestWork,
+// for the managed clusters without the status sync addon. Only the phase, message, start and finish times and progress
+// are reported, a managed cluster with the status sync addon reports the full status through a WorkflowStatusResult instead.
+func (r *WorkflowFeedbackReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("reconciling ManifestWork status feedback...")
+	defer log.Info("done reconciling ManifestWork status feedback")
+
+	var mw workv1.ManifestWork
+	if err := r.Get(ctx, req.NamespacedName, &mw); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	clusterStatus, ok := getStatusFeedbackWorkflowStatus(mw)
+	if !ok || mw.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	ref, ok := getManifestWorkHubWorkflowReference(mw)
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+
+	// the status sync addon reports the full status of the managed cluster
+	var workflowStatusResult workflowv1alpha2.WorkflowStatusResult
+	err := r.Get(ctx, types.NamespacedName{Namespace: mw.Namespace, Name: mw.Name}, &workflowStatusResult)
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+	if !errors.IsNotFound(err) {
+		log.Error(err, "unable to fetch WorkflowStatusResult")
+		return ctrl.Result{}, err
+	}
+
+	workflow := argov1alpha1.Workflow{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, &workflow)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to fetch Workflow")
+		return ctrl.Result{}, err
+	}
+	managedClusterName := mw.Namespace
+	if errors.IsNotFound(err) || workflow.UID != ref.UID || workflow.DeletionTimestamp != nil ||
+		!containsString(getManagedClusterNames(workflow), managedClusterName) || isRemoteDeletedCluster(workflow, managedClusterName) {
+		return ctrl.Result{}, nil
+	}
+
+	if isStaleStatusFeedback(workflow, mw) {
+		log.Info("ignoring the status feedback superseded by a later status of ManagedCluster " + managedClusterName)
+		return ctrl.Result{}, nil
+	}
+
+	// a failed Workflow is retried on another managed cluster the same way as with the status sync addon
+	retried, err := retryOnAnotherCluster(ctx, r.Client, workflow, managedClusterName, clusterStatus)
+	if err != nil || retried {
+		return ctrl.Result{}, err
+	}
+
+	original := workflow.DeepCopy()
+	if isFanOutWorkflow(workflow) {
+		if err := populateFanOutFeedbackStatus(&workflow, managedClusterName, clusterStatus); err != nil {
+			log.Error(err, "unable to aggregate fan-out Workflow status")
+			return ctrl.Result{}, err
+		}
+	} else {
+		workflow.Status = clusterStatus
+	}
+	setHubOnlyCondition(&workflow)
+	recordAcceptedStatusFeedback(&workflow, mw)
+
+	patch := client.MergeFrom(original)
+	if empty, err := isEmptyPatch(patch, &workflow); err != nil || !empty {
+		if err := r.Patch(ctx, &workflow, patch); err != nil {
+			log.Error(err, "unable to patch Workflow")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := deleteInlinePlacement(ctx, r.Client, workflow); err != nil {
+		log.Error(err, "unable to delete the inline Placement of the completed Workflow")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
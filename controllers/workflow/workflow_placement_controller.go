@@ -18,35 +18,94 @@ package workflow
 
 import (
 	"context"
+	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	"github.com/go-logr/logr"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
 	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
 )
 
 const (
 	// Workflow annotation that dictates which OCM Placement this Workflow should use to determine the managed cluster.
 	AnnotationKeyOCMPlacement = "workflows.argoproj.io/ocm-placement"
+	// Workflow annotation that dictates how the PlacementDecisions are used, either "single" (default) or "fanout".
+	AnnotationKeyOCMPlacementMode = "workflows.argoproj.io/ocm-placement-mode"
+	// PlacementModeSingle propagates the Workflow to the first decided managed cluster only.
+	PlacementModeSingle = "single"
+	// PlacementModeFanOut propagates the Workflow to every decided managed cluster.
+	PlacementModeFanOut = "fanout"
+	// Workflow annotation that records the Placement last used to determine the managed cluster, used for rescheduling.
+	AnnotationKeyOCMLastPlacement = "workflows.argoproj.io/ocm-last-placement"
+	// Workflow annotation that lists the comma separated managed clusters the Placement evaluation should skip.
+	AnnotationKeyOCMExcludedClusters = "workflows.argoproj.io/ocm-excluded-clusters"
+	// Workflow annotation that holds an inline Placement spec as YAML or JSON, used instead of a pre-created Placement.
+	// The controller creates a Placement owned by the Workflow from it and deletes it once the Workflow completes.
+	AnnotationKeyOCMPlacementSpec = "workflows.argoproj.io/ocm-placement-spec"
+	// Workflow annotation that records the results of the Placement evaluations as a JSON list of PlacementDecisionRecords,
+	// oldest first. Only the manager can change it.
+	AnnotationKeyOCMPlacementDecision = "workflows.argoproj.io/ocm-placement-decision"
+	// Workflow annotation that ranks the decided managed clusters by an AddOnPlacementScore, as "<AddOnPlacementScore name>/<score name>".
+	AnnotationKeyOCMPlacementScore = "workflows.argoproj.io/ocm-placement-score"
+	// ClusterClaimResourceUsage is the ManagedCluster claim that reports the resource requests of the pods running on the cluster
+	// as a JSON resource list, e.g. {"cpu":"3500m","memory":"12Gi"}, they are subtracted from its allocatable resources.
+	ClusterClaimResourceUsage = "resource-usage.workflows.argoproj.io"
+	// ConditionTypeAwaitingPlacementDecision is the pending hub Workflow condition that shows its Placement has no usable decision yet.
+	ConditionTypeAwaitingPlacementDecision argov1alpha1.ConditionType = "AwaitingPlacementDecision"
+	// IndexKeyWorkflowPlacement indexes the OCM enabled Workflows by the Placement they wait for.
+	IndexKeyWorkflowPlacement = "workflowPlacement"
+	// IndexKeyPlacementDecisionCluster indexes the PlacementDecisions by the managed clusters they decide.
+	IndexKeyPlacementDecisionCluster = "placementDecisionCluster"
+	// maxPlacementDecisionRecords is how many placement decision records a Workflow keeps, the oldest ones are dropped first.
+	maxPlacementDecisionRecords = 10
 )
 
+// PlacementDecisionRecord is the result of a Placement evaluation, a new record is appended every time the Workflow is placed
+type PlacementDecisionRecord struct {
+	// Placement is the name of the evaluated Placement in the Workflow namespace.
+	Placement string `json:"placement"`
+	// PlacementDecisions are the names of the PlacementDecisions the clusters were chosen from.
+	PlacementDecisions []string `json:"placementDecisions,omitempty"`
+	// Clusters are the chosen managed clusters, a single one unless the Workflow fans out.
+	Clusters []string `json:"clusters"`
+	// Candidates are the other decided managed clusters that fit the Workflow, in ranking order.
+	Candidates []string `json:"candidates,omitempty"`
+	// DecidedAt is when the Placement was evaluated.
+	DecidedAt metav1.Time `json:"decidedAt"`
+}
+
 // WorkflowPlacementReconciler reconciles a Workflow object
 type WorkflowPlacementReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// HubInstanceID is the controller instance ID the hub Workflow is labeled with.
+	HubInstanceID string
 }
 
 //+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=placementdecisions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=placements,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters;addonplacementscores,verbs=get;list;watch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowtemplates;clusterworkflowtemplates,verbs=get;list;watch
 
 // WorkflowPredicateFunctions defines which Workflow this controller evaluate the placement decision
 var WorkflowPlacementPredicateFunctions = predicate.Funcs{
@@ -65,14 +124,144 @@ var WorkflowPlacementPredicateFunctions = predicate.Funcs{
 	},
 }
 
+// PlacementDecisionPredicateFunctions only reconciles the PlacementDecisions whose decided clusters changed
+var PlacementDecisionPredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		newDecision := e.ObjectNew.(*clusterv1beta1.PlacementDecision)
+		oldDecision := e.ObjectOld.(*clusterv1beta1.PlacementDecision)
+		return !equality.Semantic.DeepEqual(newDecision.Status.Decisions, oldDecision.Status.Decisions)
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return true
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
+// ManagedClusterResourcePredicateFunctions only reconciles the ManagedClusters whose free resources changed
+var ManagedClusterResourcePredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		newCluster := e.ObjectNew.(*clusterv1.ManagedCluster)
+		oldCluster := e.ObjectOld.(*clusterv1.ManagedCluster)
+		return !equality.Semantic.DeepEqual(getManagedClusterFreeResources(*newCluster), getManagedClusterFreeResources(*oldCluster))
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return false
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
+// PlacementScorePredicateFunctions only reconciles the AddOnPlacementScores whose scores changed
+var PlacementScorePredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		newScore := e.ObjectNew.(*clusterv1alpha1.AddOnPlacementScore)
+		oldScore := e.ObjectOld.(*clusterv1alpha1.AddOnPlacementScore)
+		return !equality.Semantic.DeepEqual(newScore.Status, oldScore.Status)
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		return true
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (re *WorkflowPlacementReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &argov1alpha1.Workflow{}, IndexKeyWorkflowPlacement,
+		func(obj client.Object) []string {
+			workflow := obj.(*argov1alpha1.Workflow)
+			placementName := getAwaitedPlacementName(*workflow)
+			if !containsValidOCMLabel(*workflow) || len(placementName) == 0 {
+				return nil
+			}
+			return []string{placementName}
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &clusterv1beta1.PlacementDecision{}, IndexKeyPlacementDecisionCluster,
+		func(obj client.Object) []string {
+			placementDecision := obj.(*clusterv1beta1.PlacementDecision)
+			return getDecidedClusterNames([]clusterv1beta1.PlacementDecision{*placementDecision})
+		}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&argov1alpha1.Workflow{}).
-		WithEventFilter(WorkflowPlacementPredicateFunctions).
+		For(&argov1alpha1.Workflow{}, builder.WithPredicates(WorkflowPlacementPredicateFunctions)).
+		Watches(&source.Kind{Type: &clusterv1beta1.PlacementDecision{}},
+			handler.EnqueueRequestsFromMapFunc(re.findWorkflowsForPlacementDecision),
+			builder.WithPredicates(PlacementDecisionPredicateFunctions)).
+		Watches(&source.Kind{Type: &clusterv1.ManagedCluster{}},
+			handler.EnqueueRequestsFromMapFunc(re.findWorkflowsForManagedCluster),
+			builder.WithPredicates(ManagedClusterResourcePredicateFunctions)).
+		Watches(&source.Kind{Type: &clusterv1alpha1.AddOnPlacementScore{}},
+			handler.EnqueueRequestsFromMapFunc(re.findWorkflowsForPlacementScore),
+			builder.WithPredicates(PlacementScorePredicateFunctions)).
 		Complete(re)
 }
 
+// findWorkflowsForManagedCluster returns the Workflows waiting for a Placement that decided the ManagedCluster
+func (re *WorkflowPlacementReconciler) findWorkflowsForManagedCluster(obj client.Object) []reconcile.Request {
+	return re.findWorkflowsAwaitingManagedCluster(obj.GetName())
+}
+
+// findWorkflowsForPlacementScore returns the Workflows waiting for a Placement that decided the ManagedCluster
+// of the AddOnPlacementScore, i.e. of its namespace
+func (re *WorkflowPlacementReconciler) findWorkflowsForPlacementScore(obj client.Object) []reconcile.Request {
+	return re.findWorkflowsAwaitingManagedCluster(obj.GetNamespace())
+}
+
+// findWorkflowsAwaitingManagedCluster returns the Workflows still awaiting a decision of a Placement that decided the managed cluster,
+// they are evaluated again since the managed cluster might now fit them
+func (re *WorkflowPlacementReconciler) findWorkflowsAwaitingManagedCluster(managedClusterName string) []reconcile.Request {
+	placementDecisions := &clusterv1beta1.PlacementDecisionList{}
+	if err := re.List(context.Background(), placementDecisions,
+		client.MatchingFields{IndexKeyPlacementDecisionCluster: managedClusterName}); err != nil {
+		ctrl.Log.Error(err, "unable to list PlacementDecisions of ManagedCluster "+managedClusterName)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, placementDecision := range placementDecisions.Items {
+		for _, request := range re.findWorkflowsForPlacementDecision(&placementDecision) {
+			workflow := argov1alpha1.Workflow{}
+			if err := re.Get(context.Background(), request.NamespacedName, &workflow); err != nil ||
+				!isAwaitingPlacementDecision(workflow) {
+				continue
+			}
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// findWorkflowsForPlacementDecision returns the Workflows waiting for the Placement of the PlacementDecision
+func (re *WorkflowPlacementReconciler) findWorkflowsForPlacementDecision(obj client.Object) []reconcile.Request {
+	placementName := obj.GetLabels()[clusterv1beta1.PlacementLabel]
+	if len(placementName) == 0 {
+		return nil
+	}
+
+	workflows := &argov1alpha1.WorkflowList{}
+	if err := re.List(context.Background(), workflows, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{IndexKeyWorkflowPlacement: placementName}); err != nil {
+		ctrl.Log.Error(err, "unable to list Workflows waiting for Placement "+placementName)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, workflow := range workflows.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: workflow.Namespace, Name: workflow.Name},
+		})
+	}
+	return requests
+}
+
 // Reconcile evaluates the PlacementDecision based on the Placement reference then populates the ManagedCluster annotation with the reuslt
 func (r *WorkflowPlacementReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
@@ -84,11 +273,33 @@ func (r *WorkflowPlacementReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	if workflow.ObjectMeta.DeletionTimestamp != nil {
+	// the Workflow might have been placed since the request was queued
+	if workflow.ObjectMeta.DeletionTimestamp != nil || !containsValidOCMPlacementAnnotation(workflow) {
 		return ctrl.Result{}, nil
 	}
 
+	// the label is persisted along with the Placement evaluation status
+	ensureHubOnlyLabel(&workflow, r.HubInstanceID)
+
 	placementRef := workflow.Annotations[AnnotationKeyOCMPlacement]
+	if len(placementRef) == 0 && hasPendingInlinePlacement(workflow) {
+		placement, err := generateInlinePlacement(workflow)
+		if err != nil {
+			r.updateWorkflowStatusWithPlacementError(ctx, log, workflow, "invalid inline Placement spec\n"+err.Error())
+			return ctrl.Result{}, nil
+		}
+		if err := r.ensureInlinePlacement(ctx, placement); err != nil {
+			log.Error(err, "unable to create the inline Placement")
+			return ctrl.Result{}, err
+		}
+		placementRef = placement.Name
+	}
+
+	// a rescheduled fan-out Workflow keeps running on its other managed clusters, the Placement only adds the new ones
+	running := []string{}
+	if isFanOutWorkflow(workflow) {
+		running = getManagedClusterNames(workflow)
+	}
 
 	// query all placementdecisions of the placement
 	requirement, err := labels.NewRequirement(clusterv1beta1.PlacementLabel, selection.Equals, []string{placementRef})
@@ -109,33 +320,67 @@ func (r *WorkflowPlacementReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, err
 	}
 
-	if len(placementDecisions.Items) == 0 {
-		r.updateWorkflowStatusWithPlacementError(ctx, log, workflow, "unable to find any PlacementDecision, retrying after 10 seconds...")
-		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	// the PlacementDecision watch reconciles the Workflow again once the Placement decides
+	if len(placementDecisions.Items) == 0 && len(running) == 0 {
+		r.updateWorkflowStatusAwaitingPlacementDecision(ctx, log, workflow, "waiting for a PlacementDecision of Placement "+placementRef)
+		return ctrl.Result{}, nil
 	}
 
-	// TODO only handle one PlacementDecision target for now
-	pd := placementDecisions.Items[0]
-	if len(pd.Status.Decisions) == 0 {
-		r.updateWorkflowStatusWithPlacementError(ctx, log, workflow, "unable to find any Decisions from PlacementDecision, retrying after 10 seconds...")
-		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	managedClusterNames := excludeClusterNames(workflow, getDecidedClusterNames(placementDecisions.Items))
+	if len(managedClusterNames) == 0 && len(running) == 0 {
+		r.updateWorkflowStatusAwaitingPlacementDecision(ctx, log, workflow,
+			"waiting for Placement "+placementRef+" to decide a valid ManagedCluster")
+		return ctrl.Result{}, nil
 	}
 
-	// TODO only using the first decision
-	managedClusterName := pd.Status.Decisions[0].ClusterName
-	if len(managedClusterName) == 0 {
-		r.updateWorkflowStatusWithPlacementError(ctx, log, workflow, "unable to find a valid ManagedCluster from PlacementDecision, retrying after 10 seconds...")
-		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	// the clusters that can not fit the Workflow are left out, the rest is ranked by the AddOnPlacementScore if any
+	managedClusterNames, err = r.filterAndRankClusterNames(ctx, workflow, managedClusterNames)
+	if err != nil {
+		r.updateWorkflowStatusWithPlacementError(ctx, log, workflow, "unable to evaluate the ManagedCluster resources\n"+err.Error())
+		return ctrl.Result{}, err
+	}
+	// the ManagedCluster and AddOnPlacementScore watches reconcile the Workflow again once a decided cluster might fit it
+	if len(managedClusterNames) == 0 && len(running) == 0 {
+		r.updateWorkflowStatusAwaitingPlacementDecision(ctx, log, workflow,
+			"waiting for a ManagedCluster of Placement "+placementRef+" that fits the Workflow resource requests")
+		return ctrl.Result{}, nil
 	}
 
-	log.Info("updating Workflow with annotation ManagedCluster: " + managedClusterName)
+	var chosen, candidates []string
+	if isFanOutWorkflow(workflow) {
+		chosen = append(running, excludeNames(managedClusterNames, running)...)
+	} else {
+		chosen, candidates = managedClusterNames[:1], managedClusterNames[1:]
+	}
+	record := PlacementDecisionRecord{
+		Placement:          placementRef,
+		PlacementDecisions: getPlacementDecisionNames(placementDecisions.Items, chosen),
+		Clusters:           chosen,
+		Candidates:         candidates,
+		DecidedAt:          metav1.Now(),
+	}
+	if err := appendPlacementDecisionRecord(&workflow, record); err != nil {
+		log.Error(err, "unable to record the PlacementDecision")
+		return ctrl.Result{}, err
+	}
 
-	workflow.Annotations[AnnotationKeyOCMPlacement] = ""
-	workflow.Annotations[AnnotationKeyOCMManagedCluster] = managedClusterName
-	workflow.Status = argov1alpha1.WorkflowStatus{
-		Phase:   argov1alpha1.WorkflowPending,
-		Message: "successfully evaluated Placement, pending Workflow propagation and execution",
+	// the Placement annotation is kept, the record tells the Workflow was placed by it
+	workflow.Annotations[AnnotationKeyOCMLastPlacement] = placementRef
+	if isFanOutWorkflow(workflow) {
+		log.Info("updating Workflow with annotation ManagedClusters: " + strings.Join(chosen, ","))
+		workflow.Annotations[AnnotationKeyOCMManagedClusters] = strings.Join(chosen, ",")
+	} else {
+		log.Info("updating Workflow with annotation ManagedCluster: " + chosen[0])
+		workflow.Annotations[AnnotationKeyOCMManagedCluster] = chosen[0]
 	}
+	// the running fan-out Workflow keeps its aggregated status
+	if len(running) == 0 {
+		workflow.Status = argov1alpha1.WorkflowStatus{
+			Phase:   argov1alpha1.WorkflowPending,
+			Message: "successfully evaluated Placement, pending Workflow propagation and execution",
+		}
+	}
+	setHubOnlyCondition(&workflow)
 
 	err = r.Client.Update(ctx, &workflow)
 	if err != nil {
@@ -148,6 +393,114 @@ func (r *WorkflowPlacementReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	return ctrl.Result{}, nil
 }
 
+// ensureInlinePlacement creates the Placement generated from the Workflow inline Placement spec, or updates its spec
+func (r *WorkflowPlacementReconciler) ensureInlinePlacement(ctx context.Context, placement *clusterv1beta1.Placement) error {
+	var existing clusterv1beta1.Placement
+	err := r.Get(ctx, types.NamespacedName{Namespace: placement.Namespace, Name: placement.Name}, &existing)
+	if errors.IsNotFound(err) {
+		return r.Create(ctx, placement)
+	}
+	if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(existing.Spec, placement.Spec) {
+		return nil
+	}
+	existing.Spec = placement.Spec
+	return r.Update(ctx, &existing)
+}
+
+// filterAndRankClusterNames returns the decided managed clusters whose free resources fit the Workflow resource demand,
+// ranked by the AddOnPlacementScore the Workflow references
+func (r *WorkflowPlacementReconciler) filterAndRankClusterNames(ctx context.Context, workflow argov1alpha1.Workflow,
+	names []string) ([]string, error) {
+	log := log.FromContext(ctx)
+	templateSpecs, err := r.getReferencedWorkflowSpecs(ctx, workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	demand := getWorkflowResourceDemand(workflow.Spec, templateSpecs)
+	fitting := []string{}
+	for _, name := range names {
+		if len(demand) > 0 {
+			managedCluster := clusterv1.ManagedCluster{}
+			if err := r.Get(ctx, types.NamespacedName{Name: name}, &managedCluster); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			if !fitsResourceDemand(managedCluster, demand) {
+				log.Info("ManagedCluster " + name + " can not fit the Workflow resource requests")
+				continue
+			}
+		}
+		fitting = append(fitting, name)
+	}
+
+	scoreName, itemName, ok := getPlacementScoreReference(workflow)
+	if !ok {
+		return fitting, nil
+	}
+	scores := map[string]int32{}
+	for _, name := range fitting {
+		score := clusterv1alpha1.AddOnPlacementScore{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: name, Name: scoreName}, &score)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := getPlacementScore(score, itemName, time.Now()); ok {
+			scores[name] = value
+		}
+	}
+	return rankClusterNamesByScore(fitting, scores), nil
+}
+
+// getReferencedWorkflowSpecs returns the specs of the WorkflowTemplates and ClusterWorkflowTemplates the Workflow references,
+// directly or through the templates it references. The missing templates are left to the Workflow propagation to report.
+func (r *WorkflowPlacementReconciler) getReferencedWorkflowSpecs(ctx context.Context,
+	workflow argov1alpha1.Workflow) (map[templateReference]argov1alpha1.WorkflowSpec, error) {
+	specs := map[templateReference]argov1alpha1.WorkflowSpec{}
+	visited := map[templateReference]bool{}
+	refs := getTemplateReferences(workflow.Spec)
+
+	for len(refs) > 0 {
+		ref := refs[0]
+		refs = refs[1:]
+		if visited[ref] {
+			continue
+		}
+		visited[ref] = true
+
+		var spec argov1alpha1.WorkflowSpec
+		var err error
+		if ref.ClusterScope {
+			var clusterWorkflowTemplate argov1alpha1.ClusterWorkflowTemplate
+			err = r.Get(ctx, types.NamespacedName{Name: ref.Name}, &clusterWorkflowTemplate)
+			spec = clusterWorkflowTemplate.Spec
+		} else {
+			var workflowTemplate argov1alpha1.WorkflowTemplate
+			err = r.Get(ctx, types.NamespacedName{Namespace: workflow.Namespace, Name: ref.Name}, &workflowTemplate)
+			spec = workflowTemplate.Spec
+		}
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		specs[ref] = spec
+		refs = append(refs, getTemplateReferences(spec)...)
+	}
+
+	return specs, nil
+}
+
 func (r *WorkflowPlacementReconciler) updateWorkflowStatusWithPlacementError(ctx context.Context, log logr.Logger,
 	workflow argov1alpha1.Workflow, placementErr string) {
 	log.Info(placementErr)
@@ -156,8 +509,35 @@ func (r *WorkflowPlacementReconciler) updateWorkflowStatusWithPlacementError(ctx
 		Phase:   argov1alpha1.WorkflowError,
 		Message: "unable to evaluate Placement and PlacementDecision\n" + placementErr,
 	}
+	setHubOnlyCondition(&workflow)
+
+	if err := r.Client.Update(ctx, &workflow); err != nil {
+		log.Error(err, "unable to update Workflow status")
+	}
+}
+
+// updateWorkflowStatusAwaitingPlacementDecision keeps the Workflow Pending until its Placement decides a usable ManagedCluster
+func (r *WorkflowPlacementReconciler) updateWorkflowStatusAwaitingPlacementDecision(ctx context.Context, log logr.Logger,
+	workflow argov1alpha1.Workflow, message string) {
+	log.Info(message)
+
+	setAwaitingPlacementDecisionStatus(&workflow, message)
+	setHubOnlyCondition(&workflow)
 
 	if err := r.Client.Update(ctx, &workflow); err != nil {
 		log.Error(err, "unable to update Workflow status")
 	}
 }
+
+// deleteInlinePlacement deletes the Placement generated from the Workflow inline Placement spec once the Workflow completed,
+// the Placement is otherwise garbage collected along with the Workflow
+func deleteInlinePlacement(ctx context.Context, c client.Client, workflow argov1alpha1.Workflow) error {
+	if len(workflow.GetAnnotations()[AnnotationKeyOCMPlacementSpec]) == 0 || !workflow.Status.Fulfilled() {
+		return nil
+	}
+
+	placement := clusterv1beta1.Placement{}
+	placement.Namespace = workflow.Namespace
+	placement.Name = generateInlinePlacementName(workflow)
+	return client.IgnoreNotFound(c.Delete(ctx, &placement))
+}
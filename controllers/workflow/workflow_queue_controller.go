@@ -0,0 +1,208 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+)
+
+const (
+	// Workflow annotation that dictates which WorkflowQueue admits the Workflow to its managed cluster(s),
+	// the queue webhook sets it at creation from the WorkflowQueue the namespace is bound to.
+	AnnotationKeyOCMQueue = "workflows.argoproj.io/ocm-queue"
+	// Workflow annotation that dictates the priority class of the Workflow in its WorkflowQueue,
+	// a priority class the namespace can not use is replaced by the queue default priority class.
+	AnnotationKeyOCMPriorityClass = "workflows.argoproj.io/ocm-priority-class"
+	// Workflow annotation that records when the WorkflowQueue admitted the Workflow, it is removed when the Workflow is rescheduled.
+	// The queue webhook only lets the manager set it.
+	AnnotationKeyOCMQueueAdmitted = "workflows.argoproj.io/ocm-queue-admitted"
+	// ConditionTypeQueued is the pending hub Workflow condition that shows it waits for its WorkflowQueue to admit it.
+	ConditionTypeQueued argov1alpha1.ConditionType = "Queued"
+	// IndexKeyWorkflowQueue indexes the OCM enabled Workflows by their WorkflowQueue.
+	IndexKeyWorkflowQueue = "workflowQueue"
+)
+
+// WorkflowQueueReconciler reconciles a WorkflowQueue object
+type WorkflowQueueReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowqueues,verbs=get;list;watch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowqueues/status,verbs=get;update;patch
+
+// WorkflowQueuePredicateFunctions only reconciles the WorkflowQueue of a Workflow whose change can change the queue usage
+var WorkflowQueuePredicateFunctions = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		newWorkflow := e.ObjectNew.(*argov1alpha1.Workflow)
+		oldWorkflow := e.ObjectOld.(*argov1alpha1.Workflow)
+		if len(newWorkflow.Annotations[AnnotationKeyOCMQueue]) == 0 && len(oldWorkflow.Annotations[AnnotationKeyOCMQueue]) == 0 {
+			return false
+		}
+		return containsValidOCMLabel(*newWorkflow) && hasQueueStateChanged(*oldWorkflow, *newWorkflow)
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		workflow := e.Object.(*argov1alpha1.Workflow)
+		return containsValidOCMLabel(*workflow) && len(workflow.Annotations[AnnotationKeyOCMQueue]) > 0
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		workflow := e.Object.(*argov1alpha1.Workflow)
+		return containsValidOCMLabel(*workflow) && len(workflow.Annotations[AnnotationKeyOCMQueue]) > 0
+	},
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkflowQueueReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &argov1alpha1.Workflow{}, IndexKeyWorkflowQueue,
+		func(obj client.Object) []string {
+			workflow := obj.(*argov1alpha1.Workflow)
+			queueName := workflow.Annotations[AnnotationKeyOCMQueue]
+			if !containsValidOCMLabel(*workflow) || len(queueName) == 0 {
+				return nil
+			}
+			return []string{queueName}
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&workflowv1alpha2.WorkflowQueue{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &argov1alpha1.Workflow{}},
+			handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+				queueName := obj.GetAnnotations()[AnnotationKeyOCMQueue]
+				if len(queueName) == 0 {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: queueName}}}
+			}),
+			builder.WithPredicates(WorkflowQueuePredicateFunctions)).
+		Complete(r)
+}
+
+// Reconcile admits the queued Workflows of the WorkflowQueue that fit its limits, the admitted Workflows are then
+// propagated to their managed cluster(s) by the Workflow controller. The other queued Workflows stay Pending
+// with the Queued condition.
+func (r *WorkflowQueueReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("reconciling WorkflowQueue...")
+	defer log.Info("done reconciling WorkflowQueue")
+
+	var queue workflowv1alpha2.WorkflowQueue
+	err := r.Get(ctx, req.NamespacedName, &queue)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to fetch WorkflowQueue")
+		return ctrl.Result{}, err
+	}
+	queueNotFound := errors.IsNotFound(err)
+
+	workflows := &argov1alpha1.WorkflowList{}
+	if err := r.List(ctx, workflows, client.MatchingFields{IndexKeyWorkflowQueue: req.Name}); err != nil {
+		log.Error(err, "unable to list Workflows")
+		return ctrl.Result{}, err
+	}
+	running, queued := classifyQueueWorkflows(workflows.Items)
+
+	// the Workflows of a missing WorkflowQueue wait for it to be created, the ones of a namespace
+	// that is no longer bound to the queue wait for the namespace to be bound again
+	admitted := []argov1alpha1.Workflow{}
+	messages := map[string]string{}
+	for _, workflow := range queued {
+		switch {
+		case queueNotFound:
+			messages[workflow.Namespace] = "waiting for WorkflowQueue " + req.Name + " to be created"
+		case !containsString(queue.Spec.Namespaces, workflow.Namespace):
+			messages[workflow.Namespace] = "waiting for namespace " + workflow.Namespace + " to be bound to WorkflowQueue " + req.Name
+		default:
+			messages[workflow.Namespace] = "waiting for capacity in WorkflowQueue " + req.Name
+		}
+	}
+	if !queueNotFound {
+		bound := []argov1alpha1.Workflow{}
+		for _, workflow := range queued {
+			if containsString(queue.Spec.Namespaces, workflow.Namespace) {
+				bound = append(bound, workflow)
+			}
+		}
+		admitted = selectAdmittedWorkflows(queue.Spec, running, bound)
+	}
+
+	admittedKeys := map[types.NamespacedName]bool{}
+	for i := range admitted {
+		workflow := admitted[i]
+		admittedKeys[types.NamespacedName{Namespace: workflow.Namespace, Name: workflow.Name}] = true
+		log.Info("admitting Workflow " + workflow.Namespace + "/" + workflow.Name)
+		admitQueuedWorkflow(&workflow, time.Now())
+		if err := r.Update(ctx, &workflow); err != nil {
+			log.Error(err, "unable to admit Workflow")
+			return ctrl.Result{}, err
+		}
+	}
+
+	for i := range queued {
+		workflow := queued[i]
+		if admittedKeys[types.NamespacedName{Namespace: workflow.Namespace, Name: workflow.Name}] {
+			continue
+		}
+		original := workflow.Status.DeepCopy()
+		setQueuedStatus(&workflow, messages[workflow.Namespace])
+		setHubOnlyCondition(&workflow)
+		if equality.Semantic.DeepEqual(*original, workflow.Status) {
+			continue
+		}
+		if err := r.Update(ctx, &workflow); err != nil {
+			log.Error(err, "unable to update queued Workflow status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if queueNotFound {
+		return ctrl.Result{}, nil
+	}
+
+	status := workflowv1alpha2.WorkflowQueueStatus{
+		Running: int32(len(running) + len(admitted)),
+		Queued:  int32(len(queued) - len(admitted)),
+	}
+	if queue.Status != status {
+		queue.Status = status
+		if err := r.Status().Update(ctx, &queue); err != nil {
+			log.Error(err, "unable to update WorkflowQueue status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
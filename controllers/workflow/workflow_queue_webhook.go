@@ -0,0 +1,133 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
+)
+
+const (
+	// WebhookPathQueue is the path the WorkflowQueue mutating webhook is served at.
+	WebhookPathQueue = "/mutate-argoproj-io-v1alpha1-workflow-queue"
+	// DefaultManagerUsername is the username the manager sends its requests to the hub API server with.
+	DefaultManagerUsername = "system:serviceaccount:open-cluster-management:argo-workflow-multicluster"
+)
+
+// WorkflowQueueMutator binds the OCM enabled Workflows to the WorkflowQueue of their namespace at creation,
+// and keeps anyone but the manager from admitting a Workflow, leaving its queue or using a priority class
+// its namespace can not use. It is only served with the WorkflowQueue controller, see config/queue.
+type WorkflowQueueMutator struct {
+	Client client.Client
+	// ManagerUsername is the username of the manager, the only one that can admit the queued Workflows.
+	ManagerUsername string
+}
+
+// Handle sets the queue annotations of the Workflow at creation, and restores them on update
+func (m *WorkflowQueueMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// the webhook selects every Workflow with the label, whatever its value
+	if !isOCMMulticlusterEnabled(obj.GetLabels()) {
+		return admission.Allowed("not an OCM multicluster Workflow")
+	}
+
+	isManager := req.UserInfo.Username == m.ManagerUsername
+	annos := obj.GetAnnotations()
+	if annos == nil {
+		annos = map[string]string{}
+	}
+
+	switch req.Operation {
+	case admissionv1.Create:
+		if err := m.bindNamespaceQueue(ctx, req.Namespace, annos, isManager); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	case admissionv1.Update:
+		if isManager {
+			return admission.Allowed("the manager manages the queue annotations")
+		}
+		oldObj := &unstructured.Unstructured{}
+		if err := oldObj.UnmarshalJSON(req.OldObject.Raw); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// a Workflow that just enabled OCM was not bound to a queue yet, it is bound as on creation
+		if !isOCMMulticlusterEnabled(oldObj.GetLabels()) {
+			if err := m.bindNamespaceQueue(ctx, req.Namespace, annos, isManager); err != nil {
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+			break
+		}
+		oldAnnos := oldObj.GetAnnotations()
+		setAnnotation(annos, AnnotationKeyOCMQueue, oldAnnos[AnnotationKeyOCMQueue])
+		setAnnotation(annos, AnnotationKeyOCMQueueAdmitted, oldAnnos[AnnotationKeyOCMQueueAdmitted])
+	default:
+		return admission.Allowed("not a create or update")
+	}
+
+	// a priority class the namespace can not use is dropped, the queue default priority class applies
+	if name := annos[AnnotationKeyOCMPriorityClass]; len(name) > 0 && len(annos[AnnotationKeyOCMQueue]) > 0 {
+		queue := &workflowv1alpha2.WorkflowQueue{}
+		err := m.Client.Get(ctx, client.ObjectKey{Name: annos[AnnotationKeyOCMQueue]}, queue)
+		if client.IgnoreNotFound(err) != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if err != nil || !isPriorityClassAllowed(queue.Spec, name, req.Namespace) {
+			delete(annos, AnnotationKeyOCMPriorityClass)
+		}
+	}
+
+	obj.SetAnnotations(annos)
+	mutated, err := obj.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, mutated)
+}
+
+// bindNamespaceQueue sets the queue annotation to the WorkflowQueue of the namespace,
+// the admission set by anyone but the manager is removed
+func (m *WorkflowQueueMutator) bindNamespaceQueue(ctx context.Context, namespace string, annos map[string]string, isManager bool) error {
+	// the Workflows created by the manager, e.g. the CronWorkflow runs, are bound to the queue as well
+	queues := &workflowv1alpha2.WorkflowQueueList{}
+	if err := m.Client.List(ctx, queues); err != nil {
+		return err
+	}
+	setAnnotation(annos, AnnotationKeyOCMQueue, getNamespaceQueueName(queues.Items, namespace))
+	if !isManager {
+		delete(annos, AnnotationKeyOCMQueueAdmitted)
+	}
+	return nil
+}
+
+// setAnnotation sets the annotation value, or removes the annotation for an empty value
+func setAnnotation(annos map[string]string, key, value string) {
+	if len(value) == 0 {
+		delete(annos, key)
+		return
+	}
+	annos[key] = value
+}
@@ -18,30 +18,99 @@ package workflow
 
 import (
 	"context"
+	"fmt"
 
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
-	workflowv1alpha1 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 )
 
+const (
+	// Workflow annotation that shows the per managed cluster results of a fan-out Workflow.
+	AnnotationKeyOCMManagedClusterStatuses = "workflows.argoproj.io/ocm-managed-cluster-statuses"
+	// Workflow annotation that dictates how many managed clusters a failed Workflow is attempted on, retries are disabled by default.
+	AnnotationKeyOCMMaxClusterAttempts = "workflows.argoproj.io/ocm-max-cluster-attempts"
+	// Workflow annotation that records the history of the previous managed cluster attempts.
+	AnnotationKeyOCMClusterAttempts = "workflows.argoproj.io/ocm-cluster-attempts"
+	// Workflow annotation that lists the comma separated managed clusters the Workflow was deleted on, e.g. by its TTL strategy.
+	AnnotationKeyOCMRemoteDeletedClusters = "workflows.argoproj.io/ocm-remote-deleted-clusters"
+	// Workflow annotation that records the last WorkflowStatusResult accepted from each managed cluster as JSON,
+	// the results older than it are rejected.
+	AnnotationKeyOCMAcceptedResults = "workflows.argoproj.io/ocm-accepted-results"
+	// Workflow annotation that summarizes the managed cluster Workflow output parameters and exit code as JSON.
+	AnnotationKeyOCMOutputs = "workflows.argoproj.io/ocm-outputs"
+	// MaxOutputsSummarySize is the outputs summary JSON size above which it is left out of the Workflow annotations.
+	MaxOutputsSummarySize = 16 * 1024
+	// MaxManagedClusterStatusesSize is the size the per managed cluster results of a fan-out Workflow are kept under,
+	// together with the other annotations they have to fit in the 256KiB annotations limit.
+	MaxManagedClusterStatusesSize = 128 * 1024
+	// MaxNodeStatusSize is the node status JSON size above which it is compressed, same as the Argo controller maximum Workflow size.
+	MaxNodeStatusSize = 1024 * 1024
+	// NodeStatusChunkSize is the compressed node status size above which it is offloaded to WorkflowStatusResultChunks.
+	NodeStatusChunkSize = 1024 * 1024
+	// ConditionTypeNodeStatusOffloaded is the hub Workflow condition that shows its node status is only kept in WorkflowStatusResultChunks.
+	ConditionTypeNodeStatusOffloaded argov1alpha1.ConditionType = "NodeStatusOffloaded"
+)
+
+// ClusterAttempt is the result of a previous attempt to run the Workflow on a managed cluster
+type ClusterAttempt struct {
+	Cluster    string                     `json:"cluster"`
+	Phase      argov1alpha1.WorkflowPhase `json:"phase,omitempty"`
+	Message    string                     `json:"message,omitempty"`
+	StartedAt  metav1.Time                `json:"startedAt,omitempty"`
+	FinishedAt metav1.Time                `json:"finishedAt,omitempty"`
+}
+
+// AcceptedStatusResult is the last WorkflowStatusResult of a managed cluster copied to the hub Workflow status,
+// or the last ManifestWork status feedback for the managed clusters without the status sync addon
+type AcceptedStatusResult struct {
+	Sequence    int64     `json:"sequence"`
+	Generation  int64     `json:"generation,omitempty"`
+	WorkflowUID types.UID `json:"workflowUID,omitempty"`
+	// WorkGeneration is the generation of the ManifestWork the accepted status feedback was reported on.
+	WorkGeneration int64 `json:"workGeneration,omitempty"`
+}
+
+// ManagedClusterWorkflowStatus is the summary of a fan-out Workflow's execution on a single managed cluster
+type ManagedClusterWorkflowStatus struct {
+	Phase      argov1alpha1.WorkflowPhase `json:"phase,omitempty"`
+	Message    string                     `json:"message,omitempty"`
+	StartedAt  metav1.Time                `json:"startedAt,omitempty"`
+	FinishedAt metav1.Time                `json:"finishedAt,omitempty"`
+	Progress   argov1alpha1.Progress      `json:"progress,omitempty"`
+	// Outputs summarizes the output parameters and exit code of the managed cluster Workflow.
+	Outputs *workflowv1alpha2.WorkflowOutputsSummary `json:"outputs,omitempty"`
+}
+
 // WorkflowStatusReconciler reconciles a Workflow object
 type WorkflowStatusReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// DeleteRemoteDeletedResults deletes the result once the managed cluster Workflow deletion is copied to the hub Workflow.
+	DeleteRemoteDeletedResults bool
 }
 
 //+kubebuilder:rbac:groups=argoproj.io,resources=workflows,verbs=get;list;watch;update;patch
-//+kubebuilder:rbac:groups=argoproj.io,resources=workflowstatusresults,verbs=get;list;watch
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowstatusresults,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=argoproj.io,resources=workflowstatusresults/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=placementdecisions,verbs=get;list;watch
 
 // SetupWithManager sets up the controller with the Manager.
 func (re *WorkflowStatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&workflowv1alpha1.WorkflowStatusResult{}).
+		For(&workflowv1alpha2.WorkflowStatusResult{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(re)
 }
 
@@ -49,14 +118,15 @@ func (re *WorkflowStatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
 // The status sync flow:
 // Workflow (dormant) on hub cluster is created and it will be propagated to managed cluster(s)
 // => Workflow on managed cluster (contains annotations that reference the hub cluster dormant Workflow)
-// => The managed cluster status sync agent will create/update a WorkflowStatusResult on the hub cluster (contains annotations that reference the hub cluster dormant Workflow)
+// => The managed cluster status sync agent will create/update a WorkflowStatusResult on the hub cluster (its spec references the hub cluster dormant Workflow)
 // => using the references from WorkflowStatusResult this reconciler finds the dormant Workflow and populate the status.
+// Results older than the last accepted one are rejected and results of a deleted hub Workflow are removed.
 func (r *WorkflowStatusReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 	log.Info("reconciling WorkflowStatusResult for status update..")
 	defer log.Info("done reconciling WorkflowStatusResult for status update")
 
-	var workflowStatusResult workflowv1alpha1.WorkflowStatusResult
+	var workflowStatusResult workflowv1alpha2.WorkflowStatusResult
 	if err := r.Get(ctx, req.NamespacedName, &workflowStatusResult); err != nil {
 		log.Error(err, "unable to fetch WorkflowStatusResult")
 		return ctrl.Result{}, client.IgnoreNotFound(err)
@@ -66,22 +136,298 @@ func (r *WorkflowStatusReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, nil
 	}
 
-	workflowName := workflowStatusResult.Annotations[AnnotationKeyHubWorkflowName]
-	workflowNamespace := workflowStatusResult.Annotations[AnnotationKeyHubWorkflowNamespace]
-
+	ref := workflowStatusResult.Spec.HubWorkflowRef
 	workflow := argov1alpha1.Workflow{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: workflowNamespace, Name: workflowName}, &workflow); err != nil {
+	err := r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, &workflow)
+	if client.IgnoreNotFound(err) != nil {
 		log.Error(err, "unable to fetch Workflow")
 		return ctrl.Result{}, err
 	}
 
-	workflow.Status = workflowStatusResult.WorkflowStatus
+	// the hub Workflow was deleted, possibly recreated with the same name, without cleaning up the result
+	if errors.IsNotFound(err) || !isWorkflowStatusResultOwner(workflow, workflowStatusResult) {
+		log.Info("deleting orphaned WorkflowStatusResult of Workflow " + ref.Namespace + "/" + ref.Name)
+		if err := r.Delete(ctx, &workflowStatusResult); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to delete WorkflowStatusResult")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// the results are cleaned up along with the ManifestWorks
+	if workflow.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	// the last accepted result is recorded on the hub Workflow, the result itself holds the latest write only
+	if accepted, stale := isStaleWorkflowStatusResult(workflow, workflowStatusResult); stale {
+		log.Info(fmt.Sprintf("rejecting stale WorkflowStatusResult sequence %d, already accepted sequence %d",
+			workflowStatusResult.Spec.Sequence, accepted.Sequence))
+		return ctrl.Result{}, r.patchWorkflowStatusResultStatus(ctx, workflowStatusResult,
+			func(result *workflowv1alpha2.WorkflowStatusResult) {
+				setWorkflowStatusResultCondition(result, metav1.ConditionFalse, workflowv1alpha2.ReasonStale,
+					"the managed cluster Workflow status is older than the accepted one")
+			})
+	}
+
+	original := workflow.DeepCopy()
+	managedClusterName := workflowStatusResult.Namespace
+	remoteDeleted := workflowStatusResult.Spec.RemoteDeletionTimestamp != nil
+
+	// the Workflow was rescheduled to another managed cluster, clean up the leftovers
+	if !containsString(getManagedClusterNames(workflow), workflowStatusResult.Namespace) {
+		log.Info("cleaning up WorkflowStatusResult from ManagedCluster " + workflowStatusResult.Namespace + " that no longer runs the Workflow")
+		if err := cleanupManagedClusterWorkflow(ctx, r.Client, workflow, workflowStatusResult.Namespace); err != nil {
+			log.Error(err, "unable to clean up Workflow from ManagedCluster "+workflowStatusResult.Namespace)
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// a Workflow deleted on the managed cluster did not fail there, it keeps its final status
+	if !remoteDeleted {
+		retried, err := retryOnAnotherCluster(ctx, r.Client, workflow, managedClusterName, workflowStatusResult.WorkflowStatus)
+		if err != nil || retried {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if isFanOutWorkflow(workflow) {
+		if err := r.populateFanOutStatus(ctx, &workflow, workflowStatusResult); err != nil {
+			log.Error(err, "unable to aggregate fan-out Workflow status")
+			return ctrl.Result{}, err
+		}
+	} else {
+		workflow.Status = workflowStatusResult.WorkflowStatus
+		// the offloaded node status is larger than the hub Workflow can hold, it is left in the chunks
+		if workflowStatusResult.Spec.NodeStatusChunks > 0 {
+			setNodeStatusOffloadedCondition(&workflow, workflowStatusResult)
+		} else if err := decompressNodeStatusIfFits(&workflow.Status); err != nil {
+			log.Error(err, "unable to decompress the Workflow node status")
+			return ctrl.Result{}, err
+		}
+		if err := setWorkflowOutputsSummary(&workflow, getWorkflowOutputsSummary(workflowStatusResult)); err != nil {
+			log.Error(err, "unable to summarize the Workflow outputs")
+			return ctrl.Result{}, err
+		}
+	}
+	setHubOnlyCondition(&workflow)
+	if remoteDeleted {
+		recordRemoteDeletedCluster(&workflow, managedClusterName)
+	}
+	recordAcceptedStatusResult(&workflow, workflowStatusResult)
+
+	// only the changed status fields, e.g. the changed nodes, are sent. The status is owned by this controller
+	// and the Workflow has no status subresource, so the patch is sent without an optimistic lock to not conflict
+	// with the spec and metadata changes of the other controllers.
+	patch := client.MergeFrom(original)
+	if empty, err := isEmptyPatch(patch, &workflow); err != nil || !empty {
+		if err := r.Patch(ctx, &workflow, patch); err != nil {
+			log.Error(err, "unable to patch Workflow")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := deleteInlinePlacement(ctx, r.Client, workflow); err != nil {
+		log.Error(err, "unable to delete the inline Placement of the completed Workflow")
+		return ctrl.Result{}, err
+	}
+
+	if remoteDeleted {
+		return r.completeRemoteDeletion(ctx, workflow, workflowStatusResult)
+	}
+
+	return ctrl.Result{}, r.patchWorkflowStatusResultStatus(ctx, workflowStatusResult, acceptWorkflowStatusResult)
+}
+
+// completeRemoteDeletion deletes the ManifestWork of the Workflow deleted on the managed cluster so it is not applied again,
+// then either deletes the result or marks it as remote deleted. The status sync agent waits for either
+// before it lets the managed cluster Workflow go.
+func (r *WorkflowStatusReconciler) completeRemoteDeletion(ctx context.Context, workflow argov1alpha1.Workflow,
+	workflowStatusResult workflowv1alpha2.WorkflowStatusResult) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	managedClusterName := workflowStatusResult.Namespace
+
+	log.Info("deleting ManifestWork of Workflow deleted on ManagedCluster " + managedClusterName)
+	if err := deleteManifestWork(ctx, r.Client, workflow, managedClusterName); err != nil {
+		log.Error(err, "unable to delete ManifestWork")
+		return ctrl.Result{}, err
+	}
 
-	err := r.Client.Update(ctx, &workflow)
+	if r.DeleteRemoteDeletedResults {
+		if err := r.Delete(ctx, &workflowStatusResult); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to delete WorkflowStatusResult")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, r.patchWorkflowStatusResultStatus(ctx, workflowStatusResult,
+		func(result *workflowv1alpha2.WorkflowStatusResult) {
+			acceptWorkflowStatusResult(result)
+			meta.SetStatusCondition(&result.Status.Conditions, metav1.Condition{
+				Type:               workflowv1alpha2.ConditionTypeRemoteDeleted,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: result.Generation,
+				Reason:             workflowv1alpha2.ReasonSynced,
+				Message:            "the managed cluster Workflow was deleted, its final status is kept by the hub Workflow",
+			})
+		})
+}
+
+// patchWorkflowStatusResultStatus patches the WorkflowStatusResult status subresource with the changes of the update function,
+// a conflict with the status sync agent is retried on the latest result
+func (r *WorkflowStatusReconciler) patchWorkflowStatusResultStatus(ctx context.Context,
+	workflowStatusResult workflowv1alpha2.WorkflowStatusResult, update func(*workflowv1alpha2.WorkflowStatusResult)) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// the possibly large workflowStatus is left out of the patched copy since only the status is compared
+		result := workflowv1alpha2.WorkflowStatusResult{
+			ObjectMeta: *workflowStatusResult.ObjectMeta.DeepCopy(),
+			Spec:       workflowStatusResult.Spec,
+			Status:     *workflowStatusResult.Status.DeepCopy(),
+		}
+		original := result.DeepCopy()
+		update(&result)
+
+		patch := client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})
+		if empty, err := isEmptyPatch(client.MergeFrom(original), &result); err == nil && empty {
+			return nil
+		}
+		err := r.Status().Patch(ctx, &result, patch)
+		if errors.IsConflict(err) {
+			if err := r.Get(ctx, client.ObjectKeyFromObject(&workflowStatusResult), &workflowStatusResult); err != nil {
+				return err
+			}
+			// a newer result is reconciled on its own event
+			if workflowStatusResult.Spec.Sequence != result.Spec.Sequence {
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to patch WorkflowStatusResult status")
+	}
+	return err
+}
+
+// populateFanOutStatus sets the Workflow status to the aggregated status of every fan-out managed cluster
+// and records the per managed cluster results in an annotation.
+func (r *WorkflowStatusReconciler) populateFanOutStatus(ctx context.Context, workflow *argov1alpha1.Workflow,
+	workflowStatusResult workflowv1alpha2.WorkflowStatusResult) error {
+	clusterStatuses := map[string]argov1alpha1.WorkflowStatus{}
+	summaries := map[string]ManagedClusterWorkflowStatus{}
+	previousSummaries := getManagedClusterStatuses(*workflow)
+	for _, managedClusterName := range getManagedClusterNames(*workflow) {
+		clusterStatus := argov1alpha1.WorkflowStatus{}
+		var outputs *workflowv1alpha2.WorkflowOutputsSummary
+		if summary, ok := previousSummaries[managedClusterName]; ok && isLostCluster(*workflow, managedClusterName) {
+			// the lost managed cluster stays failed even if it comes back
+			clusterStatus = getSummaryWorkflowStatus(summary)
+			outputs = summary.Outputs
+		} else if managedClusterName == workflowStatusResult.Namespace {
+			clusterStatus = workflowStatusResult.WorkflowStatus
+			outputs = getWorkflowOutputsSummary(workflowStatusResult)
+		} else {
+			result := workflowv1alpha2.WorkflowStatusResult{}
+			err := r.Get(ctx, types.NamespacedName{Namespace: managedClusterName, Name: generateManifestWorkName(*workflow)}, &result)
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			clusterStatus = result.WorkflowStatus
+			if err == nil {
+				outputs = getWorkflowOutputsSummary(result)
+			}
+
+			// the result of a Workflow deleted on the managed cluster might be deleted as well, use its last summary
+			if summary, ok := previousSummaries[managedClusterName]; errors.IsNotFound(err) && ok &&
+				isRemoteDeletedCluster(*workflow, managedClusterName) {
+				clusterStatus = getSummaryWorkflowStatus(summary)
+				outputs = summary.Outputs
+			}
+		}
+
+		clusterStatuses[managedClusterName] = clusterStatus
+		summaries[managedClusterName] = ManagedClusterWorkflowStatus{
+			Phase:      clusterStatus.Phase,
+			Message:    clusterStatus.Message,
+			StartedAt:  clusterStatus.StartedAt,
+			FinishedAt: clusterStatus.FinishedAt,
+			Progress:   clusterStatus.Progress,
+			Outputs:    outputs,
+		}
+	}
+
+	if err := setManagedClusterStatuses(workflow, summaries); err != nil {
+		return err
+	}
+	workflow.Status = aggregateFanOutStatus(clusterStatuses)
+
+	return nil
+}
+
+// listRetryCandidates returns the managed clusters decided by the last Placement of the Workflow
+// that it can be retried on, the excluded and the failed managed clusters are left out
+func listRetryCandidates(ctx context.Context, c client.Client, workflow argov1alpha1.Workflow,
+	managedClusterName string) ([]string, error) {
+	placementDecisions := &clusterv1beta1.PlacementDecisionList{}
+	err := c.List(ctx, placementDecisions, client.InNamespace(workflow.Namespace),
+		client.MatchingLabels{clusterv1beta1.PlacementLabel: workflow.GetAnnotations()[AnnotationKeyOCMLastPlacement]})
+	if err != nil {
+		return nil, err
+	}
+
+	return getRetryCandidates(workflow, getDecidedClusterNames(placementDecisions.Items), managedClusterName), nil
+}
+
+// retryOnAnotherCluster records the failed attempt then evaluates the Placement again while excluding the failed managed cluster,
+// for the Workflows that failed on their managed cluster and have attempts and another decided managed cluster left.
+// Both the WorkflowStatusResults and the status feedback go through it. Returns true if the Workflow is retried.
+func retryOnAnotherCluster(ctx context.Context, c client.Client, workflow argov1alpha1.Workflow, managedClusterName string,
+	clusterStatus argov1alpha1.WorkflowStatus) (bool, error) {
+	log := log.FromContext(ctx)
+	if !shouldRetryOnAnotherCluster(workflow, clusterStatus) {
+		return false, nil
+	}
+
+	candidates, err := listRetryCandidates(ctx, c, workflow, managedClusterName)
 	if err != nil {
+		log.Error(err, "unable to list the PlacementDecisions of the Workflow")
+		return false, err
+	}
+	if len(candidates) == 0 {
+		log.Info("no other ManagedCluster to retry the Workflow on, keeping the failed status")
+		return false, nil
+	}
+
+	if err := recordClusterAttempt(&workflow, managedClusterName, clusterStatus); err != nil {
+		log.Error(err, "unable to record the ManagedCluster attempt")
+		return false, err
+	}
+
+	if !prepareWorkflowForReschedule(&workflow, managedClusterName) {
+		log.Info("unable to retry Workflow without a Placement")
+		return false, nil
+	}
+
+	attempts := len(getClusterAttempts(workflow))
+	log.Info(fmt.Sprintf("retrying Workflow on another ManagedCluster, attempt %d/%d", attempts+1, getMaxClusterAttempts(workflow)))
+	workflow.Status = argov1alpha1.WorkflowStatus{
+		Phase: argov1alpha1.WorkflowPending,
+		Message: fmt.Sprintf("Workflow %s on ManagedCluster %s (attempt %d/%d): %s, pending retry on another ManagedCluster",
+			clusterStatus.Phase, managedClusterName, attempts, getMaxClusterAttempts(workflow), clusterStatus.Message),
+	}
+	setHubOnlyCondition(&workflow)
+
+	if err := c.Update(ctx, &workflow); err != nil {
 		log.Error(err, "unable to update Workflow")
-		return ctrl.Result{}, err
+		return false, err
+	}
+
+	if err := cleanupManagedClusterWorkflow(ctx, c, workflow, managedClusterName); err != nil {
+		log.Error(err, "unable to clean up Workflow from ManagedCluster "+managedClusterName)
+		return true, err
 	}
 
-	return ctrl.Result{}, nil
+	return true, nil
 }
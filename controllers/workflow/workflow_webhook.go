@@ -0,0 +1,88 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/argoproj/argo-workflows/v3/pkg/apis/workflow"
+)
+
+// WebhookPathHubOnly is the path the hub only mutating webhook is served at.
+const WebhookPathHubOnly = "/mutate-argoproj-io-v1alpha1-workflow"
+
+//+kubebuilder:webhook:path=/mutate-argoproj-io-v1alpha1-workflow,mutating=true,failurePolicy=fail,sideEffects=None,groups=argoproj.io,resources=workflows;cronworkflows,verbs=create;update,versions=v1alpha1,name=mworkflow.open-cluster-management.io,admissionReviewVersions=v1
+
+// WorkflowHubOnlyMutator labels the OCM enabled Workflows and CronWorkflows with the hub controller instance ID
+// at creation and update, so the hub Argo controller never picks them up before the reconcilers do.
+// It also keeps anyone but the manager from changing the placement decision records of the Workflows.
+// It is required, the reconcilers only label the Workflows that were created while it was not served.
+type WorkflowHubOnlyMutator struct {
+	// InstanceID is the hub controller instance ID.
+	InstanceID string
+	// ManagerUsername is the username of the manager, the only one that can record the placement decisions.
+	ManagerUsername string
+}
+
+// Handle sets the hub controller instance ID label, the instance ID the user set is kept in an annotation,
+// and restores the placement decision records anyone but the manager set or changed
+func (m *WorkflowHubOnlyMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// the webhook selects every Workflow with the label, whatever its value
+	if !isOCMMulticlusterEnabled(obj.GetLabels()) {
+		return admission.Allowed("not an OCM multicluster Workflow")
+	}
+	changed := ensureHubOnlyLabel(obj, m.InstanceID)
+
+	if req.Kind.Kind == workflow.WorkflowKind && req.UserInfo.Username != m.ManagerUsername {
+		recorded := ""
+		if req.Operation == admissionv1.Update {
+			oldObj := &unstructured.Unstructured{}
+			if err := oldObj.UnmarshalJSON(req.OldObject.Raw); err != nil {
+				return admission.Errored(http.StatusBadRequest, err)
+			}
+			recorded = oldObj.GetAnnotations()[AnnotationKeyOCMPlacementDecision]
+		}
+		if annos := obj.GetAnnotations(); annos[AnnotationKeyOCMPlacementDecision] != recorded {
+			if annos == nil {
+				annos = map[string]string{}
+			}
+			setAnnotation(annos, AnnotationKeyOCMPlacementDecision, recorded)
+			obj.SetAnnotations(annos)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return admission.Allowed("already labeled and placement decisions unchanged")
+	}
+
+	mutated, err := obj.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, mutated)
+}
@@ -4,4 +4,6 @@ set -o nounset
 set -o pipefail
 
 kubectl config use-context kind-hub
+kubectl apply -f https://github.com/cert-manager/cert-manager/releases/download/v1.11.0/cert-manager.yaml
+kubectl wait deployment -n cert-manager cert-manager-webhook --for condition=Available=True --timeout=120s
 kubectl apply -f hack/crds/
@@ -19,23 +19,30 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
 	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
 	workv1 "open-cluster-management.io/api/work/v1"
 	workflowv1alpha1 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha1"
+	workflowv1alpha2 "open-cluster-management.io/argo-workflow-multicluster/api/v1alpha2"
 	workflow "open-cluster-management.io/argo-workflow-multicluster/controllers/workflow"
 )
 
@@ -48,20 +55,41 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(argov1alpha1.AddToScheme(scheme))
 	utilruntime.Must(clusterv1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(clusterv1beta1.AddToScheme(scheme))
 	utilruntime.Must(workv1.AddToScheme(scheme))
 	utilruntime.Must(workflowv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(workflowv1alpha2.AddToScheme(scheme))
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var clusterUnavailableGracePeriod time.Duration
+	var hubControllerInstanceID string
+	var deleteRemoteDeletedResults bool
+	var statusFeedback bool
+	var enableWorkflowQueue bool
+	var managerUsername string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&clusterUnavailableGracePeriod, "cluster-unavailable-grace-period", 5*time.Minute,
+		"How long a ManagedCluster can be unavailable before its running Workflows are failed or rescheduled.")
+	flag.StringVar(&hubControllerInstanceID, "hub-controller-instance-id", workflow.DefaultHubControllerInstanceID,
+		"The controller instance ID the hub Workflows are labeled with so the hub Argo controller does not execute them.")
+	flag.BoolVar(&deleteRemoteDeletedResults, "delete-remote-deleted-results", false,
+		"Delete the WorkflowStatusResults of the Workflows deleted on the managed clusters once their final status is copied.")
+	flag.BoolVar(&statusFeedback, "status-feedback", false,
+		"Report the basic Workflow status through the ManifestWork status feedback for the managed clusters without the status sync addon.")
+	flag.BoolVar(&enableWorkflowQueue, "enable-workflow-queue", false,
+		"Hold the placed Workflows of the namespaces bound to a WorkflowQueue on the hub until the queue admits them, "+
+			"requires the WorkflowQueue CRD and serves the queue mutating webhook.")
+	flag.StringVar(&managerUsername, "manager-username", workflow.DefaultManagerUsername,
+		"The username of the manager, the mutating webhooks only let it record the placement decisions and admit the queued Workflows.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -75,8 +103,12 @@ func main() {
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "ec810684.open-cluster-management.io",
+		// only the Events the status sync agents emit for the managed cluster Workflows are watched
+		NewCache: cache.BuilderWithOptions(cache.Options{SelectorsByObject: cache.SelectorsByObject{
+			&corev1.Event{}: {Field: fields.OneTermEqualSelector("involvedObject.kind", workflow.KindWorkflowStatusResult)},
+		}}),
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: "ec810684.open-cluster-management.io",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -95,29 +127,99 @@ func main() {
 	}
 
 	if err = (&workflow.WorkflowReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		HubInstanceID:  hubControllerInstanceID,
+		StatusFeedback: statusFeedback,
+		WorkflowQueue:  enableWorkflowQueue,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create workflow controller", "workflow controller", "Workflow")
 		os.Exit(1)
 	}
 
 	if err = (&workflow.WorkflowPlacementReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		HubInstanceID: hubControllerInstanceID,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create workflow placement controller", "workflow placement controller", "Workflow")
 		os.Exit(1)
 	}
 
 	if err = (&workflow.WorkflowStatusReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                     mgr.GetClient(),
+		Scheme:                     mgr.GetScheme(),
+		DeleteRemoteDeletedResults: deleteRemoteDeletedResults,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create workflow status controller", "workflow status controller", "Workflow")
 		os.Exit(1)
 	}
 
+	if statusFeedback {
+		if err = (&workflow.WorkflowFeedbackReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create workflow feedback controller", "workflow feedback controller", "ManifestWork")
+			os.Exit(1)
+		}
+	}
+
+	if enableWorkflowQueue {
+		if err = (&workflow.WorkflowQueueReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create workflow queue controller", "workflow queue controller", "WorkflowQueue")
+			os.Exit(1)
+		}
+	}
+
+	if err = (&workflow.WorkflowEventReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("argo-workflow-multicluster"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create workflow event controller", "workflow event controller", "Event")
+		os.Exit(1)
+	}
+
+	if err = (&workflow.WorkflowClusterReconciler{
+		Client:                 mgr.GetClient(),
+		Scheme:                 mgr.GetScheme(),
+		UnavailableGracePeriod: clusterUnavailableGracePeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create workflow cluster controller", "workflow cluster controller", "ManagedCluster")
+		os.Exit(1)
+	}
+
+	if err = (&workflow.CronWorkflowReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		HubInstanceID: hubControllerInstanceID,
+		Recorder:      mgr.GetEventRecorderFor("argo-workflow-multicluster"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create cron workflow controller", "cron workflow controller", "CronWorkflow")
+		os.Exit(1)
+	}
+
+	if enableWorkflowQueue {
+		mgr.GetWebhookServer().Register(workflow.WebhookPathQueue, &webhook.Admission{
+			Handler: &workflow.WorkflowQueueMutator{Client: mgr.GetClient(), ManagerUsername: managerUsername},
+		})
+	}
+
+	// the hub Argo controller must never see an OCM Workflow without the hub controller instance ID
+	mgr.GetWebhookServer().Register(workflow.WebhookPathHubOnly, &webhook.Admission{
+		Handler: &workflow.WorkflowHubOnlyMutator{InstanceID: hubControllerInstanceID, ManagerUsername: managerUsername},
+	})
+
+	// the status sync agents that are not upgraded yet still write v1alpha1 WorkflowStatusResults
+	if err = ctrl.NewWebhookManagedBy(mgr).For(&workflowv1alpha2.WorkflowStatusResult{}).Complete(); err != nil {
+		setupLog.Error(err, "unable to create conversion webhook", "webhook", "WorkflowStatusResult")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)